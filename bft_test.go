@@ -92,6 +92,7 @@ func initCommittee(ctrl *gomock.Controller, byzantineIndex int, initState *messa
 		committees[i].EXPECT().GetCommitHistory(gomock.Any()).DoAndReturn(func(height int64) *message.Commit {
 			return nil
 		})
+		committees[i].EXPECT().ReportEvidence(gomock.Any()).AnyTimes()
 	}
 }
 
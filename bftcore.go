@@ -20,12 +20,18 @@ type Core struct {
 	validators *Validators
 
 	RoundState
-	stateSync *StateSync
+	blockSync *blockSync
+	evpool    *EvidencePool
+	peers     *peerStates
 	//triggeredTimeoutPrecommit bool
-	hasRecvCommitRecords bool
 
 	msgQueue      chan msgInfo
 	timeoutTicker TimeoutTicker
+	retransmitter *retransmitter
+	latency       *latencyTracker
+	wal           WAL
+	replayMode    bool
+	observer      bool
 	started       int32
 	inStartOrStop int32
 	done          chan struct{}
@@ -34,6 +40,17 @@ type Core struct {
 	msgCnt         int64
 	msgProcessTime time.Duration
 
+	haltCallback func(report *HaltReport)
+	// round of the last HaltReport of the current height, 0 if none
+	haltReportedRound int
+
+	// validators reported to misbehaviourCallback at the current height
+	offenders            map[message.PubKey]bool
+	misbehaviourCallback func(offender message.PubKey, err error)
+
+	// handlers of application-defined messages, see RegisterHandler
+	handlers map[reflect.Type]MessageHandler
+
 	extLog *logrus.Logger
 	log    *logrus.Entry
 
@@ -49,14 +66,41 @@ func NewCore(vals custom.ICommittee, pVal custom.IPrivValidator) *Core {
 		cfg:        DefaultConfig(),
 		validators: NewValidators(vals, pVal),
 		msgQueue:   make(chan msgInfo, msgQueueSize),
+		wal:        nilWAL{},
 		started:    0,
+		handlers:   make(map[reflect.Type]MessageHandler),
 	}
 	//c.cfg.SkipTimeoutCommit = true
-	c.stateSync = NewStateSync(c)
+	c.blockSync = newBlockSync()
+	c.evpool = NewEvidencePool(c.validators, c.cfg.MaxEvidenceAge)
+	c.peers = newPeerStates()
+	c.retransmitter = newRetransmitter(c.cfg.RetransmitInterval, c.cfg.RetransmitMaxInterval)
+	c.latency = newLatencyTracker(c.cfg.AdaptiveWindow)
 
 	return c
 }
 
+/*
+NewObserver creates a Core that follows the consensus of vals without
+taking part in it, e.g. for RPC or archive nodes. It tracks the votes of
+the committee, forms Commits of its own and hands them to
+ICommittee.Commit, but never signs a vote or a Commit even if nodeKey
+belongs to a validator.
+
+nodeKey only signs the requests for missing votes and Commits sent to
+validators.
+*/
+func NewObserver(vals custom.ICommittee, nodeKey custom.IPrivValidator) *Core {
+	c := NewCore(vals, nodeKey)
+	c.observer = true
+	return c
+}
+
+// IsObserver returns true if the Core is created by NewObserver
+func (c *Core) IsObserver() bool {
+	return c.observer
+}
+
 func (c *Core) SetLogger(lg *logrus.Logger) {
 	c.extLog = lg
 	c.log = lg.WithField("gobft", "on")
@@ -73,6 +117,19 @@ func (c *Core) SetName(n string) {
 	})
 }
 
+// SetConfig replaces the default config. It should be called before Start
+func (c *Core) SetConfig(cfg *Config) error {
+	if err := cfg.ValidateBasic(); err != nil {
+		return err
+	}
+	c.cfg = cfg
+	c.validators.SetChainID(cfg.ChainID)
+	c.evpool.SetMaxAge(cfg.MaxEvidenceAge)
+	c.retransmitter = newRetransmitter(cfg.RetransmitInterval, cfg.RetransmitMaxInterval)
+	c.latency = newLatencyTracker(cfg.AdaptiveWindow)
+	return nil
+}
+
 func (c *Core) Start() error {
 	if !atomic.CompareAndSwapInt32(&c.inStartOrStop, 0, 1) {
 		return errors.New("gobft is in the process of start or stop")
@@ -86,16 +143,37 @@ func (c *Core) Start() error {
 	c.done = make(chan struct{})
 	c.timeoutTicker = NewTimeoutTicker(c)
 
+	if c.cfg.SignStateFile != "" {
+		if err := c.validators.LoadSignGuard(c.cfg.SignStateFile); err != nil {
+			return err
+		}
+	}
+
 	if err := c.timeoutTicker.Start(); err != nil {
 		return err
 	}
 	appState := c.validators.CustomValidators.GetAppState()
 	c.Votes = nil
 	c.updateToAppState(appState)
+	c.StartTime = time.Now().Add(time.Second)
+
+	if c.cfg.WalDir != "" {
+		wal, err := OpenWAL(c.cfg.WalDir)
+		if err != nil {
+			c.timeoutTicker.Stop()
+			return err
+		}
+		c.wal = wal
+		if err := c.catchupReplay(c.Height - 1); err != nil {
+			c.timeoutTicker.Stop()
+			c.wal.Close()
+			c.wal = nilWAL{}
+			return err
+		}
+	}
 
 	c.Add(1)
 	go c.receiveRoutine()
-	c.StartTime = time.Now().Add(time.Second)
 	c.scheduleRound0(c.GetRoundState())
 	atomic.StoreInt32(&c.started, 1)
 	return nil
@@ -114,6 +192,11 @@ func (c *Core) Stop() error {
 	c.timeoutTicker.Stop()
 	close(c.done)
 	c.Wait()
+	c.retransmitter.reset(c.Height)
+	if err := c.wal.Close(); err != nil {
+		c.log.Error("failed to close WAL: ", err)
+	}
+	c.wal = nilWAL{}
 	c.log.Info("bftCore stopped")
 	atomic.StoreInt32(&c.started, 0)
 	return nil
@@ -134,6 +217,48 @@ func (c *Core) GetLastCommit() *message.Commit {
 	return c.LastCommit.MakeCommit()
 }
 
+// GetPendingEvidence returns the verified evidence of misbehaviour that is
+// not expired yet
+func (c *Core) GetPendingEvidence() []message.Evidence {
+	return c.evpool.PendingEvidence()
+}
+
+// SetHaltCallback sets the function called with a HaltReport whenever the
+// current height goes another Config.HaltRounds rounds without a commit. It's
+// called in its own goroutine.
+func (c *Core) SetHaltCallback(cb func(report *HaltReport)) {
+	c.Lock()
+	defer c.Unlock()
+	c.haltCallback = cb
+}
+
+// SetMisbehaviourCallback sets the function called when a validator misbehaves
+// in a way that can't be proved with Evidence, e.g. it makes us track too many
+// rounds beyond ours. It's called at most once per validator per height in its
+// own goroutine.
+func (c *Core) SetMisbehaviourCallback(cb func(offender message.PubKey, err error)) {
+	c.Lock()
+	defer c.Unlock()
+	c.misbehaviourCallback = cb
+}
+
+// SetAggregator lets Commits carry a CommitCertificate instead of the
+// precommits when +2/3 of the voting power signed them for aggregation, which
+// the precommits of an IAggPrivValidator are. It should be set before Start
+// and on every node, as Commits with a certificate can't be verified without.
+func (c *Core) SetAggregator(agg custom.IAggregator) {
+	c.Lock()
+	defer c.Unlock()
+	c.validators.SetAggregator(agg)
+}
+
+// GetHaltReport returns a HaltReport of the current height
+func (c *Core) GetHaltReport() *HaltReport {
+	c.RLock()
+	defer c.RUnlock()
+	return c.makeHaltReport()
+}
+
 // RecvMsg accepts a ConsensusMessage and delivers it to receiveRoutine
 func (c *Core) RecvMsg(msg message.ConsensusMessage, p custom.IPeer) error {
 	if atomic.LoadInt32(&c.started) == 1 {
@@ -198,11 +323,24 @@ func (c *Core) updateToAppState(appState *message.AppState) {
 	c.Proposal = nil
 	c.LockedRound = -1
 	c.LockedProposal = nil
+	c.ValidRound = -1
+	c.ValidProposal = nil
 
 	c.CommitRound = -1
 	c.LastCommit = lastPrecommits
 	c.lastCommittedData = appState.LastProposedData
-	c.Votes = NewHeightVoteSet(c.Height, c.validators, &c.lastCommittedData)
+	// switch to the committee of the new height. Votes of the previous
+	// height are still counted against the previous one by LastCommit
+	valSet, errs := c.validators.updateHeight(c.Height, c.cfg.ValidatorUpdateDelay)
+	for _, err := range errs {
+		c.log.Errorf("committee of height %d: %v", c.Height, err)
+	}
+	c.Votes = NewHeightVoteSet(c.Height, valSet, &c.lastCommittedData)
+	c.offenders = make(map[message.PubKey]bool)
+	c.haltReportedRound = 0
+	c.evpool.Update(c.Height)
+	c.retransmitter.reset(c.Height)
+	c.updateTimeouts()
 }
 
 // receiveRoutine keeps the RoundState and is the only thing that updates it.
@@ -218,22 +356,92 @@ func (c *Core) receiveRoutine() {
 		case <-c.done:
 			return
 		case mi = <-c.msgQueue:
+			// our own votes hit the disk in signVote already
+			if isWalMessage(mi.Msg) && !c.isOwnVote(mi) {
+				if err := c.wal.Write(mi); err != nil {
+					c.log.Error("failed to write msg to WAL: ", err)
+				}
+			}
 			startTime := time.Now()
 			c.handleMsg(mi)
 			elapsed := time.Since(startTime)
 			c.msgProcessTime += elapsed
 			c.msgCnt++
-			if c.msgCnt % 100 == 0 {
+			if c.msgCnt%100 == 0 {
 				c.log.Infof("average time to process a consensus msg: %d ms",
 					c.msgProcessTime.Nanoseconds()/1e6/c.msgCnt)
 			}
 		case ti := <-c.timeoutTicker.Chan(): // tockChan:
+			if err := c.wal.Write(ti); err != nil {
+				c.log.Error("failed to write timeout to WAL: ", err)
+			}
 			c.handleTimeout(ti, rs)
+		case <-c.retransmitter.C():
+			c.retransmit()
 		}
 	}
 }
 
+// isWalMessage returns true if msg might change the RoundState. Messages that
+// never do (e.g. FetchVotesReq, application messages) are not worth writing
+// to WAL.
+func isWalMessage(msg message.ConsensusMessage) bool {
+	switch msg.(type) {
+	case *message.Vote, *message.Commit, *message.FetchVotesRsp, *message.VoteBatch:
+		return true
+	default:
+		return false
+	}
+}
+
+// isOwnVote returns true if mi is a vote of ours from signAddVote
+func (c *Core) isOwnVote(mi msgInfo) bool {
+	vote, ok := mi.Msg.(*message.Vote)
+	return ok && mi.Peer == nil && vote.Address == c.validators.GetSelfPubKey()
+}
+
+// catchupReplay replays everything in WAL after height is committed so
+// that we can pick up where we left off. Our own votes are not signed or
+// broadcasted again during replay, they are replayed from WAL as well.
+func (c *Core) catchupReplay(height int64) error {
+	c.replayMode = true
+	defer func() { c.replayMode = false }()
+
+	replayed := 0
+	found, err := c.wal.Replay(height, func(msg walMessage) {
+		replayed++
+		switch m := msg.(type) {
+		case msgInfo:
+			// our own votes are retransmitted as if we just signed them
+			if vote, ok := m.Msg.(*message.Vote); ok && vote.Address == c.validators.GetSelfPubKey() {
+				c.retransmitter.track(vote)
+			}
+			c.handleMsg(m)
+		case timeoutInfo:
+			c.handleTimeout(m, c.RoundState)
+		case endHeightMessage:
+			// the height was committed but we crashed before the app state
+			// was updated. Nothing to do, the following msgs bring us there.
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		// WAL is empty or we've synced past it, start over
+		c.log.Infof("no WAL entries for height %d, starting a new WAL", height+1)
+		return c.wal.Rotate(height)
+	}
+	c.log.Infof("replayed %d WAL entries. Current: %v/%v/%v", replayed, c.Height, c.Round, c.Step)
+	return nil
+}
+
 func (c *Core) handleMsg(mi msgInfo) {
+	if handler := c.getHandler(mi.Msg); handler != nil {
+		c.handleAppMsg(mi, handler)
+		return
+	}
+
 	c.Lock()
 	defer c.Unlock()
 
@@ -243,11 +451,7 @@ func (c *Core) handleMsg(mi msgInfo) {
 
 	switch msg := msg.(type) {
 	case *message.Vote:
-		// if we're not a validator, just ignore
-		if !c.isValidator() { // TODO: cache
-			return
-		}
-
+		// non-validators track votes as well to follow the commits
 		_, err = c.tryAddVote(msg)
 
 		if err == ErrAddingVote {
@@ -272,19 +476,28 @@ func (c *Core) handleMsg(mi msgInfo) {
 			c.log.Error(err)
 			return
 		}
-		if msg.Height() == c.Height {
-			c.hasRecvCommitRecords = true
+		if err := c.validateSize(msg, msg.Height()); err != nil {
+			c.log.Error(err)
+			return
 		}
+		// a Commit proves its height is decided, there's no need to vote
+		// any further. It's applied as is once verified
 		if msg.Height() >= c.Height {
-			for i := range msg.Precommits {
-				c.tryAddVote(msg.Precommits[i])
-			}
+			c.addSyncCommit(msg)
 		}
 
 	case *message.FetchVotesReq:
 		c.handleFetch(msg, mi.Peer)
 	case *message.FetchVotesRsp:
 		c.handleFetchRsp(msg, mi.Peer)
+	case *message.NewRoundStep:
+		c.handleRoundStep(msg, mi.Peer)
+	case *message.FetchCommitsReq:
+		c.handleFetchCommits(msg, mi.Peer)
+	case *message.VoteBatch:
+		c.handleVoteBatch(msg)
+	case message.Evidence:
+		c.addEvidence(msg)
 	default:
 		c.log.Error("Unknown msg type ", reflect.TypeOf(msg))
 	}
@@ -293,27 +506,36 @@ func (c *Core) handleMsg(mi msgInfo) {
 	}
 }
 
+// handleFetch answers a FetchVotesReq. The missing votes go in a single
+// FetchVotesRsp rather than a VoteBatch: it's already one signed message for
+// all of them, and the requester only takes it while it's fetching or
+// waiting for a POL. A requester at an older height gets the Commit, which
+// carries the precommits of the height by itself.
 func (c *Core) handleFetch(msg *message.FetchVotesReq, p custom.IPeer) {
 	c.log.Debug("handle FetchVotesReq: ", msg)
 	if err := msg.ValidateBasic(); err != nil {
 		c.log.Error(err)
 		return
 	}
+	if err := c.validateSize(msg, msg.Height); err != nil {
+		c.log.Error(err)
+		return
+	}
+	if c.validators.VerifySignatureAt(msg, msg.Height) {
+		c.peers.updateFromFetch(msg, p)
+		c.checkBehind()
+	}
 
 	var rsp *message.FetchVotesRsp
 	if msg.Height < c.Height {
+		// the requester fell behind, the Commit is all it needs
 		commit := c.validators.CustomValidators.GetCommitHistory(msg.Height)
 		if commit == nil {
 			c.log.Error("failed to get history commits")
 			return
 		}
-		rsp = &message.FetchVotesRsp{
-			Type:         message.PrecommitType,
-			Height:       msg.Height,
-			Round:        msg.Round,
-			MissingVotes: commit.Precommits,
-		}
-
+		c.validators.CustomValidators.Send(commit, p)
+		return
 	} else if msg.Height == c.Height && msg.Round <= c.Round {
 		if msg.Type == message.PrevoteType {
 			rsp = c.Votes.Prevotes(msg.Round).MakeFetchVotesRsp(msg)
@@ -322,27 +544,104 @@ func (c *Core) handleFetch(msg *message.FetchVotesReq, p custom.IPeer) {
 		}
 	}
 	if rsp != nil {
-		c.validators.Sign(rsp)
+		if err := c.validators.Sign(rsp); err != nil {
+			c.log.Error("failed to sign FetchVotesRsp: ", err)
+			return
+		}
 		c.log.Debug("sending FetchVotesRsp", rsp)
 		c.validators.CustomValidators.Send(rsp, p)
+	} else if c.isValidator() {
+		// the requester is ahead of us, let it know so that it asks
+		// someone else next time
+		if nrs := c.makeRoundStep(); nrs != nil {
+			c.validators.CustomValidators.Send(nrs, p)
+		}
 	}
 }
 
 func (c *Core) handleFetchRsp(msg *message.FetchVotesRsp, p custom.IPeer) {
-	if c.Height == msg.Height && c.Round <= msg.Round {
-		if c.Step != RoundStepPrevoteFetch && c.Step != RoundStepPrecommitFetch {
+	if c.Height == msg.Height && (c.Round <= msg.Round || c.isPOLFetchRsp(msg)) {
+		if c.Step != RoundStepPrevoteFetch && c.Step != RoundStepPrecommitFetch &&
+			!c.isPOLFetchRsp(msg) {
 			return
 		}
 		if err := msg.ValidateBasic(); err != nil {
 			c.log.Error(err)
 			return
 		}
+		if err := c.validateSize(msg, msg.Height); err != nil {
+			c.log.Error(err)
+			return
+		}
 		for i := range msg.MissingVotes {
 			c.tryAddVote(msg.MissingVotes[i])
 		}
 	}
 }
 
+func (c *Core) handleRoundStep(msg *message.NewRoundStep, p custom.IPeer) {
+	c.log.Debug("handle NewRoundStep: ", msg)
+	if err := msg.ValidateBasic(); err != nil {
+		c.log.Error(err)
+		return
+	}
+	if err := c.validateSize(msg, msg.Height); err != nil {
+		c.log.Error(err)
+		return
+	}
+	if !c.validators.VerifySignatureAt(msg, msg.Height) {
+		c.log.Error("invalid NewRoundStep signature from ", msg.Address)
+		return
+	}
+	c.peers.update(msg, p)
+	c.checkBehind()
+	c.pushVotes(msg, p)
+
+	// don't wait for the next fetch if it has the votes we're missing
+	fvr := c.makeFetchVotesReq()
+	if fvr == nil || c.replayMode {
+		return
+	}
+	if c.peers.shouldFetchFrom(msg.Address, c.Height, c.Round, fvr.Type, fvr.Voters) {
+		c.peers.markTried(msg.Address)
+		c.sendFetchVotesReq(fvr, p)
+	}
+}
+
+// broadcastRoundStep tells the others our height/round/step and the votes
+// we have in this round
+func (c *Core) broadcastRoundStep() {
+	if c.replayMode || !c.isValidator() || c.isSoleValidator() {
+		return
+	}
+	if nrs := c.makeRoundStep(); nrs != nil {
+		c.validators.CustomValidators.BroadCast(nrs)
+	}
+}
+
+func (c *Core) makeRoundStep() *message.NewRoundStep {
+	nrs := &message.NewRoundStep{
+		Height:     c.Height,
+		Round:      c.Round,
+		Step:       uint8(c.Step),
+		Prevotes:   c.Votes.Prevotes(c.Round).BitArray(),
+		Precommits: c.Votes.Precommits(c.Round).BitArray(),
+		Time:       time.Now(),
+	}
+	if err := c.validators.Sign(nrs); err != nil {
+		c.log.Error("failed to sign NewRoundStep: ", err)
+		return nil
+	}
+	return nrs
+}
+
+// isPOLFetchRsp returns true if msg might contain the POL of the current
+// proposal we're waiting for
+func (c *Core) isPOLFetchRsp(msg *message.FetchVotesRsp) bool {
+	return c.Proposal != nil && c.Step < RoundStepPrevote &&
+		msg.Type == message.PrevoteType && msg.Round == c.Proposal.POLRound
+}
+
 func (c *Core) handleTimeout(ti timeoutInfo, rs RoundState) {
 	c.log.Debug("Received tock ", " timeout ", ti.Duration, " height ", ti.Height, " round ", ti.Round, " step ", ti.Step)
 
@@ -384,7 +683,9 @@ func (c *Core) handleTimeout(ti timeoutInfo, rs RoundState) {
 // Used internally by handleTimeout and handleMsg to make state transitions
 
 // Enter: `timeoutNewHeight` by startTime (commitTime+timeoutCommit),
-// 	or, if SkipTimeout==true, after receiving all precommits from (height,round-1)
+//
+//	or, if SkipTimeout==true, after receiving all precommits from (height,round-1)
+//
 // Enter: `timeoutPrecommits` after any +2/3 precommits from (height,round-1)
 // Enter: +2/3 precommits for nil at (height,round-1)
 // Enter: +2/3 prevotes any or +2/3 precommits for block or any from (height, round)
@@ -414,22 +715,66 @@ func (c *Core) enterNewRound(height int64, round int) {
 		c.Proposal = nil
 	}
 	c.Votes.SetRound(round + 1) // also track next round (round+1) to allow round-skipping
+	c.broadcastRoundStep()
+
+	// rounds skipped to count as well
+	if c.cfg.HaltRounds > 0 && round-c.haltReportedRound >= c.cfg.HaltRounds {
+		c.haltReportedRound = round
+		c.reportHalt()
+	}
 
 	c.enterPropose(height, round)
 }
 
+func (c *Core) reportHalt() {
+	report := c.makeHaltReport()
+	c.log.Warn("height is not committed after ", c.Round, " rounds: ", report)
+	if c.haltCallback != nil && !c.replayMode {
+		go c.haltCallback(report)
+	}
+}
+
+// isReadyToPrevote returns true if we have the proposal and, in case we're
+// locked on something else, the POL we might unlock with.
 func (c *Core) isReadyToPrevote() bool {
-	// TODO:
-	if c.Proposal != nil || c.LockedRound >= 0 {
-		return true
+	if c.Proposal == nil {
+		return false
+	}
+	if c.LockedRound >= 0 && c.LockedProposal.Proposed != c.Proposal.Proposed &&
+		c.Proposal.POLRound > c.LockedRound {
+		return c.hasPOL(c.Proposal.POLRound, c.Proposal.Proposed)
 	}
+	return true
+}
+
+// hasPOL returns true if there're +2/3 prevotes for data at round
+func (c *Core) hasPOL(round int, data message.ProposedData) bool {
+	prevotes := c.Votes.Prevotes(round)
+	if prevotes == nil {
+		return false
+	}
+	polkaData, ok := prevotes.TwoThirdsMajority()
+	return ok && polkaData == data
+}
 
-	return false
+// validateSize checks that the votes or validator bit arrays of msg fit the
+// committee voting at height. Only the committees of the current and the
+// previous heights are known, msgs of other heights aren't checked.
+func (c *Core) validateSize(msg interface{ ValidateSize(int) error }, height int64) error {
+	valSet := c.validators.ValidatorSet(height)
+	if valSet == nil {
+		return nil
+	}
+	return msg.ValidateSize(valSet.Size())
 }
 
+// isValidator returns true if we vote, i.e. we're in the committee and not
+// an observer
 func (c *Core) isValidator() bool {
-	self := c.validators.GetSelfPubKey()
-	return c.validators.CustomValidators.IsValidator(self)
+	if c.observer {
+		return false
+	}
+	return c.validators.Current().Has(c.validators.GetSelfPubKey())
 }
 
 func (c *Core) enterPropose(height int64, round int) {
@@ -439,6 +784,11 @@ func (c *Core) enterPropose(height int64, round int) {
 	}
 	c.log.Info(fmt.Sprintf("enterPropose(%v/%v). Current: %v/%v/%v", height, round, c.Height, c.Round, c.Step))
 
+	if c.isSoleValidator() && !c.replayMode {
+		c.commitAlone(height, round)
+		return
+	}
+
 	defer func() {
 		// Done enterPropose:
 		c.updateRoundStep(round, RoundStepPropose)
@@ -452,11 +802,12 @@ func (c *Core) enterPropose(height int64, round int) {
 	}()
 
 	// If we don't get the proposal quick enough, enterPrevote
-	c.scheduleTimeout(c.cfg.Propose(round), height, round, RoundStepPropose)
+	c.scheduleTimeout(c.timeoutPropose(round), height, round, RoundStepPropose)
+	c.startLatency(latencyPropose)
 
 	self := c.validators.GetSelfPubKey()
 	// Nothing more to do if we're not a validator
-	if !c.validators.CustomValidators.IsValidator(self) {
+	if !c.isValidator() {
 		c.log.Debug("This node is not a validator")
 		return
 	}
@@ -471,38 +822,132 @@ func (c *Core) enterPropose(height int64, round int) {
 }
 
 func (c *Core) doPropose(height int64, round int) {
-	data := c.validators.CustomValidators.DecidesProposal()
-	proposal := message.NewVote(message.ProposalType, height, round, &data, &c.lastCommittedData)
+	if c.replayMode {
+		// our proposal, if any, is replayed from WAL
+		return
+	}
+	if proposal := c.makeProposal(height, round); c.signAddVote(proposal) {
+		c.Proposal = proposal
+	}
+}
 
-	if c.LockedRound > -1 && c.LockedProposal != nil {
-		proposal.Proposed = c.LockedProposal.Proposed
+func (c *Core) makeProposal(height int64, round int) *message.Vote {
+	var proposal *message.Vote
+	if c.ValidRound > -1 && c.ValidProposal != nil {
+		// re-propose the latest data with a POL so that validators locked
+		// in earlier rounds can unlock
+		proposal = message.NewVote(message.ProposalType, height, round, &c.ValidProposal.Proposed, &c.lastCommittedData)
+		proposal.POLRound = c.ValidRound
+	} else if c.LockedRound > -1 && c.LockedProposal != nil {
+		proposal = message.NewVote(message.ProposalType, height, round, &c.LockedProposal.Proposed, &c.lastCommittedData)
+		proposal.POLRound = c.LockedRound
+	} else {
+		data := c.validators.CustomValidators.DecidesProposal()
+		proposal = message.NewVote(message.ProposalType, height, round, &data, &c.lastCommittedData)
 	}
+	return proposal
+}
+
+// isSoleValidator returns true if we're the only validator of the committee
+func (c *Core) isSoleValidator() bool {
+	return c.validators.Current().Size() == 1 && c.isValidator()
+}
 
-	c.signAddVote(proposal)
+/*
+commitAlone is the fast path of a committee of a single validator, i.e.
+us. There's nobody to wait for or to fetch votes from, so the proposal
+is prevoted, precommitted and committed right away without going
+through any fetch step or waiting for a timeout. The next height starts after
+TimeoutCommit regardless of SkipTimeoutCommit.
+
+Our votes are written to WAL as usual so that a crash in the middle is
+replayed through the regular steps, and broadcast and retransmitted in a
+VoteBatch so that non-validators follow. If anything goes wrong, e.g.
+the application rejects its own proposal, the round goes on through the
+regular steps as well.
+*/
+func (c *Core) commitAlone(height int64, round int) {
+	c.updateRoundStep(round, RoundStepPropose)
+	c.scheduleTimeout(c.timeoutPropose(round), height, round, RoundStepPropose)
+	proposal := c.makeProposal(height, round)
+	if !c.validators.CustomValidators.ValidateProposal(proposal.Proposed) {
+		c.log.Error("commitAlone: invalid proposal ", proposal.Proposed)
+		return
+	}
+	if !c.signVote(proposal) {
+		return
+	}
 	c.Proposal = proposal
+	signed := []*message.Vote{proposal}
+	for _, t := range []message.VoteType{message.PrevoteType, message.PrecommitType} {
+		vote := message.NewVote(t, height, round, &proposal.Proposed, &c.lastCommittedData)
+		if !c.signVote(vote) {
+			break
+		}
+		if _, err := c.Votes.AddVote(vote); err != nil {
+			c.log.Error("failed to add our own vote ", vote, ": ", err)
+			break
+		}
+		signed = append(signed, vote)
+	}
+	for _, vote := range signed {
+		c.retransmitter.track(vote)
+	}
+	c.sendVotes(signed, nil)
+	if len(signed) < 3 {
+		return
+	}
+	c.updateRoundStep(round, RoundStepPrecommit)
+	c.enterCommit(height, round)
 }
 
-func (c *Core) fetchMissingVotes() {
-	var fvr *message.FetchVotesReq
-	var step RoundStepType
+// makeFetchVotesReq returns the FetchVotesReq of the current round, nil if
+// we're not fetching
+func (c *Core) makeFetchVotesReq() *message.FetchVotesReq {
 	if c.Step == RoundStepPrevoteFetch {
-		fvr = c.Votes.Prevotes(c.Round).MakeFetchVotesReq()
-		step = RoundStepPrevoteFetch
+		return c.Votes.Prevotes(c.Round).MakeFetchVotesReq()
 	} else if c.Step == RoundStepPrecommitFetch {
-		fvr = c.Votes.Precommits(c.Round).MakeFetchVotesReq()
-		step = RoundStepPrecommitFetch
-	} else {
+		return c.Votes.Precommits(c.Round).MakeFetchVotesReq()
+	}
+	return nil
+}
+
+func (c *Core) sendFetchVotesReq(fvr *message.FetchVotesReq, p custom.IPeer) {
+	if err := c.validators.Sign(fvr); err != nil {
+		c.log.Error("failed to sign FetchVotesReq: ", err)
 		return
 	}
-	c.validators.Sign(fvr)
+	c.validators.CustomValidators.Send(fvr, p)
+}
+
+func (c *Core) fetchMissingVotes() {
+	fvr := c.makeFetchVotesReq()
+	if fvr == nil || c.replayMode {
+		return
+	}
+	step := c.Step
 	c.log.Debugf("fetchMissingVotes at height %d round %d", c.Height, c.Round)
-	// randomly send the request to one neighbour
-	c.validators.CustomValidators.Send(fvr, nil)
+	// ask the validator known to have most of the missing votes, the next
+	// one is asked if it doesn't answer in time. Randomly send the request
+	// to one neighbour if we know nothing about the others.
+	p := c.peers.fetchTarget(c.Height, c.Round, fvr.Type, fvr.Voters, c.validators.GetSelfPubKey())
+	c.sendFetchVotesReq(fvr, p)
 
 	c.scheduleTimeout(FetchInterval, c.Height, c.Round, step)
 	c.inFetch = true
 }
 
+// fetchPOLVotes requests the prevotes of the POL round of the current
+// proposal
+func (c *Core) fetchPOLVotes() {
+	if c.replayMode {
+		return
+	}
+	fvr := c.Votes.Prevotes(c.Proposal.POLRound).MakeFetchVotesReq()
+	c.log.Debugf("fetch POL votes at height %d round %d", c.Height, c.Proposal.POLRound)
+	c.sendFetchVotesReq(fvr, nil)
+}
+
 func (c *Core) enterPrevote(height int64, round int) {
 	if c.Height != height || round < c.Round || (c.Round == round && RoundStepPrevote <= c.Step) {
 		c.log.Debug(fmt.Sprintf("enterPrevote(%v/%v): Invalid args. Current step: %v/%v/%v", height, round, c.Height, c.Round, c.Step))
@@ -523,24 +968,132 @@ func (c *Core) enterPrevote(height int64, round int) {
 func (c *Core) enterPrevoteFetch(height int64, round int) {
 	c.log.Info(fmt.Sprintf("enterPrevoteFetch(%v/%v). Current: %v/%v/%v", height, round, c.Height, c.Round, c.Step))
 	c.updateRoundStep(round, RoundStepPrevoteFetch)
+	c.broadcastRoundStep()
 	c.scheduleTimeout(FetchInterval, height, round, RoundStepPrevoteFetch)
 }
 
 func (c *Core) enterPrecommitFetch(height int64, round int) {
 	c.log.Info(fmt.Sprintf("enterPrecommitFetch(%v/%v). Current: %v/%v/%v", height, round, c.Height, c.Round, c.Step))
 	c.updateRoundStep(round, RoundStepPrecommitFetch)
+	c.broadcastRoundStep()
 	c.scheduleTimeout(FetchInterval, height, round, RoundStepPrecommitFetch)
 }
 
-// sign the vote, publish on internalMsgQueue and broadcast
-func (c *Core) signAddVote(vote *message.Vote) {
+// sign the vote, publish on internalMsgQueue and broadcast. It returns true
+// if the vote is signed.
+func (c *Core) signAddVote(vote *message.Vote) bool {
+	if !c.signVote(vote) {
+		return false
+	}
+	c.sendInternalMessage(msgInfo{vote, nil})
+	c.validators.CustomValidators.BroadCast(vote)
+	c.retransmitter.track(vote)
+	return true
+}
+
+// signVote signs the vote and writes it to WAL. It returns true if the vote
+// is signed.
+func (c *Core) signVote(vote *message.Vote) bool {
 	// if we're not a validator, do nothing
 	if !c.isValidator() { // TODO: cache
+		return false
+	}
+	// votes we signed before the crash are replayed from WAL
+	if c.replayMode {
+		return false
+	}
+	// don't vote for a height the others have committed already
+	if c.blockSync.isBehind(c.Height) {
+		return false
+	}
+	vote.ValSet = c.validators.Current().Hash()
+	if err := c.validators.Sign(vote); err != nil {
+		c.log.Error("refuse to sign ", vote, ": ", err)
+		return false
+	}
+	// the vote must hit the disk before anyone else sees it, or we might
+	// forget it after a crash and sign a conflicting one
+	if err := c.wal.WriteSync(msgInfo{vote, nil}); err != nil {
+		c.log.Error("failed to write vote to WAL, not broadcasting it: ", err)
+		return false
+	}
+	return true
+}
+
+// retransmit broadcasts our latest votes of the current height again
+func (c *Core) retransmit() {
+	c.Lock()
+	votes := c.retransmitter.due()
+	c.Unlock()
+
+	for _, vote := range votes {
+		c.log.Debug("retransmit ", vote)
+	}
+	c.sendVotes(votes, nil)
+}
+
+// sendVotes sends votes to p, or broadcasts them if p is nil, in as few
+// messages as possible. More than one vote go in a VoteBatch.
+func (c *Core) sendVotes(votes []*message.Vote, p custom.IPeer) {
+	for len(votes) > 0 {
+		n := len(votes)
+		if n > message.MaxVoteBatchSize {
+			n = message.MaxVoteBatchSize
+		}
+		var msg message.ConsensusMessage = votes[0]
+		if n > 1 {
+			batch := message.NewVoteBatch(votes[:n])
+			if err := c.validators.Sign(batch); err != nil {
+				c.log.Error("failed to sign VoteBatch: ", err)
+				return
+			}
+			msg = batch
+		}
+		if p == nil {
+			c.validators.CustomValidators.BroadCast(msg)
+		} else {
+			c.validators.CustomValidators.Send(msg, p)
+		}
+		votes = votes[n:]
+	}
+}
+
+// pushVotes sends a validator the votes of the current round it lacks
+// according to its NewRoundStep if Config.RelayVotes is set
+func (c *Core) pushVotes(msg *message.NewRoundStep, p custom.IPeer) {
+	if !c.cfg.RelayVotes || c.replayMode || !c.isValidator() ||
+		msg.Height != c.Height || msg.Round > c.Round {
 		return
 	}
-	c.validators.Sign(vote)
-	c.sendInternalMessage(msgInfo{vote, nil})
-	c.validators.CustomValidators.BroadCast(vote)
+	// it has none of the votes of our round if it's in an older one
+	var prevotes, precommits *common.BitArray
+	if msg.Round == c.Round {
+		prevotes, precommits = msg.Prevotes, msg.Precommits
+	}
+	votes := c.Votes.Prevotes(c.Round).MissingVotes(prevotes)
+	votes = append(votes, c.Votes.Precommits(c.Round).MissingVotes(precommits)...)
+	// NewRoundStep doesn't tell whether it has the proposal, which it can't
+	// do without if it lost it along with the votes
+	if c.Proposal != nil && c.Proposal.Round == c.Round &&
+		(len(votes) > 0 || RoundStepType(msg.Step) < RoundStepPrevote) {
+		votes = append([]*message.Vote{c.Proposal}, votes...)
+	}
+	c.sendVotes(votes, p)
+}
+
+// handleVoteBatch adds the votes of msg as if they're received one by one
+func (c *Core) handleVoteBatch(msg *message.VoteBatch) {
+	if err := msg.ValidateBasic(); err != nil {
+		c.log.Error(err)
+		return
+	}
+	if !c.validators.VerifySignature(msg) {
+		c.log.Error("invalid VoteBatch signature from ", msg.Sender)
+		return
+	}
+	for _, vote := range msg.Votes {
+		c.tryAddVote(vote)
+	}
 }
 
 func (c *Core) sendInternalMessage(mi msgInfo) {
@@ -570,7 +1123,7 @@ func (c *Core) doPrevote(height int64, round int) {
 		return
 	}
 
-	if c.LockedRound >= 0 && c.LockedProposal != nil {
+	if c.LockedRound >= 0 && c.LockedProposal != nil && !c.canUnlock() {
 		c.log.Info("enterPrevote: vote for POLed proposal: ", c.LockedProposal.Proposed)
 		prevote = message.NewVote(message.PrevoteType, c.Height, c.Round, &c.LockedProposal.Proposed, &c.lastCommittedData)
 	} else if c.Proposal != nil &&
@@ -584,6 +1137,14 @@ func (c *Core) doPrevote(height int64, round int) {
 	c.signAddVote(prevote)
 }
 
+// canUnlock returns true if the current proposal comes with a POL newer
+// than our lock, so we can prevote for it even though we're locked on
+// something else
+func (c *Core) canUnlock() bool {
+	return c.Proposal != nil && c.Proposal.POLRound > c.LockedRound &&
+		c.hasPOL(c.Proposal.POLRound, c.Proposal.Proposed)
+}
+
 func (c *Core) enterPrevoteWait(height int64, round int) {
 	if c.Height != height || round < c.Round || (c.Round == round && RoundStepPrevoteWait <= c.Step) {
 		c.log.Debug(fmt.Sprintf("enterPrevoteWait(%v/%v): Invalid args. Current step: %v/%v/%v", height, round, c.Height, c.Round, c.Step))
@@ -600,7 +1161,7 @@ func (c *Core) enterPrevoteWait(height int64, round int) {
 	}()
 
 	// Wait for some more prevotes; enterPrecommit
-	c.scheduleTimeout(c.cfg.Prevote(round), height, round, RoundStepPrevoteWait)
+	c.scheduleTimeout(c.timeoutPrevote(round), height, round, RoundStepPrevoteWait)
 }
 
 func (c *Core) enterPrecommit(height int64, round int) {
@@ -707,7 +1268,7 @@ func (c *Core) enterPrecommitWait(height int64, round int) {
 	}()
 
 	// Wait for some more precommits; enterNewRound
-	c.scheduleTimeout(c.cfg.Precommit(round), height, round, RoundStepPrecommitWait)
+	c.scheduleTimeout(c.timeoutPrecommit(round), height, round, RoundStepPrecommitWait)
 }
 
 func (c *Core) enterCommit(height int64, commitRound int) {
@@ -737,19 +1298,44 @@ func (c *Core) doCommit(data message.ProposedData) {
 		common.PanicSanity("doCommit() inconsistent committed data")
 	}
 
-	// sign the Commit msg anyway as users might want to store it as an evidence
 	records.CommitTime = c.CommitTime
-	c.validators.Sign(records)
+	// the Commit of a non-validator is only for its own application
+	if c.isValidator() {
+		// sign the Commit msg anyway as users might want to store it as an evidence
+		if err := c.validators.Sign(records); err != nil {
+			c.log.Error("failed to sign Commit: ", err)
+		}
 
-	if !c.hasRecvCommitRecords {
-		c.validators.CustomValidators.BroadCast(records)
+		if !c.replayMode {
+			c.validators.CustomValidators.BroadCast(records)
+		}
+	}
+
+	c.finalizeCommit(records)
+
+	// we might have the Commits of the following heights already
+	c.applySyncedCommits()
+}
+
+// finalizeCommit hands records to the application, moves on to the next
+// height and schedules its round 0
+func (c *Core) finalizeCommit(records *message.Commit) {
+	// mark the end of this height before the app commits it. If we crash
+	// before the app state is updated, the height is replayed and committed again
+	if err := c.wal.WriteSync(endHeightMessage{c.Height}); err != nil {
+		c.log.Error("failed to write end height to WAL: ", err)
 	}
 
 	c.validators.CustomValidators.Commit(records)
+	c.validators.committed(c.Height, c.cfg.ValidatorUpdateDelay)
 
 	appState := c.validators.CustomValidators.GetAppState()
 	c.updateToAppState(appState)
-	c.hasRecvCommitRecords = false
+
+	// nothing before this height is needed anymore
+	if err := c.wal.Rotate(c.Height - 1); err != nil {
+		c.log.Error("failed to rotate WAL: ", err)
+	}
 
 	// c.StartTime is already set.
 	// Schedule Round0 to start soon.
@@ -763,10 +1349,22 @@ func (c *Core) tryAddVote(vote *message.Vote) (bool, error) {
 		// If the vote height is off, we'll just ignore it,
 		// But if it's a conflicting sig, add it to the c.evpool.
 		// If it's otherwise invalid, punish peer.
-		if err == ErrVoteHeightMismatch {
+		if err == ErrVoteHeightMismatch || err == ErrVoteWrongValSet {
+			// might be signed around a committee change by a validator
+			// at another height
+			return added, err
+		} else if conflict, ok := err.(*ErrVoteConflictingVotes); ok {
+			c.log.Warnf("conflicting votes from %v: %v and %v",
+				conflict.PubKey, conflict.VoteA, conflict.VoteB)
+			// sign it as the reporter so that others know who detected it
+			if signErr := c.validators.Sign(conflict.DuplicateVoteEvidence); signErr != nil {
+				c.log.Error("failed to sign DuplicateVoteEvidence: ", signErr)
+			} else {
+				c.addEvidence(conflict.DuplicateVoteEvidence)
+			}
 			return added, err
-		} else if _, ok := err.(*ErrVoteConflictingVotes); ok {
-			// TODO: catch conflict votes
+		} else if err == ErrVoteUnwantedRound {
+			c.reportMisbehaviour(vote.Address, err)
 			return added, err
 		} else {
 			// Probably an invalid signature / Bad peer.
@@ -778,6 +1376,37 @@ func (c *Core) tryAddVote(vote *message.Vote) (bool, error) {
 	return added, nil
 }
 
+// reportMisbehaviour reports offender to misbehaviourCallback unless it's
+// been reported at this height
+func (c *Core) reportMisbehaviour(offender message.PubKey, err error) {
+	if c.offenders[offender] {
+		return
+	}
+	c.offenders[offender] = true
+	c.log.Warnf("validator %v misbehaves at height %d: %v", offender, c.Height, err)
+	if c.misbehaviourCallback != nil && !c.replayMode {
+		go c.misbehaviourCallback(offender, err)
+	}
+}
+
+// addEvidence adds ev to the evidence pool. New evidence is gossiped and
+// reported to the application.
+func (c *Core) addEvidence(ev message.Evidence) {
+	added, err := c.evpool.AddEvidence(ev)
+	if err != nil {
+		c.log.Warn("invalid evidence ", ev, " err ", err)
+		return
+	}
+	if !added {
+		return
+	}
+	c.log.Warn("new evidence of misbehaviour ", ev)
+	if !c.replayMode {
+		c.validators.CustomValidators.BroadCast(ev)
+	}
+	c.validators.CustomValidators.ReportEvidence(ev)
+}
+
 func (c *Core) addVote(vote *message.Vote) (added bool, err error) {
 	c.log.Debug("addVote ", " voteHeight ", vote.Height, " voteType ", vote.Type, " cHeight ", c.Height)
 
@@ -806,23 +1435,10 @@ func (c *Core) addVote(vote *message.Vote) (added bool, err error) {
 		return
 	}
 
-	/* height catch up is deprecated now
-	if vote.Height > c.Height {
-		// If this validator never committed before, it's almost certainly that
-		// it just started and fell far behind the rest. Let it collect votes
-		// from higher height so that it can catch up
-		if c.LastCommit == nil || vote.Height < c.Height+128 {
-			if vote.Type != message.ProposalType {
-				c.stateSync.AddVote(vote)
-			}
-			return
-		}
-	}
-	*/
-
 	if vote.Height != c.Height {
 		// Height mismatch is ignored.
 		// Not necessarily a bad peer, but not favourable behaviour.
+		// A validator that fell behind catches up with Commits, see blockSync
 		err = ErrVoteHeightMismatch
 		c.log.Info("Vote ignored and not added", " voteHeight ", vote.Height, " cHeight ", c.Height, " err ", err)
 		return
@@ -834,7 +1450,6 @@ func (c *Core) addVote(vote *message.Vote) (added bool, err error) {
 		return
 	}
 
-	// TODO: add watermark for round
 	height := c.Height
 	added, err = c.Votes.AddVote(vote)
 	if !added {
@@ -876,6 +1491,24 @@ func (c *Core) addVote(vote *message.Vote) (added bool, err error) {
 					// TODO: we might receive this proposal again from other validators
 				}
 			}
+
+			// Update the valid value if the polka is for the current
+			// proposal, either in this round or in the round it claims
+			if polkaData != message.NilData && c.ValidRound < vote.Round && c.Proposal != nil &&
+				c.Proposal.Proposed == polkaData &&
+				(vote.Round == c.Round || vote.Round == c.Proposal.POLRound) {
+				c.log.Info("Updating ValidProposal because of POL.", " validRound ", c.ValidRound, " POLRound ", vote.Round)
+				c.ValidRound = vote.Round
+				c.ValidProposal = c.Proposal
+			}
+		}
+
+		if c.Round == vote.Round && prevotes.HasTwoThirdsAny() {
+			// what TimeoutPrevote waits for after +2/3 any
+			c.startLatency(latencyPrevote)
+			if _, ok := prevotes.TwoThirdsMajority(); ok {
+				c.observeLatency(latencyPrevote, vote.Round)
+			}
 		}
 
 		// If +2/3 prevotes for *anything* for future round:
@@ -890,17 +1523,24 @@ func (c *Core) addVote(vote *message.Vote) (added bool, err error) {
 				c.enterPrevoteWait(height, vote.Round)
 			}
 		} else if RoundStepPrevote > c.Step {
-			// If the proposal is received, enter prevote of c.Round.
-			if c.Proposal != nil {
+			// If the proposal (and its POL if needed) is received, enter prevote of c.Round.
+			if c.isReadyToPrevote() {
 				c.enterPrevote(height, c.Round)
 			} else {
-				c.log.Debugf("receive prevote for ProposedData (%v), but we don't have proposal", vote.Proposed)
+				c.log.Debugf("receive prevote for ProposedData (%v), but we're not ready to prevote", vote.Proposed)
 			}
 		}
 
 	case message.PrecommitType:
 		precommits := c.Votes.Precommits(vote.Round)
 		c.log.Debug("Added to precommit", " vote ", vote, " precommits ", precommits.String())
+		if c.Round == vote.Round && precommits.HasTwoThirdsAny() {
+			// what TimeoutPrecommit waits for after +2/3 any
+			c.startLatency(latencyPrecommit)
+			if precommits.HasTwoThirdsMajority() {
+				c.observeLatency(latencyPrecommit, vote.Round)
+			}
+		}
 
 		if precommits.HasTwoThirdsMajority() {
 			// Executed as TwoThirdsMajority could be from a higher round
@@ -927,7 +1567,7 @@ func (c *Core) defaultSetProposal(proposal *message.Vote) error {
 	if c.Proposal != nil {
 		//c.log.Debugf("Already got proposal %v from %s, get another proposal %v from %s",
 		//	c.Proposal.Proposed, c.Proposal.Address, proposal.Proposed, proposal.Address)
-		return nil
+		return c.checkProposerEquivocation(proposal)
 	}
 
 	// Does not apply
@@ -941,6 +1581,12 @@ func (c *Core) defaultSetProposal(proposal *message.Vote) error {
 		return nil
 	}
 
+	valSet := c.validators.Current()
+	if proposal.ValSet != valSet.Hash() {
+		c.log.Warn("proposal of another validator set ", proposal)
+		return ErrVoteWrongValSet
+	}
+
 	// check if proposal is from the current proposer
 	if c.validators.CustomValidators.GetCurrentProposer(c.Round) != proposal.Address {
 		c.log.Errorf("invalid proposer. want %v, got %v",
@@ -948,8 +1594,14 @@ func (c *Core) defaultSetProposal(proposal *message.Vote) error {
 		return ErrInvalidProposer
 	}
 
+	// The POL must be from an earlier round
+	if proposal.POLRound < -1 || proposal.POLRound >= proposal.Round {
+		c.log.Errorf("invalid POLRound %d in proposal %v", proposal.POLRound, proposal)
+		return ErrInvalidProposalPOLRound
+	}
+
 	// Verify signature
-	if !c.validators.VerifySignature(proposal) {
+	if !valSet.VerifySignature(proposal) {
 		c.log.Error("invalid sig ", proposal)
 		return ErrInvalidProposalSignature
 	}
@@ -958,7 +1610,15 @@ func (c *Core) defaultSetProposal(proposal *message.Vote) error {
 	if c.validators.CustomValidators.ValidateProposal(proposal.Proposed) {
 		c.Proposal = proposal
 		c.log.Debug("Accept proposal", " proposal ", proposal)
-		c.enterPrevote(c.Height, c.Round)
+		if proposal.Address != c.validators.GetSelfPubKey() {
+			c.observeLatency(latencyPropose, proposal.Round)
+		}
+		if c.isReadyToPrevote() {
+			c.enterPrevote(c.Height, c.Round)
+		} else {
+			// we're locked on something else, wait for the POL until timeoutPropose
+			c.fetchPOLVotes()
+		}
 	} else {
 		c.log.Warnf("invalid proposal, want %v got %v",
 			c.validators.CustomValidators.DecidesProposal(), proposal.Proposed)
@@ -966,6 +1626,31 @@ func (c *Core) defaultSetProposal(proposal *message.Vote) error {
 	return nil
 }
 
+// checkProposerEquivocation reports the proposer if proposal is signed by the
+// same proposer for the same height/round as c.Proposal but proposes
+// something different
+func (c *Core) checkProposerEquivocation(proposal *message.Vote) error {
+	if proposal.Height != c.Proposal.Height || proposal.Round != c.Proposal.Round ||
+		proposal.Address != c.Proposal.Address || proposal.Proposed == c.Proposal.Proposed {
+		return nil
+	}
+
+	// don't let anyone frame the proposer
+	if !c.validators.VerifySignature(proposal) {
+		c.log.Error("invalid sig ", proposal)
+		return ErrInvalidProposalSignature
+	}
+
+	ev := message.NewProposerEquivocationEvidence(c.Proposal, proposal)
+	c.log.Warnf("proposer %v equivocates: %v and %v", proposal.Address, c.Proposal, proposal)
+	if err := c.validators.Sign(ev); err != nil {
+		c.log.Error("failed to sign ProposerEquivocationEvidence: ", err)
+		return nil
+	}
+	c.addEvidence(ev)
+	return nil
+}
+
 // Attempt to schedule a timeout (by sending timeoutInfo on the tickChan)
 func (c *Core) scheduleTimeout(duration time.Duration, height int64, round int, step RoundStepType) {
 	c.log.Debugf("++++++scheduleTimeout (%v/%d/%d/%v)", duration, height, round, step)
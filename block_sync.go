@@ -0,0 +1,276 @@
+package gobft
+
+import (
+	"time"
+
+	"github.com/coschain/gobft/common"
+	"github.com/coschain/gobft/custom"
+	"github.com/coschain/gobft/message"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxCommitsPerFetch is the max number of Commits asked for or served
+	// in one FetchCommitsReq
+	maxCommitsPerFetch = 32
+
+	// maxPendingCommits is how far above the current height Commits are
+	// kept while the heights in between are being fetched
+	maxPendingCommits = 128
+)
+
+/*
+blockSync brings a validator that fell behind back to the head of the
+network.
+
+Once another validator is known to be at a higher height, from its
+NewRoundStep or FetchVotesReq, the Commits of the heights in between are
+requested from it. A FetchVotesReq of a height we've committed is
+answered with its Commit as well. Each Commit is verified against the
+committee and applied through ICommittee.Commit in order, Commits
+received ahead of time are kept until the heights before them are
+applied.
+
+Commits of later heights signed under another validator set than ours
+are kept unverified, the committee of their height is only known once
+we get there. They're verified before they're applied.
+
+A validator doesn't sign any vote while it holds a verified Commit of a
+height it hasn't reached yet, i.e. it only rejoins live voting once it's
+caught up. Claims of other validators alone don't stop it from voting.
+
+FetchCommitsReqs are only served to validators of the current height, at
+most once every FetchInterval per validator unless it asks for heights
+after the ones it got last time, so that FetchCommitsReqs can't be used to
+flood us or others with Commits.
+It's only used in receiveRoutine.
+*/
+type blockSync struct {
+	pending map[int64]*syncedCommit
+
+	fetchFrom int64
+	fetchTime time.Time
+
+	served map[message.PubKey]servedFetch
+}
+
+// servedFetch is the last FetchCommitsReq of a validator we served
+type servedFetch struct {
+	to   int64
+	time time.Time
+}
+
+// syncedCommit is a Commit along with its precommits, which are nil until
+// it's verified
+type syncedCommit struct {
+	commit     *message.Commit
+	precommits *VoteSet
+}
+
+func newBlockSync() *blockSync {
+	return &blockSync{
+		pending: make(map[int64]*syncedCommit),
+		served:  make(map[message.PubKey]servedFetch),
+	}
+}
+
+// isBehind returns true if we have a verified Commit of height or above,
+// i.e. height is known to be committed already
+func (bs *blockSync) isBehind(height int64) bool {
+	for h, sc := range bs.pending {
+		if h >= height && sc.precommits != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// add keeps sc until its height is reached. An unverified Commit doesn't
+// replace a verified one.
+func (bs *blockSync) add(sc *syncedCommit) {
+	height := sc.commit.Height()
+	if old, ok := bs.pending[height]; ok && old.precommits != nil && sc.precommits == nil {
+		return
+	}
+	bs.pending[height] = sc
+}
+
+// pop removes and returns the Commit of height, nil if we don't have it.
+// Commits below height are dropped.
+func (bs *blockSync) pop(height int64) *syncedCommit {
+	for h := range bs.pending {
+		if h < height {
+			delete(bs.pending, h)
+		}
+	}
+	sc := bs.pending[height]
+	delete(bs.pending, height)
+	return sc
+}
+
+// shouldFetch returns true if it's time to request the Commits from height.
+// A request is sent again if it's not answered within FetchInterval.
+func (bs *blockSync) shouldFetch(height int64, now time.Time) bool {
+	return bs.fetchFrom != height || now.Sub(bs.fetchTime) >= FetchInterval
+}
+
+// fetched records that the Commits from height are requested
+func (bs *blockSync) fetched(height int64, now time.Time) {
+	bs.fetchFrom = height
+	bs.fetchTime = now
+}
+
+// shouldServe returns true if the Commits from..to can be sent to key, and
+// records they're sent if so
+func (bs *blockSync) shouldServe(key message.PubKey, from, to int64, now time.Time) bool {
+	if last, ok := bs.served[key]; ok && from <= last.to && now.Sub(last.time) < FetchInterval {
+		return false
+	}
+	bs.served[key] = servedFetch{to, now}
+	return true
+}
+
+// checkBehind requests the Commits we miss from the validator at the highest
+// height if it's ahead of us
+func (c *Core) checkBehind() {
+	if c.replayMode {
+		return
+	}
+	prs := c.peers.highest(c.validators.GetSelfPubKey())
+	if prs == nil || prs.Height <= c.Height || !c.blockSync.shouldFetch(c.Height, time.Now()) {
+		return
+	}
+	to := prs.Height - 1
+	if to >= c.Height+maxCommitsPerFetch {
+		to = c.Height + maxCommitsPerFetch - 1
+	}
+	fcr := &message.FetchCommitsReq{
+		From: c.Height,
+		To:   to,
+		Time: time.Now(),
+	}
+	if err := c.validators.Sign(fcr); err != nil {
+		c.log.Error("failed to sign FetchCommitsReq: ", err)
+		return
+	}
+	c.log.Infof("we're at height %d while others are at %d, fetching commits %d~%d",
+		c.Height, prs.Height, fcr.From, fcr.To)
+	c.blockSync.fetched(fcr.From, fcr.Time)
+	c.validators.CustomValidators.Send(fcr, prs.Peer)
+}
+
+// handleFetchCommits sends the Commits we have of the requested heights. They
+// aren't votes so they don't go in a VoteBatch, and each of them already
+// carries the +2/3 precommits of its height in one message.
+func (c *Core) handleFetchCommits(msg *message.FetchCommitsReq, p custom.IPeer) {
+	c.log.Debug("handle FetchCommitsReq: ", msg)
+	if err := msg.ValidateBasic(); err != nil {
+		c.log.Error(err)
+		return
+	}
+	if !c.validators.VerifySignature(msg) {
+		c.log.Error("invalid FetchCommitsReq signature from ", msg.Invoker)
+		return
+	}
+	to := msg.To
+	if to >= msg.From+maxCommitsPerFetch {
+		to = msg.From + maxCommitsPerFetch - 1
+	}
+	if to >= c.Height {
+		to = c.Height - 1
+	}
+	if to < msg.From || !c.blockSync.shouldServe(msg.Invoker, msg.From, to, time.Now()) {
+		return
+	}
+	for h := msg.From; h <= to; h++ {
+		commit := c.validators.CustomValidators.GetCommitHistory(h)
+		if commit == nil {
+			c.log.Errorf("failed to get history commit of height %d", h)
+			return
+		}
+		c.validators.CustomValidators.Send(commit, p)
+	}
+}
+
+// verifyCommit checks that commit carries +2/3 precommits of the committee
+// for commit.ProposedData, or a CommitCertificate of them, and returns them. Commits of later heights are
+// verified against the current committee.
+func (c *Core) verifyCommit(commit *message.Commit) (*VoteSet, error) {
+	if commit.Height() < 1 {
+		return nil, errors.New("invalid commit height")
+	}
+	valSet := c.validators.ValidatorSet(commit.Height())
+	if valSet == nil {
+		valSet = c.validators.Current()
+	}
+	if commit.ValSet != valSet.Hash() {
+		return nil, ErrCommitWrongValSet
+	}
+	if commit.Certificate != nil {
+		if err := valSet.verifyCertificate(commit); err != nil {
+			return nil, err
+		}
+		return newCertifiedVoteSet(commit, valSet), nil
+	}
+	precommits := NewVoteSet(commit.Height(), commit.Round(), message.PrecommitType, valSet, &commit.Prev)
+	for _, vote := range commit.Precommits {
+		if vote == nil {
+			continue
+		}
+		if _, err := precommits.AddVote(vote); err != nil {
+			return nil, err
+		}
+	}
+	if maj23, ok := precommits.TwoThirdsMajority(); !ok || maj23 != commit.ProposedData {
+		return nil, ErrCommitNoMajority
+	}
+	return precommits, nil
+}
+
+// addSyncCommit verifies commit and applies it, along with the Commits of
+// the following heights we have, if it's the one of the current height.
+// Otherwise it's kept until we get there.
+func (c *Core) addSyncCommit(commit *message.Commit) {
+	height := commit.Height()
+	if height < c.Height || height >= c.Height+maxPendingCommits {
+		c.log.Debugf("commit of height %d ignored at height %d", height, c.Height)
+		return
+	}
+	precommits, err := c.verifyCommit(commit)
+	if err == ErrCommitWrongValSet && height > c.Height {
+		// the committee changes before height
+		c.blockSync.add(&syncedCommit{commit, nil})
+		return
+	}
+	if err != nil {
+		c.log.Error("invalid commit ", commit, ": ", err)
+		return
+	}
+	c.blockSync.add(&syncedCommit{commit, precommits})
+	c.applySyncedCommits()
+}
+
+// applySyncedCommits applies the verified Commits from the current height
+// on until one is missing
+func (c *Core) applySyncedCommits() {
+	for sc := c.blockSync.pop(c.Height); sc != nil; sc = c.blockSync.pop(c.Height) {
+		if sc.commit.Prev != c.lastCommittedData {
+			c.log.Error("commit with invalid base ", sc.commit)
+			return
+		}
+		if sc.precommits == nil {
+			precommits, err := c.verifyCommit(sc.commit)
+			if err != nil {
+				c.log.Error("invalid commit ", sc.commit, ": ", err)
+				return
+			}
+			sc.precommits = precommits
+		}
+		c.log.Infof("catch up height %d with %v", c.Height, sc.commit)
+		// the votes of this height don't matter anymore
+		c.CommitRound = -1
+		c.CommitTime = common.Now()
+		c.finalizeCommit(sc.commit)
+		c.LastCommit = sc.precommits
+	}
+}
@@ -0,0 +1,135 @@
+package gobft
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBlockSync shows that a validator that misses a few heights catches up
+// with the Commits of others and then votes again.
+func TestBlockSync(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	const D = 3
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 4, []message.ProposedData{x, x, x, x})
+	online := false
+	maxHeight := int64(3)
+	syncing := false
+	votedAt := make(map[int64]bool)
+	net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+		if _, ok := msg.(*message.Commit); ok && to == D && online {
+			syncing = true
+		}
+		if vote, ok := msg.(*message.Vote); ok && from == D && syncing {
+			votedAt[vote.Height] = true
+		}
+		if vote, ok := msg.(*message.Vote); ok && vote.Height > maxHeight {
+			return false
+		}
+		return online || from != D && to != D
+	}
+	committed := func(height int, nodes ...*testNode) func() bool {
+		return func() bool {
+			for _, node := range nodes {
+				if len(node.commits) < height {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	// D is gone while the others commit 3 heights
+	net.start()
+	net.runUntil(committed(3, net.nodes[:D]...), 100)
+	assert.Len(net.nodes[D].commits, 0)
+
+	// a commit without +2/3 precommits is not applied
+	forged := *net.nodes[0].commits[0]
+	forged.Precommits = forged.Precommits[:2]
+	net.nodes[D].core.handleMsg(msgInfo{&forged, testPeer(0)})
+	assert.Len(net.nodes[D].commits, 0)
+	_, err := net.nodes[D].core.verifyCommit(&forged)
+	assert.Equal(ErrCommitNoMajority, err)
+
+	// D is back and learns the others are ahead. It fetches their Commits
+	// but doesn't vote until it's caught up
+	online = true
+	net.runUntil(committed(3, net.nodes[D]), 100)
+	assert.Equal(int64(4), net.nodes[D].core.Height)
+	assert.True(syncing)
+	for h := int64(1); h <= 3; h++ {
+		assert.False(votedAt[h], "D voted at height %d", h)
+	}
+	for h := 0; h < 3; h++ {
+		assert.Equal(net.nodes[0].commits[h].ProposedData, net.nodes[D].commits[h].ProposedData)
+		assert.Equal(net.nodes[0].commits[h].Height(), net.nodes[D].commits[h].Height())
+	}
+
+	// then everyone commits the next height with D
+	maxHeight = 4
+	net.runUntil(committed(4, net.nodes...), 100)
+	assert.True(votedAt[4])
+	for _, node := range net.nodes[:D] {
+		assert.Equal(net.nodes[D].commits[3].ProposedData, node.commits[3].ProposedData)
+	}
+}
+
+// Commits are only sent to validators, and not again to the same one until
+// FetchInterval passes unless it asks for later heights
+func TestFetchCommitsLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 4, []message.ProposedData{x, x, x, x})
+	maxHeight := int64(4)
+	net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+		vote, ok := msg.(*message.Vote)
+		return !ok || vote.Height <= maxHeight
+	}
+	net.start()
+	net.runUntil(func() bool { return len(net.nodes[0].commits) >= 4 }, 100)
+
+	fetch := func(from, to int64, signer int) int {
+		fcr := &message.FetchCommitsReq{From: from, To: to, Time: time.Now()}
+		assert.Nil(net.nodes[signer].core.validators.Sign(fcr))
+		net.queue = nil
+		net.nodes[0].core.handleMsg(msgInfo{fcr, testPeer(signer)})
+		sent := 0
+		for _, m := range net.queue {
+			if _, ok := m.msg.(*message.Commit); ok && m.to == signer {
+				sent++
+			}
+		}
+		return sent
+	}
+	assert.Equal(2, fetch(1, 2, 3))
+	// asked again too soon
+	assert.Equal(0, fetch(1, 2, 3))
+	assert.Equal(0, fetch(2, 3, 3))
+	// the next heights, or another validator
+	assert.Equal(2, fetch(3, 4, 3))
+	assert.Equal(2, fetch(1, 2, 2))
+	interval := FetchInterval
+	FetchInterval = 0
+	defer func() { FetchInterval = interval }()
+	assert.Equal(2, fetch(1, 2, 3))
+
+	// not from a validator
+	fcr := &message.FetchCommitsReq{From: 1, To: 2, Time: time.Now()}
+	fcr.Invoker = "stranger"
+	fcr.Signature = []byte("sig")
+	net.queue = nil
+	net.nodes[0].core.handleMsg(msgInfo{fcr, testPeer(3)})
+	assert.Len(net.queue, 0)
+}
@@ -0,0 +1,192 @@
+// Package bls implements custom.IAggregator with BLS signatures on the
+// BLS12-381 curve, in the proof of possession scheme of
+// draft-irtf-cfrg-bls-signature: public keys are in G1 (48 bytes compressed),
+// signatures in G2 (96 bytes compressed) and signatures of the same digest
+// aggregate into one that is verified with a single pairing check.
+package bls
+
+import (
+	"errors"
+	"io"
+
+	"github.com/cloudflare/circl/ecc/bls12381"
+	"github.com/coschain/gobft/custom"
+)
+
+const (
+	// PublicKeySize is the size of a compressed public key
+	PublicKeySize = bls12381.G1SizeCompressed
+	// SignatureSize is the size of a compressed signature
+	SignatureSize = bls12381.G2SizeCompressed
+
+	// dstSig and dstPoP are the domain separation tags of the ciphersuites
+	// of signatures and proofs of possession
+	dstSig = "BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_"
+	dstPoP = "BLS_POP_BLS12381G2_XMD:SHA-256_SSWU_RO_POP_"
+)
+
+var (
+	ErrInvalidPrivateKey = errors.New("Invalid BLS private key")
+	ErrInvalidPublicKey  = errors.New("Invalid BLS public key")
+	ErrInvalidSignature  = errors.New("Invalid BLS signature")
+	ErrInvalidPoP        = errors.New("Invalid BLS proof of possession")
+	ErrNoSignature       = errors.New("No BLS signature to aggregate")
+)
+
+// PrivateKey is a BLS private key
+type PrivateKey struct {
+	sk  bls12381.Scalar
+	pub []byte
+}
+
+// GenerateKey generates a private key from the randomness of rand, e.g.
+// crypto/rand.Reader
+func GenerateKey(rand io.Reader) (*PrivateKey, error) {
+	k := &PrivateKey{}
+	for k.sk.IsZero() == 1 {
+		if err := k.sk.Random(rand); err != nil {
+			return nil, err
+		}
+	}
+	k.setPublicKey()
+	return k, nil
+}
+
+// UnmarshalPrivateKey decodes a private key of MarshalBinary
+func UnmarshalPrivateKey(b []byte) (*PrivateKey, error) {
+	k := &PrivateKey{}
+	if err := k.sk.UnmarshalBinary(b); err != nil || k.sk.IsZero() == 1 {
+		return nil, ErrInvalidPrivateKey
+	}
+	k.setPublicKey()
+	return k, nil
+}
+
+func (k *PrivateKey) setPublicKey() {
+	pub := &bls12381.G1{}
+	pub.ScalarMult(&k.sk, bls12381.G1Generator())
+	k.pub = pub.BytesCompressed()
+}
+
+// MarshalBinary encodes the private key in 32 bytes
+func (k *PrivateKey) MarshalBinary() ([]byte, error) {
+	return k.sk.MarshalBinary()
+}
+
+// PublicKey returns the compressed public key
+func (k *PrivateKey) PublicKey() []byte {
+	return append([]byte(nil), k.pub...)
+}
+
+// Sign signs msg. Signatures of the same msg can be aggregated.
+func (k *PrivateKey) Sign(msg []byte) []byte {
+	return k.sign(msg, dstSig)
+}
+
+// ProvePossession returns the proof that the owner of the public key knows
+// the private key, see VerifyPossession
+func (k *PrivateKey) ProvePossession() []byte {
+	return k.sign(k.pub, dstPoP)
+}
+
+func (k *PrivateKey) sign(msg []byte, dst string) []byte {
+	sig := &bls12381.G2{}
+	sig.Hash(msg, []byte(dst))
+	sig.ScalarMult(&k.sk, sig)
+	return sig.BytesCompressed()
+}
+
+// VerifyPossession verifies the proof of possession of a public key. Keys
+// have to be verified before they're aggregated, otherwise the owner of a
+// rogue key made of the keys of others could forge their aggregate.
+func VerifyPossession(key, proof []byte) bool {
+	pub, err := publicKey(key)
+	if err != nil {
+		return false
+	}
+	return verify(pub, key, proof, dstPoP)
+}
+
+// publicKey decodes a public key, which must be in G1 and not the identity
+func publicKey(key []byte) (*bls12381.G1, error) {
+	pub := &bls12381.G1{}
+	if len(key) != PublicKeySize || pub.SetBytes(key) != nil || pub.IsIdentity() {
+		return nil, ErrInvalidPublicKey
+	}
+	return pub, nil
+}
+
+func signature(sig []byte) (*bls12381.G2, error) {
+	s := &bls12381.G2{}
+	if len(sig) != SignatureSize || s.SetBytes(sig) != nil {
+		return nil, ErrInvalidSignature
+	}
+	return s, nil
+}
+
+// verify checks e(pub, H(msg)) == e(G1, sig)
+func verify(pub *bls12381.G1, msg, sig []byte, dst string) bool {
+	s, err := signature(sig)
+	if err != nil {
+		return false
+	}
+	h := &bls12381.G2{}
+	h.Hash(msg, []byte(dst))
+	return bls12381.ProdPairFrac(
+		[]*bls12381.G1{pub, bls12381.G1Generator()},
+		[]*bls12381.G2{h, s},
+		[]int{1, -1},
+	).IsIdentity()
+}
+
+// Aggregator is the custom.IAggregator of BLS signatures. The keys are
+// compressed public keys whose possession has been verified.
+type Aggregator struct{}
+
+var _ custom.IAggregator = Aggregator{}
+
+func (Aggregator) Verify(key, digest, signature []byte) bool {
+	pub, err := publicKey(key)
+	if err != nil {
+		return false
+	}
+	return verify(pub, digest, signature, dstSig)
+}
+
+// Aggregate adds up signatures
+func (Aggregator) Aggregate(signatures [][]byte) ([]byte, error) {
+	if len(signatures) == 0 {
+		return nil, ErrNoSignature
+	}
+	agg := &bls12381.G2{}
+	agg.SetIdentity()
+	for _, sig := range signatures {
+		s, err := signature(sig)
+		if err != nil {
+			return nil, err
+		}
+		agg.Add(agg, s)
+	}
+	return agg.BytesCompressed(), nil
+}
+
+// VerifyAggregate verifies that aggSignature aggregates the signatures of
+// digest by each of keys, by verifying it with the sum of the keys
+func (Aggregator) VerifyAggregate(keys [][]byte, digest, aggSignature []byte) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	agg := &bls12381.G1{}
+	agg.SetIdentity()
+	for _, key := range keys {
+		pub, err := publicKey(key)
+		if err != nil {
+			return false
+		}
+		agg.Add(agg, pub)
+	}
+	if agg.IsIdentity() {
+		return false
+	}
+	return verify(agg, digest, aggSignature, dstSig)
+}
@@ -0,0 +1,95 @@
+package bls
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKeys(t *testing.T, n int) []*PrivateKey {
+	keys := make([]*PrivateKey, n)
+	for i := range keys {
+		key, err := GenerateKey(rand.Reader)
+		assert.Nil(t, err)
+		keys[i] = key
+	}
+	return keys
+}
+
+func TestSign(t *testing.T) {
+	assert := assert.New(t)
+
+	keys := newTestKeys(t, 2)
+	digest := sha256.Sum256([]byte("x"))
+	other := sha256.Sum256([]byte("y"))
+	sig := keys[0].Sign(digest[:])
+	assert.Equal(SignatureSize, len(sig))
+	assert.Equal(PublicKeySize, len(keys[0].PublicKey()))
+
+	agg := Aggregator{}
+	assert.True(agg.Verify(keys[0].PublicKey(), digest[:], sig))
+	assert.False(agg.Verify(keys[1].PublicKey(), digest[:], sig))
+	assert.False(agg.Verify(keys[0].PublicKey(), other[:], sig))
+	assert.False(agg.Verify(keys[0].PublicKey(), digest[:], sig[1:]))
+	assert.False(agg.Verify(sig[:PublicKeySize], digest[:], sig))
+
+	bz, err := keys[0].MarshalBinary()
+	assert.Nil(err)
+	decoded, err := UnmarshalPrivateKey(bz)
+	assert.Nil(err)
+	assert.Equal(keys[0].PublicKey(), decoded.PublicKey())
+	_, err = UnmarshalPrivateKey(make([]byte, len(bz)))
+	assert.Equal(ErrInvalidPrivateKey, err)
+}
+
+func TestAggregate(t *testing.T) {
+	assert := assert.New(t)
+
+	keys := newTestKeys(t, 4)
+	digest := sha256.Sum256([]byte("x"))
+	var pubs, sigs [][]byte
+	for _, key := range keys {
+		pubs = append(pubs, key.PublicKey())
+		sigs = append(sigs, key.Sign(digest[:]))
+	}
+
+	agg := Aggregator{}
+	aggSig, err := agg.Aggregate(sigs[:3])
+	assert.Nil(err)
+	assert.Equal(SignatureSize, len(aggSig))
+	assert.True(agg.VerifyAggregate(pubs[:3], digest[:], aggSig))
+	// not the same signers
+	assert.False(agg.VerifyAggregate(pubs[1:], digest[:], aggSig))
+	assert.False(agg.VerifyAggregate(pubs[:2], digest[:], aggSig))
+	assert.False(agg.VerifyAggregate(nil, digest[:], aggSig))
+	other := sha256.Sum256([]byte("y"))
+	assert.False(agg.VerifyAggregate(pubs[:3], other[:], aggSig))
+
+	_, err = agg.Aggregate(nil)
+	assert.Equal(ErrNoSignature, err)
+	_, err = agg.Aggregate([][]byte{sigs[0], pubs[0]})
+	assert.Equal(ErrInvalidSignature, err)
+}
+
+func TestPossession(t *testing.T) {
+	assert := assert.New(t)
+
+	keys := newTestKeys(t, 2)
+	proof := keys[0].ProvePossession()
+	assert.True(VerifyPossession(keys[0].PublicKey(), proof))
+	assert.False(VerifyPossession(keys[1].PublicKey(), proof))
+	// a proof of possession isn't a signature of the key
+	assert.False(VerifyPossession(keys[0].PublicKey(), keys[0].Sign(keys[0].PublicKey())))
+
+	val, err := NewPubValidator(keys[0].PublicKey(), proof, 5)
+	assert.Nil(err)
+	assert.Equal(PubKey(keys[0].PublicKey()), val.GetPubKey())
+	assert.Equal(NewPrivValidator(keys[0]).GetPubKey(), val.GetPubKey())
+	assert.Equal(int64(5), val.GetVotingPower())
+	_, err = NewPubValidator(keys[1].PublicKey(), proof, 5)
+	assert.Equal(ErrInvalidPoP, err)
+	_, err = NewPubValidator(proof[:PublicKeySize], proof, 5)
+	assert.Equal(ErrInvalidPublicKey, err)
+}
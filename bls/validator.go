@@ -0,0 +1,78 @@
+package bls
+
+import (
+	"encoding/hex"
+	"sync/atomic"
+
+	"github.com/coschain/gobft/custom"
+	"github.com/coschain/gobft/message"
+)
+
+// PubKey returns the message.PubKey of a BLS public key, its hex encoding
+func PubKey(key []byte) message.PubKey {
+	return message.PubKey(hex.EncodeToString(key))
+}
+
+// PrivValidator is a custom.IAggPrivValidator that signs both the messages
+// and the aggregation digests of its precommits with the same BLS key
+type PrivValidator struct {
+	key *PrivateKey
+}
+
+var _ custom.IAggPrivValidator = (*PrivValidator)(nil)
+
+func NewPrivValidator(key *PrivateKey) *PrivValidator {
+	return &PrivValidator{key: key}
+}
+
+func (pv *PrivValidator) GetPubKey() message.PubKey {
+	return PubKey(pv.key.pub)
+}
+
+func (pv *PrivValidator) Sign(digest []byte) []byte {
+	return pv.key.Sign(digest)
+}
+
+func (pv *PrivValidator) AggSign(digest []byte) []byte {
+	return pv.key.Sign(digest)
+}
+
+// PubValidator is the custom.IAggPubValidator of a PrivValidator
+type PubValidator struct {
+	key   []byte
+	power int64
+}
+
+var _ custom.IAggPubValidator = (*PubValidator)(nil)
+
+// NewPubValidator creates the PubValidator of a public key. proof is the
+// proof of possession of the key, see PrivateKey.ProvePossession.
+func NewPubValidator(key, proof []byte, power int64) (*PubValidator, error) {
+	if _, err := publicKey(key); err != nil {
+		return nil, err
+	}
+	if !VerifyPossession(key, proof) {
+		return nil, ErrInvalidPoP
+	}
+	return &PubValidator{key: append([]byte(nil), key...), power: power}, nil
+}
+
+func (v *PubValidator) VerifySig(digest, signature []byte) bool {
+	return Aggregator{}.Verify(v.key, digest, signature)
+}
+
+func (v *PubValidator) GetPubKey() message.PubKey {
+	return PubKey(v.key)
+}
+
+func (v *PubValidator) GetVotingPower() int64 {
+	return atomic.LoadInt64(&v.power)
+}
+
+func (v *PubValidator) SetVotingPower(power int64) {
+	atomic.StoreInt64(&v.power, power)
+}
+
+func (v *PubValidator) GetAggKey() []byte {
+	return v.key
+}
@@ -0,0 +1,152 @@
+package gobft
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/coschain/gobft/bls"
+	"github.com/coschain/gobft/custom"
+	"github.com/coschain/gobft/message"
+	"github.com/stretchr/testify/assert"
+)
+
+// newCertificateTestCores makes a Core for each of n BLS validators of power 1
+// at height 1, which aggregate their precommits
+func newCertificateTestCores(t *testing.T, n int) []*Core {
+	keys := make([]*bls.PrivateKey, n)
+	genesis := make([]custom.IPubValidator, n)
+	for i := range keys {
+		key, err := bls.GenerateKey(rand.Reader)
+		assert.Nil(t, err)
+		keys[i] = key
+		genesis[i], err = bls.NewPubValidator(key.PublicKey(), key.ProvePossession(), 1)
+		assert.Nil(t, err)
+	}
+	committee, err := NewStaticCommittee(genesis, &testApp{}, nil)
+	assert.Nil(t, err)
+	cores := make([]*Core, n)
+	for i := range cores {
+		cores[i] = NewCore(committee, bls.NewPrivValidator(keys[i]))
+		cores[i].validators.SetChainID("gobft-test")
+		cores[i].SetAggregator(bls.Aggregator{})
+		cores[i].validators.updateHeight(1, 2)
+	}
+	return cores
+}
+
+func TestCommitCertificate(t *testing.T) {
+	assert := assert.New(t)
+
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	cores := newCertificateTestCores(t, 4)
+	valSet := cores[3].validators.Current()
+	var precommits []*message.Vote
+	for _, core := range cores {
+		vote := message.NewVote(message.PrecommitType, 1, 0, &x, &message.NilData)
+		vote.ValSet = valSet.Hash()
+		assert.Nil(core.validators.Sign(vote))
+		assert.NotEmpty(vote.AggSignature)
+		assert.Nil(vote.ValidateBasic())
+		precommits = append(precommits, vote)
+	}
+
+	voteSet := NewVoteSet(1, 0, message.PrecommitType, valSet, &message.NilData)
+	for _, vote := range precommits[:3] {
+		added, err := voteSet.AddVote(vote)
+		assert.True(added)
+		assert.Nil(err)
+	}
+	commit := voteSet.MakeCommit()
+	if !assert.NotNil(commit.Certificate) {
+		return
+	}
+	assert.Empty(commit.Precommits)
+	assert.Equal(int64(1), commit.Height())
+	assert.Equal(0, commit.Round())
+	assert.Equal(3, commit.Certificate.Signers.Count())
+	assert.False(commit.Certificate.Signers.GetIndex(3))
+	assert.Nil(cores[0].validators.Sign(commit))
+	assert.Nil(commit.ValidateBasic())
+	assert.Nil(commit.ValidateSize(4))
+	for _, codec := range []message.Codec{message.AminoCodec, message.ProtoCodec} {
+		bz, err := message.EncodeConsensusMsg(commit, codec)
+		assert.Nil(err)
+		decoded, err := message.DecodeConsensusMsg(bz)
+		assert.Nil(err)
+		assert.Equal(commit.Digest(), decoded.Digest())
+		assert.Equal(commit.Certificate, decoded.(*message.Commit).Certificate)
+	}
+
+	// verified in one go, and the certificate is kept as the last commit
+	lastCommit, err := cores[3].verifyCommit(commit)
+	assert.Nil(err)
+	assert.Equal(commit.Certificate, lastCommit.MakeCommit().Certificate)
+	added, err := lastCommit.AddVote(precommits[3])
+	assert.True(added)
+	assert.Nil(err)
+	assert.Equal(commit.Certificate, lastCommit.MakeCommit().Certificate)
+
+	// tampered certificates
+	tampered := *commit
+	cert := *commit.Certificate
+	tampered.Certificate = &cert
+	cert.Signers = commit.Certificate.Signers.Copy()
+	cert.Signers.SetIndex(3, true)
+	_, err = cores[3].verifyCommit(&tampered)
+	assert.Equal(ErrCommitInvalidCertificate, err)
+	cert.Signers.SetIndex(2, false)
+	cert.Signers.SetIndex(3, false)
+	_, err = cores[3].verifyCommit(&tampered)
+	assert.Equal(ErrCommitNoMajority, err)
+	cert.Signers = commit.Certificate.Signers
+	cert.Round = 1
+	_, err = cores[3].verifyCommit(&tampered)
+	assert.Equal(ErrCommitInvalidCertificate, err)
+
+	// nodes without an aggregator can't verify it
+	cores[3].SetAggregator(nil)
+	_, err = cores[3].verifyCommit(commit)
+	assert.Equal(ErrCommitNoAggregator, err)
+}
+
+// An invalid AggSignature isn't aggregated, the Commit carries the precommits
+// until a copy with a valid one comes
+func TestCommitCertificateFallback(t *testing.T) {
+	assert := assert.New(t)
+
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	cores := newCertificateTestCores(t, 4)
+	valSet := cores[3].validators.Current()
+	var precommits []*message.Vote
+	for _, core := range cores[:3] {
+		vote := message.NewVote(message.PrecommitType, 1, 0, &x, &message.NilData)
+		vote.ValSet = valSet.Hash()
+		assert.Nil(core.validators.Sign(vote))
+		precommits = append(precommits, vote)
+	}
+	forged := precommits[2].Copy()
+	forged.AggSignature = precommits[1].AggSignature
+
+	voteSet := NewVoteSet(1, 0, message.PrecommitType, valSet, &message.NilData)
+	for _, vote := range []*message.Vote{precommits[0], precommits[1], forged} {
+		added, err := voteSet.AddVote(vote)
+		assert.True(added)
+		assert.Nil(err)
+	}
+	commit := voteSet.MakeCommit()
+	assert.Nil(commit.Certificate)
+	assert.Equal(3, len(commit.Precommits))
+
+	added, _ := voteSet.AddVote(precommits[2])
+	assert.False(added)
+	commit = voteSet.MakeCommit()
+	assert.NotNil(commit.Certificate)
+	assert.Empty(commit.Precommits)
+
+	// nil precommits aren't signed for aggregation
+	vote := message.NewVote(message.PrecommitType, 1, 1, &message.NilData, &message.NilData)
+	vote.ValSet = valSet.Hash()
+	assert.Nil(cores[0].validators.Sign(vote))
+	assert.Empty(vote.AggSignature)
+}
@@ -0,0 +1,164 @@
+package gobft
+
+import (
+	"sync"
+
+	"github.com/coschain/gobft/custom"
+	"github.com/coschain/gobft/message"
+	"github.com/pkg/errors"
+)
+
+/*
+StaticCommittee is an ICommittee of a fixed set of validators given at
+genesis. The proposers rotate by voting power with a ProposerSelector.
+What's up to the application is delegated to an IApplication and the
+messages to an IP2P.
+
+The proposers only depend on the genesis validators and the height, so
+the selector is brought to the height after the last one of
+IApplication.GetAppState when the committee is created and after each
+Commit. If the IApplication is a ProposerStateStore, the ProposerState is
+saved after each Commit and loaded back when the committee is created,
+so that only the heights committed after it was saved are replayed.
+Otherwise the heights before are replayed from genesis.
+
+The voting power of the validators is taken at genesis and they must
+not be changed afterwards.
+*/
+type StaticCommittee struct {
+	custom.IApplication
+	custom.IP2P
+
+	genesis    []custom.IPubValidator
+	list       []message.PubKey
+	validators map[message.PubKey]custom.IPubValidator
+	totalPower int64
+
+	mtx       sync.Mutex
+	proposers *ProposerSelector
+}
+
+// ProposerStateStore can be implemented by the IApplication of a
+// StaticCommittee to persist its ProposerState, e.g. along with the committed
+// data, so that starting doesn't take replaying every height from genesis.
+type ProposerStateStore interface {
+	SaveProposerState(state ProposerState) error
+	// LoadProposerState returns the last state saved, ok=false if there's
+	// none
+	LoadProposerState() (state ProposerState, ok bool)
+}
+
+// NewStaticCommittee creates a StaticCommittee of the genesis validators, in
+// the order of GetValidatorList
+func NewStaticCommittee(genesis []custom.IPubValidator, app custom.IApplication, p2p custom.IP2P) (*StaticCommittee, error) {
+	if len(genesis) == 0 {
+		return nil, ErrCommitteeNoValidator
+	}
+	sc := &StaticCommittee{
+		IApplication: app,
+		IP2P:         p2p,
+		genesis:      make([]custom.IPubValidator, len(genesis)),
+		list:         make([]message.PubKey, 0, len(genesis)),
+		validators:   make(map[message.PubKey]custom.IPubValidator, len(genesis)),
+	}
+	copy(sc.genesis, genesis)
+	for _, val := range genesis {
+		pk := val.GetPubKey()
+		if _, ok := sc.validators[pk]; ok {
+			return nil, errors.Wrapf(ErrCommitteeDuplicated, "%s", pk)
+		}
+		power := val.GetVotingPower()
+		if power <= 0 {
+			return nil, errors.Wrapf(ErrCommitteeInvalidPower, "%s has %d", pk, power)
+		}
+		sc.list = append(sc.list, pk)
+		sc.validators[pk] = val
+		sc.totalPower += power
+	}
+	if err := sc.syncProposers(); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+func (sc *StaticCommittee) GetValidatorList() []message.PubKey {
+	list := make([]message.PubKey, len(sc.list))
+	copy(list, sc.list)
+	return list
+}
+
+func (sc *StaticCommittee) GetValidator(key message.PubKey) custom.IPubValidator {
+	return sc.validators[key]
+}
+
+func (sc *StaticCommittee) IsValidator(key message.PubKey) bool {
+	_, ok := sc.validators[key]
+	return ok
+}
+
+func (sc *StaticCommittee) TotalVotingPower() int64 {
+	return sc.totalPower
+}
+
+func (sc *StaticCommittee) GetValidatorNum() int {
+	return len(sc.list)
+}
+
+// GetCurrentProposer returns the proposer of round at the height after the
+// last committed one
+func (sc *StaticCommittee) GetCurrentProposer(round int) message.PubKey {
+	sc.mtx.Lock()
+	defer sc.mtx.Unlock()
+	return sc.proposers.GetCurrentProposer(round)
+}
+
+// Commit hands commit to the application and moves the proposers to the
+// height it's at afterwards
+func (sc *StaticCommittee) Commit(commit *message.Commit) error {
+	err := sc.IApplication.Commit(commit)
+	sc.mtx.Lock()
+	defer sc.mtx.Unlock()
+	if serr := sc.syncProposers(); serr != nil && err == nil {
+		err = serr
+	}
+	return err
+}
+
+// syncProposers brings the proposers to the height after the last one of the
+// application, starting from the state it saved if any, and saves them.
+// sc.mtx must be held if the committee is in use.
+func (sc *StaticCommittee) syncProposers() error {
+	height := sc.GetAppState().LastHeight + 1
+	store, _ := sc.IApplication.(ProposerStateStore)
+	if sc.proposers == nil || sc.proposers.Height() > height {
+		sc.proposers = nil
+		if store != nil {
+			if state, ok := store.LoadProposerState(); ok && state.Height <= height {
+				ps, err := LoadProposerSelector(state)
+				if err != nil {
+					return err
+				}
+				sc.proposers = ps
+			}
+		}
+		if sc.proposers == nil {
+			ps, err := NewProposerSelector(1, sc.genesis)
+			if err != nil {
+				return err
+			}
+			sc.proposers = ps
+		}
+	}
+	if sc.proposers.Height() == height {
+		return nil
+	}
+	for h := sc.proposers.Height(); h < height; h++ {
+		if err := sc.proposers.Advance(h, nil); err != nil {
+			return err
+		}
+	}
+	if store != nil {
+		return store.SaveProposerState(sc.proposers.State())
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package gobft
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/coschain/gobft/custom"
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// testApp is an IApplication that only counts the heights committed
+type testApp struct {
+	height    int64
+	commitErr error
+}
+
+func (app *testApp) DecidesProposal() message.ProposedData { return message.NilData }
+
+func (app *testApp) ValidateProposal(data message.ProposedData) bool { return true }
+
+func (app *testApp) Commit(commit *message.Commit) error {
+	if app.commitErr != nil {
+		return app.commitErr
+	}
+	app.height++
+	return nil
+}
+
+func (app *testApp) GetAppState() *message.AppState {
+	return &message.AppState{LastHeight: app.height, LastProposedData: message.NilData}
+}
+
+func (app *testApp) GetCommitHistory(height int64) *message.Commit { return nil }
+
+func (app *testApp) ReportEvidence(ev message.Evidence) {}
+
+func TestStaticCommittee(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	keys := []message.PubKey{"C", "A", "B"}
+	genesis := newProposerTestValidators(ctrl, keys, []int64{1, 2, 3})
+	app := &testApp{}
+	var sc custom.ICommittee
+	sc, err := NewStaticCommittee(genesis, app, nil)
+	assert.Nil(err)
+	assert.Equal(keys, sc.GetValidatorList())
+	assert.Equal(3, sc.GetValidatorNum())
+	assert.Equal(int64(6), sc.TotalVotingPower())
+	assert.True(sc.IsValidator("A"))
+	assert.False(sc.IsValidator("D"))
+	assert.Equal(int64(3), sc.GetValidator("B").GetVotingPower())
+	assert.Nil(sc.GetValidator("D"))
+
+	// the proposers are the ones of a ProposerSelector over the genesis
+	// validators
+	ps, err := NewProposerSelector(1, genesis)
+	assert.Nil(err)
+	for h := int64(1); h <= 20; h++ {
+		for r := 0; r < 3; r++ {
+			assert.Equal(ps.GetCurrentProposer(r), sc.GetCurrentProposer(r))
+		}
+		assert.Nil(sc.Commit(&message.Commit{}))
+		assert.Nil(ps.Advance(h, nil))
+	}
+
+	// a failed Commit doesn't move the proposers
+	app.commitErr = errors.New("failed")
+	proposer := sc.GetCurrentProposer(0)
+	assert.Equal(app.commitErr, sc.Commit(&message.Commit{}))
+	assert.Equal(proposer, sc.GetCurrentProposer(0))
+	app.commitErr = nil
+
+	// a committee created after a restart picks up from the application
+	restarted, err := NewStaticCommittee(genesis, &testApp{height: app.height}, nil)
+	assert.Nil(err)
+	for r := 0; r < 3; r++ {
+		assert.Equal(sc.GetCurrentProposer(r), restarted.GetCurrentProposer(r))
+	}
+
+	// so does one whose application goes back to an earlier height
+	first, err := NewProposerSelector(1, genesis)
+	assert.Nil(err)
+	app.height = 0
+	assert.Nil(sc.Commit(&message.Commit{}))
+	assert.Nil(first.Advance(1, nil))
+	assert.Equal(first.GetCurrentProposer(0), sc.GetCurrentProposer(0))
+
+	_, err = NewStaticCommittee(nil, app, nil)
+	assert.Equal(ErrCommitteeNoValidator, err)
+	_, err = NewStaticCommittee(newProposerTestValidators(ctrl, []message.PubKey{"A", "A"}, []int64{1, 1}), app, nil)
+	assert.NotNil(err)
+	_, err = NewStaticCommittee(newProposerTestValidators(ctrl, []message.PubKey{"A", "B"}, []int64{1, 0}), app, nil)
+	assert.NotNil(err)
+}
+
+// testStoreApp is a testApp that persists the ProposerState
+type testStoreApp struct {
+	testApp
+	state *ProposerState
+}
+
+func (app *testStoreApp) SaveProposerState(state ProposerState) error {
+	app.state = &state
+	return nil
+}
+
+func (app *testStoreApp) LoadProposerState() (ProposerState, bool) {
+	if app.state == nil {
+		return ProposerState{}, false
+	}
+	return *app.state, true
+}
+
+func TestStaticCommitteeProposerStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	genesis := newProposerTestValidators(ctrl, []message.PubKey{"A", "B", "C"}, []int64{1, 2, 3})
+	app := &testStoreApp{}
+	sc, err := NewStaticCommittee(genesis, app, nil)
+	assert.Nil(err)
+	for i := 0; i < 5; i++ {
+		assert.Nil(sc.Commit(&message.Commit{}))
+	}
+	if assert.NotNil(app.state) {
+		assert.Equal(int64(6), app.state.Height)
+		assert.Equal(sc.proposers.State(), *app.state)
+	}
+
+	// a restarted committee starts from the saved state rather than from
+	// genesis, even if it's not what replaying would get to
+	saved := ProposerState{Height: 1000, Validators: []ProposerPriority{
+		{PubKey: "A", Power: 1, Priority: 5},
+		{PubKey: "B", Power: 2, Priority: -2},
+		{PubKey: "C", Power: 3, Priority: -3},
+	}}
+	expected, err := LoadProposerSelector(saved)
+	assert.Nil(err)
+	restarted, err := NewStaticCommittee(genesis, &testStoreApp{testApp{height: 999}, &saved}, nil)
+	assert.Nil(err)
+	for r := 0; r < 3; r++ {
+		assert.Equal(expected.GetCurrentProposer(r), restarted.GetCurrentProposer(r))
+	}
+
+	// and only replays the heights committed after it was saved
+	store := &testStoreApp{testApp{height: 1000}, &saved}
+	restarted, err = NewStaticCommittee(genesis, store, nil)
+	assert.Nil(err)
+	assert.Nil(expected.Advance(1000, nil))
+	for r := 0; r < 3; r++ {
+		assert.Equal(expected.GetCurrentProposer(r), restarted.GetCurrentProposer(r))
+	}
+	assert.Equal(int64(1001), store.state.Height)
+}
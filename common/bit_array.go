@@ -0,0 +1,139 @@
+package common
+
+import (
+	"errors"
+	"strings"
+)
+
+// BitArray is a fixed size array of bits, indexed from 0. It's not thread safe.
+type BitArray struct {
+	Bits  int    `json:"bits"`
+	Elems []byte `json:"elems"`
+}
+
+// NewBitArray returns a BitArray of bits bits, all unset
+func NewBitArray(bits int) *BitArray {
+	if bits < 0 {
+		bits = 0
+	}
+	return &BitArray{
+		Bits:  bits,
+		Elems: make([]byte, (bits+7)/8),
+	}
+}
+
+// Size returns the number of bits. A nil BitArray has none.
+func (ba *BitArray) Size() int {
+	if ba == nil {
+		return 0
+	}
+	return ba.Bits
+}
+
+// GetIndex returns false if i is out of range
+func (ba *BitArray) GetIndex(i int) bool {
+	if ba == nil || i < 0 || i >= ba.Bits {
+		return false
+	}
+	return ba.Elems[i/8]&(1<<uint(i%8)) != 0
+}
+
+// SetIndex returns false if i is out of range
+func (ba *BitArray) SetIndex(i int, v bool) bool {
+	if ba == nil || i < 0 || i >= ba.Bits {
+		return false
+	}
+	if v {
+		ba.Elems[i/8] |= 1 << uint(i%8)
+	} else {
+		ba.Elems[i/8] &^= 1 << uint(i%8)
+	}
+	return true
+}
+
+// Count returns the number of bits set
+func (ba *BitArray) Count() int {
+	if ba == nil {
+		return 0
+	}
+	n := 0
+	for _, e := range ba.Elems {
+		for ; e != 0; e &= e - 1 {
+			n++
+		}
+	}
+	return n
+}
+
+// Sub returns the bits set in ba but not in o. The result has the size of ba.
+func (ba *BitArray) Sub(o *BitArray) *BitArray {
+	if ba == nil {
+		return nil
+	}
+	ret := ba.Copy()
+	if o == nil {
+		return ret
+	}
+	for i := 0; i < len(ret.Elems) && i < len(o.Elems); i++ {
+		ret.Elems[i] &^= o.Elems[i]
+	}
+	return ret
+}
+
+func (ba *BitArray) Copy() *BitArray {
+	if ba == nil {
+		return nil
+	}
+	elems := make([]byte, len(ba.Elems))
+	copy(elems, ba.Elems)
+	return &BitArray{
+		Bits:  ba.Bits,
+		Elems: elems,
+	}
+}
+
+// ValidateBasic checks that Elems holds exactly Bits bits
+func (ba *BitArray) ValidateBasic() error {
+	if ba == nil {
+		return nil
+	}
+	if ba.Bits < 0 {
+		return errors.New("Negative bit array size")
+	}
+	if len(ba.Elems) != (ba.Bits+7)/8 {
+		return errors.New("Bit array size mismatch")
+	}
+	if r := ba.Bits % 8; r != 0 && ba.Elems[len(ba.Elems)-1]>>uint(r) != 0 {
+		return errors.New("Bit array has bits set out of range")
+	}
+	return nil
+}
+
+// Bytes returns the size followed by the bits, as it's used in digests
+func (ba *BitArray) Bytes() []byte {
+	if ba == nil {
+		return []byte{0, 0, 0, 0}
+	}
+	ret := make([]byte, 4, 4+len(ba.Elems))
+	ret[0] = byte(ba.Bits >> 24)
+	ret[1] = byte(ba.Bits >> 16)
+	ret[2] = byte(ba.Bits >> 8)
+	ret[3] = byte(ba.Bits)
+	return append(ret, ba.Elems...)
+}
+
+// String returns something like "x_x_" where x is a bit set
+func (ba *BitArray) String() string {
+	if ba == nil {
+		return "nil-BitArray"
+	}
+	var sb strings.Builder
+	for i := 0; i < ba.Bits; i++ {
+		if ba.GetIndex(i) {
+			sb.WriteByte('x')
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
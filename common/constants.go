@@ -1,3 +1,7 @@
 package common
 
+// ValNum is the size of the committee gobft used to assume.
+//
+// Deprecated: messages are validated against the validator set of their
+// height, ValNum isn't used anymore.
 const ValNum = 21
@@ -9,6 +9,10 @@ import (
 var FetchInterval  = time.Second
 
 type Config struct {
+	// ChainID is signed along with every message so that its signature is
+	// only valid on this chain. It must be the same for all the validators
+	ChainID string `mapstructure:"chain_id"`
+
 	TimeoutPropose        time.Duration `mapstructure:"timeout_propose"`
 	TimeoutProposeDelta   time.Duration `mapstructure:"timeout_propose_delta"`
 	TimeoutPrevote        time.Duration `mapstructure:"timeout_prevote"`
@@ -19,6 +23,50 @@ type Config struct {
 
 	// Make progress as soon as we have all the precommits (as if TimeoutCommit = 0)
 	SkipTimeoutCommit bool `mapstructure:"skip_timeout_commit"`
+
+	// WalDir is where the write ahead log is kept. WAL is disabled if it's empty
+	WalDir string `mapstructure:"wal_dir"`
+
+	// SignStateFile is where the last signed height/round/step is kept to
+	// prevent double signing across restarts. It's kept in memory only if empty
+	SignStateFile string `mapstructure:"sign_state_file"`
+
+	// MaxEvidenceAge is the number of heights evidence of misbehaviour is kept
+	// and accepted. 0 means evidence never expires
+	MaxEvidenceAge int64 `mapstructure:"max_evidence_age"`
+
+	// HaltRounds is the number of rounds a height can go without a commit
+	// before a HaltReport is made. It's made again every HaltRounds rounds.
+	// 0 disables it
+	HaltRounds int `mapstructure:"halt_rounds"`
+
+	// RetransmitInterval is how long to wait before broadcasting our latest
+	// votes of the current height again. It doubles after each retransmission
+	// up to RetransmitMaxInterval. 0 disables retransmission
+	RetransmitInterval    time.Duration `mapstructure:"retransmit_interval"`
+	RetransmitMaxInterval time.Duration `mapstructure:"retransmit_max_interval"`
+
+	// RelayVotes pushes the votes of the current round to the validators whose
+	// NewRoundStep shows they lack them, in VoteBatches. A validator in an
+	// older round catches up at once and lost votes are made up for without
+	// fetching, at the cost of some bandwidth
+	RelayVotes bool `mapstructure:"relay_votes"`
+
+	// AdaptiveTimeouts derives the propose, prevote and precommit timeouts of
+	// round 0 from how long proposals took to arrive, and +2/3 votes for one
+	// value after +2/3 votes for anything, over the last AdaptiveWindow
+	// heights, bounded by TimeoutMin and TimeoutMax. The
+	// configured timeouts are used until there're enough samples. The deltas
+	// per round are added as usual
+	AdaptiveTimeouts bool          `mapstructure:"adaptive_timeouts"`
+	AdaptiveWindow   int64         `mapstructure:"adaptive_window"`
+	TimeoutMin       time.Duration `mapstructure:"timeout_min"`
+	TimeoutMax       time.Duration `mapstructure:"timeout_max"`
+
+	// ValidatorUpdateDelay is the number of heights after which the
+	// validator updates decided at a height take effect, if ICommittee is an
+	// IValidatorUpdater. It must be the same for all the validators
+	ValidatorUpdateDelay int64 `mapstructure:"validator_update_delay"`
 }
 
 // DefaultConfig returns a default configuration for the consensus service
@@ -32,6 +80,16 @@ func DefaultConfig() *Config {
 		TimeoutPrecommitDelta: 500 * time.Millisecond,
 		TimeoutCommit:         1000 * time.Millisecond,
 		SkipTimeoutCommit:     false,
+		MaxEvidenceAge:        100000,
+		HaltRounds:            10,
+		RetransmitInterval:    1000 * time.Millisecond,
+		RetransmitMaxInterval: 8000 * time.Millisecond,
+		RelayVotes:            false,
+		AdaptiveTimeouts:      false,
+		AdaptiveWindow:        100,
+		TimeoutMin:            200 * time.Millisecond,
+		TimeoutMax:            10000 * time.Millisecond,
+		ValidatorUpdateDelay:  2,
 	}
 }
 
@@ -46,6 +104,10 @@ func TestConfig() *Config {
 	cfg.TimeoutPrecommitDelta = 1 * time.Millisecond
 	cfg.TimeoutCommit = 10 * time.Millisecond
 	cfg.SkipTimeoutCommit = true
+	cfg.RetransmitInterval = 20 * time.Millisecond
+	cfg.RetransmitMaxInterval = 160 * time.Millisecond
+	cfg.TimeoutMin = 5 * time.Millisecond
+	cfg.TimeoutMax = 100 * time.Millisecond
 	return cfg
 }
 
@@ -99,6 +161,32 @@ func (cfg *Config) ValidateBasic() error {
 	if cfg.TimeoutCommit < 0 {
 		return errors.New("timeout_commit can't be negative")
 	}
+	if cfg.MaxEvidenceAge < 0 {
+		return errors.New("max_evidence_age can't be negative")
+	}
+	if cfg.HaltRounds < 0 {
+		return errors.New("halt_rounds can't be negative")
+	}
+	if cfg.RetransmitInterval < 0 {
+		return errors.New("retransmit_interval can't be negative")
+	}
+	if cfg.RetransmitInterval > 0 && cfg.RetransmitMaxInterval < cfg.RetransmitInterval {
+		return errors.New("retransmit_max_interval can't be less than retransmit_interval")
+	}
+	if cfg.ValidatorUpdateDelay < 1 {
+		return errors.New("validator_update_delay must be positive")
+	}
+	if cfg.AdaptiveTimeouts {
+		if cfg.AdaptiveWindow <= 0 {
+			return errors.New("adaptive_window must be positive")
+		}
+		if cfg.TimeoutMin <= 0 {
+			return errors.New("timeout_min must be positive")
+		}
+		if cfg.TimeoutMax < cfg.TimeoutMin {
+			return errors.New("timeout_max can't be less than timeout_min")
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,452 @@
+package gobft
+
+import (
+	"crypto/sha256"
+	"strconv"
+	"testing"
+
+	"github.com/coschain/gobft/custom"
+	"github.com/coschain/gobft/custom/mock"
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// manualTicker is a TimeoutTicker that never fires by itself. It keeps the
+// latest scheduled timeout the same way timeoutTicker does and fires it
+// when the test asks to.
+type manualTicker struct {
+	ti      timeoutInfo
+	pending bool
+}
+
+func (t *manualTicker) Start() error { return nil }
+
+func (t *manualTicker) Stop() error { return nil }
+
+func (t *manualTicker) Chan() <-chan timeoutInfo { return nil }
+
+func (t *manualTicker) ScheduleTimeout(newti timeoutInfo) {
+	ti := t.ti
+	if newti.Height < ti.Height {
+		return
+	} else if newti.Height == ti.Height {
+		if newti.Round < ti.Round {
+			return
+		} else if newti.Round == ti.Round {
+			if ti.Step > 0 && (newti.Step < ti.Step ||
+				newti.Step == ti.Step && newti.Step != RoundStepPrecommitFetch && newti.Step != RoundStepPrevoteFetch) {
+				return
+			}
+		}
+	}
+	t.ti = newti
+	t.pending = true
+}
+
+type testPeer int
+
+func (p testPeer) IPv4() string { return "127.0.0.1" }
+
+func (p testPeer) Port() uint16 { return uint16(p) }
+
+type testMsg struct {
+	from, to int
+	msg      message.ConsensusMessage
+}
+
+type testNode struct {
+	core      *Core
+	committee *mock.MockICommittee
+	ticker    *manualTicker
+	broadcast []message.ConsensusMessage
+	states    []*message.AppState
+	commits   []*message.Commit
+}
+
+func (n *testNode) lastState() *message.AppState {
+	return n.states[len(n.states)-1]
+}
+
+/*
+testNetwork runs a set of Cores in a single goroutine. Messages are routed
+and timeouts are fired by the test so that any scenario, including lost
+messages, can be reproduced deterministically.
+
+Messages sent to a nil peer are delivered to every other node. filter
+decides whether a message is delivered at all. powers are the voting
+powers ICommittee reports, 1 each unless the test changes them.
+*/
+type testNetwork struct {
+	t        *testing.T
+	pubKeys  []message.PubKey
+	pubVals  []*mock.MockIPubValidator
+	powers   []int64
+	nodes    []*testNode
+	queue    []testMsg
+	filter   func(from, to int, msg message.ConsensusMessage) bool
+	proposer func(round int) int
+}
+
+func newTestNetwork(t *testing.T, ctrl *gomock.Controller, n int, proposals []message.ProposedData) *testNetwork {
+	net := &testNetwork{
+		t: t,
+		proposer: func(round int) int {
+			return round % n
+		},
+	}
+	for i := 0; i < n; i++ {
+		k := i
+		pubKey := message.PubKey("val_pubkey" + strconv.Itoa(i))
+		pubVal := mock.NewMockIPubValidator(ctrl)
+		pubVal.EXPECT().GetVotingPower().DoAndReturn(func() int64 {
+			return net.powers[k]
+		}).AnyTimes()
+		pubVal.EXPECT().VerifySig(gomock.Any(), gomock.Any()).Return(true).AnyTimes()
+		pubVal.EXPECT().GetPubKey().Return(pubKey).AnyTimes()
+		net.pubKeys = append(net.pubKeys, pubKey)
+		net.pubVals = append(net.pubVals, pubVal)
+		net.powers = append(net.powers, 1)
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	for j := 0; j < n; j++ {
+		i := j
+		node := &testNode{
+			ticker: &manualTicker{},
+			states: []*message.AppState{{LastHeight: 0, LastProposedData: message.NilData}},
+		}
+
+		privVal := mock.NewMockIPrivValidator(ctrl)
+		privVal.EXPECT().GetPubKey().Return(net.pubKeys[i]).AnyTimes()
+		privVal.EXPECT().Sign(gomock.Any()).DoAndReturn(func(digest []byte) []byte {
+			return digest
+		}).AnyTimes()
+
+		committee := mock.NewMockICommittee(ctrl)
+		committee.EXPECT().GetValidator(gomock.Any()).DoAndReturn(func(key message.PubKey) custom.IPubValidator {
+			for k := range net.pubKeys {
+				if key == net.pubKeys[k] {
+					return net.pubVals[k]
+				}
+			}
+			return nil
+		}).AnyTimes()
+		committee.EXPECT().GetValidatorList().Return(net.pubKeys).AnyTimes()
+		committee.EXPECT().IsValidator(gomock.Any()).Return(true).AnyTimes()
+		committee.EXPECT().TotalVotingPower().Return(int64(n)).AnyTimes()
+		committee.EXPECT().GetValidatorNum().Return(n).AnyTimes()
+		committee.EXPECT().GetCurrentProposer(gomock.Any()).DoAndReturn(func(round int) message.PubKey {
+			return net.pubKeys[net.proposer(round)]
+		}).AnyTimes()
+		committee.EXPECT().DecidesProposal().Return(proposals[i]).AnyTimes()
+		committee.EXPECT().ValidateProposal(gomock.Any()).Return(true).AnyTimes()
+		committee.EXPECT().GetAppState().DoAndReturn(func() *message.AppState {
+			return node.lastState()
+		}).AnyTimes()
+		committee.EXPECT().GetCommitHistory(gomock.Any()).DoAndReturn(func(height int64) *message.Commit {
+			if height < 1 || height > int64(len(node.commits)) {
+				return nil
+			}
+			return node.commits[height-1]
+		}).AnyTimes()
+		committee.EXPECT().Commit(gomock.Any()).DoAndReturn(func(commit *message.Commit) error {
+			node.commits = append(node.commits, commit)
+			node.states = append(node.states, &message.AppState{
+				LastHeight:       commit.Height(),
+				LastProposedData: commit.ProposedData,
+			})
+			return nil
+		}).AnyTimes()
+		committee.EXPECT().ReportEvidence(gomock.Any()).AnyTimes()
+		committee.EXPECT().BroadCast(gomock.Any()).DoAndReturn(func(msg message.ConsensusMessage) error {
+			node.broadcast = append(node.broadcast, msg)
+			net.send(i, nil, msg)
+			return nil
+		}).AnyTimes()
+		committee.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(msg message.ConsensusMessage, p custom.IPeer) error {
+			net.send(i, p, msg)
+			return nil
+		}).AnyTimes()
+		node.committee = committee
+
+		node.core = NewCore(committee, privVal)
+		node.core.SetLogger(logger)
+		node.core.SetName("core" + strconv.Itoa(i))
+		node.core.cfg = TestConfig()
+		node.core.timeoutTicker = node.ticker
+		net.nodes = append(net.nodes, node)
+	}
+	return net
+}
+
+// start does what Core.Start does without starting any goroutine
+func (net *testNetwork) start() {
+	for _, node := range net.nodes {
+		c := node.core
+		c.updateToAppState(node.lastState())
+		c.scheduleRound0(c.GetRoundState())
+	}
+}
+
+func (net *testNetwork) send(from int, p custom.IPeer, msg message.ConsensusMessage) {
+	if p != nil {
+		net.queue = append(net.queue, testMsg{from, int(p.(testPeer)), msg})
+		return
+	}
+	for to := range net.nodes {
+		if to != from {
+			net.queue = append(net.queue, testMsg{from, to, msg})
+		}
+	}
+}
+
+// deliver handles the internal messages of every node and all the messages
+// in flight until there's nothing left
+func (net *testNetwork) deliver() {
+	for {
+		progress := false
+		for _, node := range net.nodes {
+			for drained := false; !drained; {
+				select {
+				case mi := <-node.core.msgQueue:
+					node.core.handleMsg(mi)
+					progress = true
+				default:
+					drained = true
+				}
+			}
+		}
+		if len(net.queue) > 0 {
+			m := net.queue[0]
+			net.queue = net.queue[1:]
+			if msg, ok := net.admit(m); ok {
+				net.nodes[m.to].core.handleMsg(msgInfo{msg, testPeer(m.from)})
+			}
+			progress = true
+		}
+		if !progress {
+			return
+		}
+	}
+}
+
+// admit applies filter to m. The votes of a VoteBatch are filtered one by one
+// as if they're sent alone.
+func (net *testNetwork) admit(m testMsg) (message.ConsensusMessage, bool) {
+	if net.filter == nil {
+		return m.msg, true
+	}
+	if !net.filter(m.from, m.to, m.msg) {
+		return nil, false
+	}
+	batch, ok := m.msg.(*message.VoteBatch)
+	if !ok {
+		return m.msg, true
+	}
+	var votes []*message.Vote
+	for _, vote := range batch.Votes {
+		if net.filter(m.from, m.to, vote) {
+			votes = append(votes, vote)
+		}
+	}
+	if len(votes) == 0 {
+		return nil, false
+	}
+	admitted := *batch
+	admitted.Votes = votes
+	return &admitted, true
+}
+
+// fireTimeouts fires the pending timeout of every node
+func (net *testNetwork) fireTimeouts() {
+	for _, node := range net.nodes {
+		if node.ticker.pending {
+			node.ticker.pending = false
+			node.core.handleTimeout(node.ticker.ti, node.core.RoundState)
+		}
+	}
+}
+
+// runUntil delivers messages and fires timeouts until cond is met. Messages
+// are always faster than timeouts. It fails the test if cond isn't met
+// after maxSteps.
+func (net *testNetwork) runUntil(cond func() bool, maxSteps int) {
+	for i := 0; i < maxSteps; i++ {
+		net.deliver()
+		if cond() {
+			return
+		}
+		net.fireTimeouts()
+		if cond() {
+			return
+		}
+	}
+	net.t.Fatalf("condition not met after %d steps", maxSteps)
+}
+
+// commitPower sums the voting powers of the distinct validators whose
+// precommits for the data of commit it holds
+func (net *testNetwork) commitPower(commit *message.Commit) int64 {
+	var power int64
+	signed := make(map[message.PubKey]bool)
+	for _, vote := range commit.Precommits {
+		if vote.Type != message.PrecommitType || vote.Proposed != commit.ProposedData || signed[vote.Address] {
+			continue
+		}
+		signed[vote.Address] = true
+		for k := range net.pubKeys {
+			if vote.Address == net.pubKeys[k] {
+				power += net.powers[k]
+			}
+		}
+	}
+	return power
+}
+
+// The "system halt and recover" scenario in README. A and B lock on x in
+// round 0 while C and D don't, then C and D lock on y in round 1 thanks to
+// byzantine B whose prevote never reaches A, and B shuts down. A can only
+// unlock if it learns about the POL of y.
+func TestHaltAndRecover(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	const (
+		A = iota
+		B
+		C
+		D
+	)
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	y := message.ProposedData(sha256.Sum256([]byte("y")))
+	net := newTestNetwork(t, ctrl, 4, []message.ProposedData{x, x, y, y})
+	order := []int{A, C, D, B}
+	net.proposer = func(round int) int {
+		return order[round%len(order)]
+	}
+	inRound := func(round int, nodes ...int) func() bool {
+		return func() bool {
+			for _, i := range nodes {
+				if net.nodes[i].core.Round < round {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	// round 0: D misses the proposal, C and D miss A's prevote
+	net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+		switch m := msg.(type) {
+		case *message.Vote:
+			if m.Type == message.ProposalType && to == D {
+				return false
+			}
+			if m.Type == message.PrevoteType && from == A && (to == C || to == D) {
+				return false
+			}
+		case *message.FetchVotesReq, *message.FetchVotesRsp:
+			return false
+		}
+		return true
+	}
+	net.start()
+	net.runUntil(inRound(1, A, B, C, D), 100)
+	for _, i := range []int{A, B} {
+		assert.Equal(0, net.nodes[i].core.LockedRound)
+		assert.Equal(x, net.nodes[i].core.LockedProposal.Proposed)
+	}
+	for _, i := range []int{C, D} {
+		assert.Equal(-1, net.nodes[i].core.LockedRound)
+	}
+
+	// round 1: byzantine B prevotes y, only C and D see it. Then B is gone
+	net.nodes[B].core.setByzantinePrevote(&y)
+	net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+		switch m := msg.(type) {
+		case *message.Vote:
+			if from == B {
+				return m.Type == message.PrevoteType && to != A
+			}
+		case *message.FetchVotesReq, *message.FetchVotesRsp:
+			return false
+		}
+		return from != B
+	}
+	net.runUntil(inRound(2, A, C, D), 100)
+	assert.Equal(0, net.nodes[A].core.LockedRound)
+	assert.Equal(x, net.nodes[A].core.LockedProposal.Proposed)
+	for _, i := range []int{C, D} {
+		assert.Equal(1, net.nodes[i].core.LockedRound)
+		assert.Equal(y, net.nodes[i].core.LockedProposal.Proposed)
+		assert.Equal(1, net.nodes[i].core.ValidRound)
+	}
+
+	// round 2: D re-proposes y with its POL, A fetches the POL and unlocks
+	net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+		return from != B && to != B
+	}
+	committed := func() bool {
+		for _, i := range []int{A, C, D} {
+			if len(net.nodes[i].commits) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	net.runUntil(committed, 100)
+	for _, i := range []int{A, C, D} {
+		assert.Equal(y, net.nodes[i].commits[0].ProposedData)
+		assert.Equal(2, net.nodes[i].commits[0].Round())
+	}
+}
+
+// TestConsensusScale commits 2 heights with committees of various sizes, the
+// largest number of validators tolerated being offline.
+func TestConsensusScale(t *testing.T) {
+	for _, n := range []int{4, 21, 64, 150} {
+		t.Run(strconv.Itoa(n), func(t *testing.T) {
+			if n > 64 && testing.Short() {
+				t.Skip("skipping large committee in short mode")
+			}
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			assert := assert.New(t)
+
+			proposals := make([]message.ProposedData, n)
+			for i := range proposals {
+				proposals[i] = sha256.Sum256([]byte(strconv.Itoa(i)))
+			}
+			net := newTestNetwork(t, ctrl, n, proposals)
+			online := n - (n-1)/3
+			net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+				if vote, ok := msg.(*message.Vote); ok && vote.Height > 2 {
+					return false
+				}
+				return from < online && to < online
+			}
+			committed := func() bool {
+				for _, node := range net.nodes[:online] {
+					if len(node.commits) < 2 {
+						return false
+					}
+				}
+				return true
+			}
+			net.start()
+			net.runUntil(committed, 100)
+			// validator 0 proposes in round 0 of every height
+			for _, node := range net.nodes[:online] {
+				for _, commit := range node.commits[:2] {
+					assert.Equal(proposals[0], commit.ProposedData)
+					assert.Equal(0, commit.Round())
+					assert.True(net.commitPower(commit) > node.committee.TotalVotingPower()*2/3)
+				}
+			}
+		})
+	}
+}
@@ -18,7 +18,9 @@ import (
  */
 
 // ICommittee represents a validator group which contains all validators at
-// a certain height.
+// a certain height. gobft takes a snapshot of the validators when a height
+// starts, i.e. right after Commit of the previous height returns, and counts
+// the votes of the height against it. The validators may change in Commit.
 type ICommittee interface {
 	IP2P
 	GetValidatorList() []message.PubKey
@@ -28,6 +30,15 @@ type ICommittee interface {
 	GetValidatorNum() int
 
 	GetCurrentProposer(round int) message.PubKey
+
+	IApplication
+}
+
+// IApplication is the part of ICommittee that is up to the application, i.e.
+// everything but the validators and the messages. An application with a
+// fixed set of validators only has to implement IApplication and IP2P, see
+// gobft.StaticCommittee.
+type IApplication interface {
 	// DecidesProposal decides what will be proposed if this validator is the current
 	// proposer.
 	DecidesProposal() message.ProposedData
@@ -42,9 +53,51 @@ type ICommittee interface {
 	GetAppState() *message.AppState
 
 	GetCommitHistory(height int64) *message.Commit
+
+	// ReportEvidence is called once for each verified evidence of validator
+	// misbehaviour, e.g. to include it in the next proposal and punish the
+	// offender
+	ReportEvidence(ev message.Evidence)
 }
 
-// IPubValidator verifies if a message is properly signed by the right validator
+// ValidatorUpdate sets the voting power of a validator. A validator that
+// isn't in the committee is added, power 0 removes it
+type ValidatorUpdate struct {
+	PubKey message.PubKey
+	Power  int64
+}
+
+// IValidatorUpdater can be implemented by an ICommittee to let gobft own the
+// changes of its validators. Validators returned by GetValidatorList and
+// GetValidator are then the ones of height 1, and the committee of a later
+// height is worked out by gobft from the updates of the heights before and
+// saved with SaveValidatorSet. GetValidator must also return the validators
+// that are added later so that their signatures can be verified.
+type IValidatorUpdater interface {
+	// ValidatorUpdates returns the changes decided by the data committed at
+	// height. It's called once height is committed, and again when gobft
+	// starts for the heights after the last committee saved and the
+	// ValidatorUpdateDelay heights before it, so it must return the same
+	// changes for the same height.
+	// They take effect ValidatorUpdateDelay heights later if they're valid:
+	// no negative power, no duplicated validator, at least one validator
+	// left and at most 1/3 of the voting power changed. Otherwise they're
+	// discarded as a whole.
+	ValidatorUpdates(height int64) []ValidatorUpdate
+
+	// SaveValidatorSet persists the committee of height, its validators in
+	// order with their voting power, once gobft works it out as the height
+	// starts.
+	SaveValidatorSet(height int64, validators []ValidatorUpdate) error
+	// LoadValidatorSet returns the committee saved for the highest height
+	// not above height, and that height. ok=false if there's none, in which
+	// case the committee is worked out from height 1 on.
+	LoadValidatorSet(height int64) (saved int64, validators []ValidatorUpdate, ok bool)
+}
+
+// IPubValidator verifies if a message is properly signed by the right validator.
+// The digest of a message is message.SignDigest of it on the chain of
+// Config.ChainID.
 type IPubValidator interface {
 	VerifySig(digest, signature []byte) bool
 	GetPubKey() message.PubKey
@@ -58,6 +111,31 @@ type IPrivValidator interface {
 	Sign(digest []byte) []byte
 }
 
+// IAggregator is a signature scheme whose signatures of the same digest can
+// be aggregated into one, e.g. BLS, see package bls. It lets the precommits
+// of a Commit be carried by a message.CommitCertificate.
+// Keys passed to VerifyAggregate must be known to be valid, e.g. by a proof of
+// possession, so that no one can forge an aggregate with a rogue key.
+type IAggregator interface {
+	Verify(key, digest, signature []byte) bool
+	Aggregate(signatures [][]byte) ([]byte, error)
+	VerifyAggregate(keys [][]byte, digest, aggSignature []byte) bool
+}
+
+// IAggPubValidator is an IPubValidator with a key of the IAggregator.
+// Validators that don't implement it are never part of a CommitCertificate.
+type IAggPubValidator interface {
+	IPubValidator
+	GetAggKey() []byte
+}
+
+// IAggPrivValidator is an IPrivValidator that also signs the aggregation
+// digest of its precommits, see message.Vote.AggSignBytes.
+type IAggPrivValidator interface {
+	IPrivValidator
+	AggSign(digest []byte) []byte
+}
+
 type IP2P interface {
 	// BroadCast sends msg to other validators
 	BroadCast(msg message.ConsensusMessage) error
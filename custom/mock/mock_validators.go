@@ -5,36 +5,37 @@
 package mock
 
 import (
-	gomock "github.com/golang/mock/gomock"
+	reflect "reflect"
+
 	custom "github.com/coschain/gobft/custom"
 	message "github.com/coschain/gobft/message"
-	reflect "reflect"
+	gomock "github.com/golang/mock/gomock"
 )
 
-// MockICommittee is a mock of ICommittee interface
+// MockICommittee is a mock of ICommittee interface.
 type MockICommittee struct {
 	ctrl     *gomock.Controller
 	recorder *MockICommitteeMockRecorder
 }
 
-// MockICommitteeMockRecorder is the mock recorder for MockICommittee
+// MockICommitteeMockRecorder is the mock recorder for MockICommittee.
 type MockICommitteeMockRecorder struct {
 	mock *MockICommittee
 }
 
-// NewMockICommittee creates a new mock instance
+// NewMockICommittee creates a new mock instance.
 func NewMockICommittee(ctrl *gomock.Controller) *MockICommittee {
 	mock := &MockICommittee{ctrl: ctrl}
 	mock.recorder = &MockICommitteeMockRecorder{mock}
 	return mock
 }
 
-// EXPECT returns an object that allows the caller to indicate expected use
+// EXPECT returns an object that allows the caller to indicate expected use.
 func (m *MockICommittee) EXPECT() *MockICommitteeMockRecorder {
 	return m.recorder
 }
 
-// BroadCast mocks base method
+// BroadCast mocks base method.
 func (m *MockICommittee) BroadCast(msg message.ConsensusMessage) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "BroadCast", msg)
@@ -42,41 +43,83 @@ func (m *MockICommittee) BroadCast(msg message.ConsensusMessage) error {
 	return ret0
 }
 
-// BroadCast indicates an expected call of BroadCast
+// BroadCast indicates an expected call of BroadCast.
 func (mr *MockICommitteeMockRecorder) BroadCast(msg interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BroadCast", reflect.TypeOf((*MockICommittee)(nil).BroadCast), msg)
 }
 
-// Send mocks base method
-func (m *MockICommittee) Send(msg message.ConsensusMessage, p custom.IPeer) error {
+// Commit mocks base method.
+func (m *MockICommittee) Commit(commitRecords *message.Commit) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Send", msg, p)
+	ret := m.ctrl.Call(m, "Commit", commitRecords)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// Send indicates an expected call of Send
-func (mr *MockICommitteeMockRecorder) Send(msg, p interface{}) *gomock.Call {
+// Commit indicates an expected call of Commit.
+func (mr *MockICommitteeMockRecorder) Commit(commitRecords interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockICommittee)(nil).Send), msg, p)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockICommittee)(nil).Commit), commitRecords)
 }
 
-// GetValidatorList mocks base method
-func (m *MockICommittee) GetValidatorList() []message.PubKey {
+// DecidesProposal mocks base method.
+func (m *MockICommittee) DecidesProposal() message.ProposedData {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetValidatorList")
-	ret0, _ := ret[0].([]message.PubKey)
+	ret := m.ctrl.Call(m, "DecidesProposal")
+	ret0, _ := ret[0].(message.ProposedData)
 	return ret0
 }
 
-// GetValidatorList indicates an expected call of GetValidatorList
-func (mr *MockICommitteeMockRecorder) GetValidatorList() *gomock.Call {
+// DecidesProposal indicates an expected call of DecidesProposal.
+func (mr *MockICommitteeMockRecorder) DecidesProposal() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetValidatorList", reflect.TypeOf((*MockICommittee)(nil).GetValidatorList))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DecidesProposal", reflect.TypeOf((*MockICommittee)(nil).DecidesProposal))
+}
+
+// GetAppState mocks base method.
+func (m *MockICommittee) GetAppState() *message.AppState {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAppState")
+	ret0, _ := ret[0].(*message.AppState)
+	return ret0
+}
+
+// GetAppState indicates an expected call of GetAppState.
+func (mr *MockICommitteeMockRecorder) GetAppState() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAppState", reflect.TypeOf((*MockICommittee)(nil).GetAppState))
+}
+
+// GetCommitHistory mocks base method.
+func (m *MockICommittee) GetCommitHistory(height int64) *message.Commit {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCommitHistory", height)
+	ret0, _ := ret[0].(*message.Commit)
+	return ret0
 }
 
-// GetValidator mocks base method
+// GetCommitHistory indicates an expected call of GetCommitHistory.
+func (mr *MockICommitteeMockRecorder) GetCommitHistory(height interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommitHistory", reflect.TypeOf((*MockICommittee)(nil).GetCommitHistory), height)
+}
+
+// GetCurrentProposer mocks base method.
+func (m *MockICommittee) GetCurrentProposer(round int) message.PubKey {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCurrentProposer", round)
+	ret0, _ := ret[0].(message.PubKey)
+	return ret0
+}
+
+// GetCurrentProposer indicates an expected call of GetCurrentProposer.
+func (mr *MockICommitteeMockRecorder) GetCurrentProposer(round interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCurrentProposer", reflect.TypeOf((*MockICommittee)(nil).GetCurrentProposer), round)
+}
+
+// GetValidator mocks base method.
 func (m *MockICommittee) GetValidator(key message.PubKey) custom.IPubValidator {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetValidator", key)
@@ -84,13 +127,41 @@ func (m *MockICommittee) GetValidator(key message.PubKey) custom.IPubValidator {
 	return ret0
 }
 
-// GetValidator indicates an expected call of GetValidator
+// GetValidator indicates an expected call of GetValidator.
 func (mr *MockICommitteeMockRecorder) GetValidator(key interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetValidator", reflect.TypeOf((*MockICommittee)(nil).GetValidator), key)
 }
 
-// IsValidator mocks base method
+// GetValidatorList mocks base method.
+func (m *MockICommittee) GetValidatorList() []message.PubKey {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetValidatorList")
+	ret0, _ := ret[0].([]message.PubKey)
+	return ret0
+}
+
+// GetValidatorList indicates an expected call of GetValidatorList.
+func (mr *MockICommitteeMockRecorder) GetValidatorList() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetValidatorList", reflect.TypeOf((*MockICommittee)(nil).GetValidatorList))
+}
+
+// GetValidatorNum mocks base method.
+func (m *MockICommittee) GetValidatorNum() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetValidatorNum")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// GetValidatorNum indicates an expected call of GetValidatorNum.
+func (mr *MockICommitteeMockRecorder) GetValidatorNum() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetValidatorNum", reflect.TypeOf((*MockICommittee)(nil).GetValidatorNum))
+}
+
+// IsValidator mocks base method.
 func (m *MockICommittee) IsValidator(key message.PubKey) bool {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "IsValidator", key)
@@ -98,13 +169,39 @@ func (m *MockICommittee) IsValidator(key message.PubKey) bool {
 	return ret0
 }
 
-// IsValidator indicates an expected call of IsValidator
+// IsValidator indicates an expected call of IsValidator.
 func (mr *MockICommitteeMockRecorder) IsValidator(key interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsValidator", reflect.TypeOf((*MockICommittee)(nil).IsValidator), key)
 }
 
-// TotalVotingPower mocks base method
+// ReportEvidence mocks base method.
+func (m *MockICommittee) ReportEvidence(ev message.Evidence) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ReportEvidence", ev)
+}
+
+// ReportEvidence indicates an expected call of ReportEvidence.
+func (mr *MockICommitteeMockRecorder) ReportEvidence(ev interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReportEvidence", reflect.TypeOf((*MockICommittee)(nil).ReportEvidence), ev)
+}
+
+// Send mocks base method.
+func (m *MockICommittee) Send(msg message.ConsensusMessage, p custom.IPeer) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Send", msg, p)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Send indicates an expected call of Send.
+func (mr *MockICommitteeMockRecorder) Send(msg, p interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockICommittee)(nil).Send), msg, p)
+}
+
+// TotalVotingPower mocks base method.
 func (m *MockICommittee) TotalVotingPower() int64 {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "TotalVotingPower")
@@ -112,148 +209,222 @@ func (m *MockICommittee) TotalVotingPower() int64 {
 	return ret0
 }
 
-// TotalVotingPower indicates an expected call of TotalVotingPower
+// TotalVotingPower indicates an expected call of TotalVotingPower.
 func (mr *MockICommitteeMockRecorder) TotalVotingPower() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TotalVotingPower", reflect.TypeOf((*MockICommittee)(nil).TotalVotingPower))
 }
 
-// GetValidatorNum mocks base method
-func (m *MockICommittee) GetValidatorNum() int {
+// ValidateProposal mocks base method.
+func (m *MockICommittee) ValidateProposal(data message.ProposedData) bool {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetValidatorNum")
-	ret0, _ := ret[0].(int)
+	ret := m.ctrl.Call(m, "ValidateProposal", data)
+	ret0, _ := ret[0].(bool)
 	return ret0
 }
 
-// GetValidatorNum indicates an expected call of GetValidatorNum
-func (mr *MockICommitteeMockRecorder) GetValidatorNum() *gomock.Call {
+// ValidateProposal indicates an expected call of ValidateProposal.
+func (mr *MockICommitteeMockRecorder) ValidateProposal(data interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetValidatorNum", reflect.TypeOf((*MockICommittee)(nil).GetValidatorNum))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateProposal", reflect.TypeOf((*MockICommittee)(nil).ValidateProposal), data)
 }
 
-// GetCurrentProposer mocks base method
-func (m *MockICommittee) GetCurrentProposer(round int) message.PubKey {
+// MockIApplication is a mock of IApplication interface.
+type MockIApplication struct {
+	ctrl     *gomock.Controller
+	recorder *MockIApplicationMockRecorder
+}
+
+// MockIApplicationMockRecorder is the mock recorder for MockIApplication.
+type MockIApplicationMockRecorder struct {
+	mock *MockIApplication
+}
+
+// NewMockIApplication creates a new mock instance.
+func NewMockIApplication(ctrl *gomock.Controller) *MockIApplication {
+	mock := &MockIApplication{ctrl: ctrl}
+	mock.recorder = &MockIApplicationMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIApplication) EXPECT() *MockIApplicationMockRecorder {
+	return m.recorder
+}
+
+// Commit mocks base method.
+func (m *MockIApplication) Commit(commitRecords *message.Commit) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCurrentProposer", round)
-	ret0, _ := ret[0].(message.PubKey)
+	ret := m.ctrl.Call(m, "Commit", commitRecords)
+	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// GetCurrentProposer indicates an expected call of GetCurrentProposer
-func (mr *MockICommitteeMockRecorder) GetCurrentProposer(round interface{}) *gomock.Call {
+// Commit indicates an expected call of Commit.
+func (mr *MockIApplicationMockRecorder) Commit(commitRecords interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCurrentProposer", reflect.TypeOf((*MockICommittee)(nil).GetCurrentProposer), round)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockIApplication)(nil).Commit), commitRecords)
 }
 
-// DecidesProposal mocks base method
-func (m *MockICommittee) DecidesProposal() message.ProposedData {
+// DecidesProposal mocks base method.
+func (m *MockIApplication) DecidesProposal() message.ProposedData {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "DecidesProposal")
 	ret0, _ := ret[0].(message.ProposedData)
 	return ret0
 }
 
-// DecidesProposal indicates an expected call of DecidesProposal
-func (mr *MockICommitteeMockRecorder) DecidesProposal() *gomock.Call {
+// DecidesProposal indicates an expected call of DecidesProposal.
+func (mr *MockIApplicationMockRecorder) DecidesProposal() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DecidesProposal", reflect.TypeOf((*MockICommittee)(nil).DecidesProposal))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DecidesProposal", reflect.TypeOf((*MockIApplication)(nil).DecidesProposal))
 }
 
-// ValidateProposal mocks base method
-func (m *MockICommittee) ValidateProposal(data message.ProposedData) bool {
+// GetAppState mocks base method.
+func (m *MockIApplication) GetAppState() *message.AppState {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAppState")
+	ret0, _ := ret[0].(*message.AppState)
+	return ret0
+}
+
+// GetAppState indicates an expected call of GetAppState.
+func (mr *MockIApplicationMockRecorder) GetAppState() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAppState", reflect.TypeOf((*MockIApplication)(nil).GetAppState))
+}
+
+// GetCommitHistory mocks base method.
+func (m *MockIApplication) GetCommitHistory(height int64) *message.Commit {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCommitHistory", height)
+	ret0, _ := ret[0].(*message.Commit)
+	return ret0
+}
+
+// GetCommitHistory indicates an expected call of GetCommitHistory.
+func (mr *MockIApplicationMockRecorder) GetCommitHistory(height interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommitHistory", reflect.TypeOf((*MockIApplication)(nil).GetCommitHistory), height)
+}
+
+// ReportEvidence mocks base method.
+func (m *MockIApplication) ReportEvidence(ev message.Evidence) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ReportEvidence", ev)
+}
+
+// ReportEvidence indicates an expected call of ReportEvidence.
+func (mr *MockIApplicationMockRecorder) ReportEvidence(ev interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReportEvidence", reflect.TypeOf((*MockIApplication)(nil).ReportEvidence), ev)
+}
+
+// ValidateProposal mocks base method.
+func (m *MockIApplication) ValidateProposal(data message.ProposedData) bool {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "ValidateProposal", data)
 	ret0, _ := ret[0].(bool)
 	return ret0
 }
 
-// ValidateProposal indicates an expected call of ValidateProposal
-func (mr *MockICommitteeMockRecorder) ValidateProposal(data interface{}) *gomock.Call {
+// ValidateProposal indicates an expected call of ValidateProposal.
+func (mr *MockIApplicationMockRecorder) ValidateProposal(data interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateProposal", reflect.TypeOf((*MockICommittee)(nil).ValidateProposal), data)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateProposal", reflect.TypeOf((*MockIApplication)(nil).ValidateProposal), data)
 }
 
-// Commit mocks base method
-func (m *MockICommittee) Commit(commitRecords *message.Commit) error {
+// MockIValidatorUpdater is a mock of IValidatorUpdater interface.
+type MockIValidatorUpdater struct {
+	ctrl     *gomock.Controller
+	recorder *MockIValidatorUpdaterMockRecorder
+}
+
+// MockIValidatorUpdaterMockRecorder is the mock recorder for MockIValidatorUpdater.
+type MockIValidatorUpdaterMockRecorder struct {
+	mock *MockIValidatorUpdater
+}
+
+// NewMockIValidatorUpdater creates a new mock instance.
+func NewMockIValidatorUpdater(ctrl *gomock.Controller) *MockIValidatorUpdater {
+	mock := &MockIValidatorUpdater{ctrl: ctrl}
+	mock.recorder = &MockIValidatorUpdaterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIValidatorUpdater) EXPECT() *MockIValidatorUpdaterMockRecorder {
+	return m.recorder
+}
+
+// LoadValidatorSet mocks base method.
+func (m *MockIValidatorUpdater) LoadValidatorSet(height int64) (int64, []custom.ValidatorUpdate, bool) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Commit", commitRecords)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "LoadValidatorSet", height)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].([]custom.ValidatorUpdate)
+	ret2, _ := ret[2].(bool)
+	return ret0, ret1, ret2
 }
 
-// Commit indicates an expected call of Commit
-func (mr *MockICommitteeMockRecorder) Commit(commitRecords interface{}) *gomock.Call {
+// LoadValidatorSet indicates an expected call of LoadValidatorSet.
+func (mr *MockIValidatorUpdaterMockRecorder) LoadValidatorSet(height interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockICommittee)(nil).Commit), commitRecords)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadValidatorSet", reflect.TypeOf((*MockIValidatorUpdater)(nil).LoadValidatorSet), height)
 }
 
-// GetAppState mocks base method
-func (m *MockICommittee) GetAppState() *message.AppState {
+// SaveValidatorSet mocks base method.
+func (m *MockIValidatorUpdater) SaveValidatorSet(height int64, validators []custom.ValidatorUpdate) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAppState")
-	ret0, _ := ret[0].(*message.AppState)
+	ret := m.ctrl.Call(m, "SaveValidatorSet", height, validators)
+	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// GetAppState indicates an expected call of GetAppState
-func (mr *MockICommitteeMockRecorder) GetAppState() *gomock.Call {
+// SaveValidatorSet indicates an expected call of SaveValidatorSet.
+func (mr *MockIValidatorUpdaterMockRecorder) SaveValidatorSet(height, validators interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAppState", reflect.TypeOf((*MockICommittee)(nil).GetAppState))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveValidatorSet", reflect.TypeOf((*MockIValidatorUpdater)(nil).SaveValidatorSet), height, validators)
 }
 
-// GetCommitHistory mocks base method
-func (m *MockICommittee) GetCommitHistory(height int64) *message.Commit {
+// ValidatorUpdates mocks base method.
+func (m *MockIValidatorUpdater) ValidatorUpdates(height int64) []custom.ValidatorUpdate {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCommitHistory", height)
-	ret0, _ := ret[0].(*message.Commit)
+	ret := m.ctrl.Call(m, "ValidatorUpdates", height)
+	ret0, _ := ret[0].([]custom.ValidatorUpdate)
 	return ret0
 }
 
-// GetCommitHistory indicates an expected call of GetCommitHistory
-func (mr *MockICommitteeMockRecorder) GetCommitHistory(height interface{}) *gomock.Call {
+// ValidatorUpdates indicates an expected call of ValidatorUpdates.
+func (mr *MockIValidatorUpdaterMockRecorder) ValidatorUpdates(height interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommitHistory", reflect.TypeOf((*MockICommittee)(nil).GetCommitHistory), height)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidatorUpdates", reflect.TypeOf((*MockIValidatorUpdater)(nil).ValidatorUpdates), height)
 }
 
-// MockIPubValidator is a mock of IPubValidator interface
+// MockIPubValidator is a mock of IPubValidator interface.
 type MockIPubValidator struct {
 	ctrl     *gomock.Controller
 	recorder *MockIPubValidatorMockRecorder
 }
 
-// MockIPubValidatorMockRecorder is the mock recorder for MockIPubValidator
+// MockIPubValidatorMockRecorder is the mock recorder for MockIPubValidator.
 type MockIPubValidatorMockRecorder struct {
 	mock *MockIPubValidator
 }
 
-// NewMockIPubValidator creates a new mock instance
+// NewMockIPubValidator creates a new mock instance.
 func NewMockIPubValidator(ctrl *gomock.Controller) *MockIPubValidator {
 	mock := &MockIPubValidator{ctrl: ctrl}
 	mock.recorder = &MockIPubValidatorMockRecorder{mock}
 	return mock
 }
 
-// EXPECT returns an object that allows the caller to indicate expected use
+// EXPECT returns an object that allows the caller to indicate expected use.
 func (m *MockIPubValidator) EXPECT() *MockIPubValidatorMockRecorder {
 	return m.recorder
 }
 
-// VerifySig mocks base method
-func (m *MockIPubValidator) VerifySig(digest, signature []byte) bool {
-	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "VerifySig", digest, signature)
-	ret0, _ := ret[0].(bool)
-	return ret0
-}
-
-// VerifySig indicates an expected call of VerifySig
-func (mr *MockIPubValidatorMockRecorder) VerifySig(digest, signature interface{}) *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifySig", reflect.TypeOf((*MockIPubValidator)(nil).VerifySig), digest, signature)
-}
-
-// GetPubKey mocks base method
+// GetPubKey mocks base method.
 func (m *MockIPubValidator) GetPubKey() message.PubKey {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetPubKey")
@@ -261,13 +432,13 @@ func (m *MockIPubValidator) GetPubKey() message.PubKey {
 	return ret0
 }
 
-// GetPubKey indicates an expected call of GetPubKey
+// GetPubKey indicates an expected call of GetPubKey.
 func (mr *MockIPubValidatorMockRecorder) GetPubKey() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPubKey", reflect.TypeOf((*MockIPubValidator)(nil).GetPubKey))
 }
 
-// GetVotingPower mocks base method
+// GetVotingPower mocks base method.
 func (m *MockIPubValidator) GetVotingPower() int64 {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetVotingPower")
@@ -275,48 +446,62 @@ func (m *MockIPubValidator) GetVotingPower() int64 {
 	return ret0
 }
 
-// GetVotingPower indicates an expected call of GetVotingPower
+// GetVotingPower indicates an expected call of GetVotingPower.
 func (mr *MockIPubValidatorMockRecorder) GetVotingPower() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVotingPower", reflect.TypeOf((*MockIPubValidator)(nil).GetVotingPower))
 }
 
-// SetVotingPower mocks base method
+// SetVotingPower mocks base method.
 func (m *MockIPubValidator) SetVotingPower(arg0 int64) {
 	m.ctrl.T.Helper()
 	m.ctrl.Call(m, "SetVotingPower", arg0)
 }
 
-// SetVotingPower indicates an expected call of SetVotingPower
+// SetVotingPower indicates an expected call of SetVotingPower.
 func (mr *MockIPubValidatorMockRecorder) SetVotingPower(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetVotingPower", reflect.TypeOf((*MockIPubValidator)(nil).SetVotingPower), arg0)
 }
 
-// MockIPrivValidator is a mock of IPrivValidator interface
+// VerifySig mocks base method.
+func (m *MockIPubValidator) VerifySig(digest, signature []byte) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifySig", digest, signature)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// VerifySig indicates an expected call of VerifySig.
+func (mr *MockIPubValidatorMockRecorder) VerifySig(digest, signature interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifySig", reflect.TypeOf((*MockIPubValidator)(nil).VerifySig), digest, signature)
+}
+
+// MockIPrivValidator is a mock of IPrivValidator interface.
 type MockIPrivValidator struct {
 	ctrl     *gomock.Controller
 	recorder *MockIPrivValidatorMockRecorder
 }
 
-// MockIPrivValidatorMockRecorder is the mock recorder for MockIPrivValidator
+// MockIPrivValidatorMockRecorder is the mock recorder for MockIPrivValidator.
 type MockIPrivValidatorMockRecorder struct {
 	mock *MockIPrivValidator
 }
 
-// NewMockIPrivValidator creates a new mock instance
+// NewMockIPrivValidator creates a new mock instance.
 func NewMockIPrivValidator(ctrl *gomock.Controller) *MockIPrivValidator {
 	mock := &MockIPrivValidator{ctrl: ctrl}
 	mock.recorder = &MockIPrivValidatorMockRecorder{mock}
 	return mock
 }
 
-// EXPECT returns an object that allows the caller to indicate expected use
+// EXPECT returns an object that allows the caller to indicate expected use.
 func (m *MockIPrivValidator) EXPECT() *MockIPrivValidatorMockRecorder {
 	return m.recorder
 }
 
-// GetPubKey mocks base method
+// GetPubKey mocks base method.
 func (m *MockIPrivValidator) GetPubKey() message.PubKey {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetPubKey")
@@ -324,13 +509,13 @@ func (m *MockIPrivValidator) GetPubKey() message.PubKey {
 	return ret0
 }
 
-// GetPubKey indicates an expected call of GetPubKey
+// GetPubKey indicates an expected call of GetPubKey.
 func (mr *MockIPrivValidatorMockRecorder) GetPubKey() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPubKey", reflect.TypeOf((*MockIPrivValidator)(nil).GetPubKey))
 }
 
-// Sign mocks base method
+// Sign mocks base method.
 func (m *MockIPrivValidator) Sign(digest []byte) []byte {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Sign", digest)
@@ -338,36 +523,258 @@ func (m *MockIPrivValidator) Sign(digest []byte) []byte {
 	return ret0
 }
 
-// Sign indicates an expected call of Sign
+// Sign indicates an expected call of Sign.
 func (mr *MockIPrivValidatorMockRecorder) Sign(digest interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sign", reflect.TypeOf((*MockIPrivValidator)(nil).Sign), digest)
 }
 
-// MockIP2P is a mock of IP2P interface
+// MockIAggregator is a mock of IAggregator interface.
+type MockIAggregator struct {
+	ctrl     *gomock.Controller
+	recorder *MockIAggregatorMockRecorder
+}
+
+// MockIAggregatorMockRecorder is the mock recorder for MockIAggregator.
+type MockIAggregatorMockRecorder struct {
+	mock *MockIAggregator
+}
+
+// NewMockIAggregator creates a new mock instance.
+func NewMockIAggregator(ctrl *gomock.Controller) *MockIAggregator {
+	mock := &MockIAggregator{ctrl: ctrl}
+	mock.recorder = &MockIAggregatorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIAggregator) EXPECT() *MockIAggregatorMockRecorder {
+	return m.recorder
+}
+
+// Aggregate mocks base method.
+func (m *MockIAggregator) Aggregate(signatures [][]byte) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Aggregate", signatures)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Aggregate indicates an expected call of Aggregate.
+func (mr *MockIAggregatorMockRecorder) Aggregate(signatures interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Aggregate", reflect.TypeOf((*MockIAggregator)(nil).Aggregate), signatures)
+}
+
+// Verify mocks base method.
+func (m *MockIAggregator) Verify(key, digest, signature []byte) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", key, digest, signature)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Verify indicates an expected call of Verify.
+func (mr *MockIAggregatorMockRecorder) Verify(key, digest, signature interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockIAggregator)(nil).Verify), key, digest, signature)
+}
+
+// VerifyAggregate mocks base method.
+func (m *MockIAggregator) VerifyAggregate(keys [][]byte, digest, aggSignature []byte) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyAggregate", keys, digest, aggSignature)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// VerifyAggregate indicates an expected call of VerifyAggregate.
+func (mr *MockIAggregatorMockRecorder) VerifyAggregate(keys, digest, aggSignature interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyAggregate", reflect.TypeOf((*MockIAggregator)(nil).VerifyAggregate), keys, digest, aggSignature)
+}
+
+// MockIAggPubValidator is a mock of IAggPubValidator interface.
+type MockIAggPubValidator struct {
+	ctrl     *gomock.Controller
+	recorder *MockIAggPubValidatorMockRecorder
+}
+
+// MockIAggPubValidatorMockRecorder is the mock recorder for MockIAggPubValidator.
+type MockIAggPubValidatorMockRecorder struct {
+	mock *MockIAggPubValidator
+}
+
+// NewMockIAggPubValidator creates a new mock instance.
+func NewMockIAggPubValidator(ctrl *gomock.Controller) *MockIAggPubValidator {
+	mock := &MockIAggPubValidator{ctrl: ctrl}
+	mock.recorder = &MockIAggPubValidatorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIAggPubValidator) EXPECT() *MockIAggPubValidatorMockRecorder {
+	return m.recorder
+}
+
+// GetAggKey mocks base method.
+func (m *MockIAggPubValidator) GetAggKey() []byte {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAggKey")
+	ret0, _ := ret[0].([]byte)
+	return ret0
+}
+
+// GetAggKey indicates an expected call of GetAggKey.
+func (mr *MockIAggPubValidatorMockRecorder) GetAggKey() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAggKey", reflect.TypeOf((*MockIAggPubValidator)(nil).GetAggKey))
+}
+
+// GetPubKey mocks base method.
+func (m *MockIAggPubValidator) GetPubKey() message.PubKey {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPubKey")
+	ret0, _ := ret[0].(message.PubKey)
+	return ret0
+}
+
+// GetPubKey indicates an expected call of GetPubKey.
+func (mr *MockIAggPubValidatorMockRecorder) GetPubKey() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPubKey", reflect.TypeOf((*MockIAggPubValidator)(nil).GetPubKey))
+}
+
+// GetVotingPower mocks base method.
+func (m *MockIAggPubValidator) GetVotingPower() int64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVotingPower")
+	ret0, _ := ret[0].(int64)
+	return ret0
+}
+
+// GetVotingPower indicates an expected call of GetVotingPower.
+func (mr *MockIAggPubValidatorMockRecorder) GetVotingPower() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVotingPower", reflect.TypeOf((*MockIAggPubValidator)(nil).GetVotingPower))
+}
+
+// SetVotingPower mocks base method.
+func (m *MockIAggPubValidator) SetVotingPower(arg0 int64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetVotingPower", arg0)
+}
+
+// SetVotingPower indicates an expected call of SetVotingPower.
+func (mr *MockIAggPubValidatorMockRecorder) SetVotingPower(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetVotingPower", reflect.TypeOf((*MockIAggPubValidator)(nil).SetVotingPower), arg0)
+}
+
+// VerifySig mocks base method.
+func (m *MockIAggPubValidator) VerifySig(digest, signature []byte) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifySig", digest, signature)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// VerifySig indicates an expected call of VerifySig.
+func (mr *MockIAggPubValidatorMockRecorder) VerifySig(digest, signature interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifySig", reflect.TypeOf((*MockIAggPubValidator)(nil).VerifySig), digest, signature)
+}
+
+// MockIAggPrivValidator is a mock of IAggPrivValidator interface.
+type MockIAggPrivValidator struct {
+	ctrl     *gomock.Controller
+	recorder *MockIAggPrivValidatorMockRecorder
+}
+
+// MockIAggPrivValidatorMockRecorder is the mock recorder for MockIAggPrivValidator.
+type MockIAggPrivValidatorMockRecorder struct {
+	mock *MockIAggPrivValidator
+}
+
+// NewMockIAggPrivValidator creates a new mock instance.
+func NewMockIAggPrivValidator(ctrl *gomock.Controller) *MockIAggPrivValidator {
+	mock := &MockIAggPrivValidator{ctrl: ctrl}
+	mock.recorder = &MockIAggPrivValidatorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIAggPrivValidator) EXPECT() *MockIAggPrivValidatorMockRecorder {
+	return m.recorder
+}
+
+// AggSign mocks base method.
+func (m *MockIAggPrivValidator) AggSign(digest []byte) []byte {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AggSign", digest)
+	ret0, _ := ret[0].([]byte)
+	return ret0
+}
+
+// AggSign indicates an expected call of AggSign.
+func (mr *MockIAggPrivValidatorMockRecorder) AggSign(digest interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AggSign", reflect.TypeOf((*MockIAggPrivValidator)(nil).AggSign), digest)
+}
+
+// GetPubKey mocks base method.
+func (m *MockIAggPrivValidator) GetPubKey() message.PubKey {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPubKey")
+	ret0, _ := ret[0].(message.PubKey)
+	return ret0
+}
+
+// GetPubKey indicates an expected call of GetPubKey.
+func (mr *MockIAggPrivValidatorMockRecorder) GetPubKey() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPubKey", reflect.TypeOf((*MockIAggPrivValidator)(nil).GetPubKey))
+}
+
+// Sign mocks base method.
+func (m *MockIAggPrivValidator) Sign(digest []byte) []byte {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Sign", digest)
+	ret0, _ := ret[0].([]byte)
+	return ret0
+}
+
+// Sign indicates an expected call of Sign.
+func (mr *MockIAggPrivValidatorMockRecorder) Sign(digest interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sign", reflect.TypeOf((*MockIAggPrivValidator)(nil).Sign), digest)
+}
+
+// MockIP2P is a mock of IP2P interface.
 type MockIP2P struct {
 	ctrl     *gomock.Controller
 	recorder *MockIP2PMockRecorder
 }
 
-// MockIP2PMockRecorder is the mock recorder for MockIP2P
+// MockIP2PMockRecorder is the mock recorder for MockIP2P.
 type MockIP2PMockRecorder struct {
 	mock *MockIP2P
 }
 
-// NewMockIP2P creates a new mock instance
+// NewMockIP2P creates a new mock instance.
 func NewMockIP2P(ctrl *gomock.Controller) *MockIP2P {
 	mock := &MockIP2P{ctrl: ctrl}
 	mock.recorder = &MockIP2PMockRecorder{mock}
 	return mock
 }
 
-// EXPECT returns an object that allows the caller to indicate expected use
+// EXPECT returns an object that allows the caller to indicate expected use.
 func (m *MockIP2P) EXPECT() *MockIP2PMockRecorder {
 	return m.recorder
 }
 
-// BroadCast mocks base method
+// BroadCast mocks base method.
 func (m *MockIP2P) BroadCast(msg message.ConsensusMessage) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "BroadCast", msg)
@@ -375,13 +782,13 @@ func (m *MockIP2P) BroadCast(msg message.ConsensusMessage) error {
 	return ret0
 }
 
-// BroadCast indicates an expected call of BroadCast
+// BroadCast indicates an expected call of BroadCast.
 func (mr *MockIP2PMockRecorder) BroadCast(msg interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BroadCast", reflect.TypeOf((*MockIP2P)(nil).BroadCast), msg)
 }
 
-// Send mocks base method
+// Send mocks base method.
 func (m *MockIP2P) Send(msg message.ConsensusMessage, p custom.IPeer) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Send", msg, p)
@@ -389,36 +796,36 @@ func (m *MockIP2P) Send(msg message.ConsensusMessage, p custom.IPeer) error {
 	return ret0
 }
 
-// Send indicates an expected call of Send
+// Send indicates an expected call of Send.
 func (mr *MockIP2PMockRecorder) Send(msg, p interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockIP2P)(nil).Send), msg, p)
 }
 
-// MockIPeer is a mock of IPeer interface
+// MockIPeer is a mock of IPeer interface.
 type MockIPeer struct {
 	ctrl     *gomock.Controller
 	recorder *MockIPeerMockRecorder
 }
 
-// MockIPeerMockRecorder is the mock recorder for MockIPeer
+// MockIPeerMockRecorder is the mock recorder for MockIPeer.
 type MockIPeerMockRecorder struct {
 	mock *MockIPeer
 }
 
-// NewMockIPeer creates a new mock instance
+// NewMockIPeer creates a new mock instance.
 func NewMockIPeer(ctrl *gomock.Controller) *MockIPeer {
 	mock := &MockIPeer{ctrl: ctrl}
 	mock.recorder = &MockIPeerMockRecorder{mock}
 	return mock
 }
 
-// EXPECT returns an object that allows the caller to indicate expected use
+// EXPECT returns an object that allows the caller to indicate expected use.
 func (m *MockIPeer) EXPECT() *MockIPeerMockRecorder {
 	return m.recorder
 }
 
-// IPv4 mocks base method
+// IPv4 mocks base method.
 func (m *MockIPeer) IPv4() string {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "IPv4")
@@ -426,13 +833,13 @@ func (m *MockIPeer) IPv4() string {
 	return ret0
 }
 
-// IPv4 indicates an expected call of IPv4
+// IPv4 indicates an expected call of IPv4.
 func (mr *MockIPeerMockRecorder) IPv4() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IPv4", reflect.TypeOf((*MockIPeer)(nil).IPv4))
 }
 
-// Port mocks base method
+// Port mocks base method.
 func (m *MockIPeer) Port() uint16 {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Port")
@@ -440,7 +847,7 @@ func (m *MockIPeer) Port() uint16 {
 	return ret0
 }
 
-// Port indicates an expected call of Port
+// Port indicates an expected call of Port.
 func (mr *MockIPeerMockRecorder) Port() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Port", reflect.TypeOf((*MockIPeer)(nil).Port))
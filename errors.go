@@ -1,6 +1,9 @@
 package gobft
 
 import (
+	"fmt"
+
+	"github.com/coschain/gobft/message"
 	"github.com/pkg/errors"
 )
 
@@ -12,7 +15,9 @@ var (
 	ErrVoteInvalidBlockHash          = errors.New("Invalid block hash")
 	ErrVoteNonDeterministicSignature = errors.New("Non-deterministic signature")
 	ErrVoteNil                       = errors.New("Nil vote")
-	ErrVoteMismatchedBase			 = errors.New("Invalid base")
+	ErrVoteMismatchedBase            = errors.New("Invalid base")
+	ErrVoteUnwantedRound             = errors.New("Too many rounds beyond ours")
+	ErrVoteWrongValSet               = errors.New("Signed under another validator set")
 )
 
 var (
@@ -21,23 +26,65 @@ var (
 	ErrInvalidProposalPOLRound  = errors.New("Error invalid proposal POL round")
 	ErrAddingVote               = errors.New("Error adding vote")
 	ErrVoteHeightMismatch       = errors.New("Error vote height mismatch")
+	ErrCommitNoMajority         = errors.New("Error commit without +2/3 precommits")
+	ErrCommitWrongValSet        = errors.New("Error commit of another validator set")
+	ErrCommitNoAggregator       = errors.New("Error commit certificate without an aggregator")
+	ErrCommitInvalidCertificate = errors.New("Error invalid commit certificate")
+)
+
+var (
+	ErrSignHeightRegression = errors.New("Error sign height regression")
+	ErrSignRoundRegression  = errors.New("Error sign round regression")
+	ErrSignStepRegression   = errors.New("Error sign step regression")
+	ErrSignConflictingData  = errors.New("Error sign conflicting data")
+)
+
+var (
+	ErrValUpdateNegativePower = errors.New("Error validator update with negative power")
+	ErrValUpdateDuplicated    = errors.New("Error validator updated twice at once")
+	ErrValUpdateTooMuchPower  = errors.New("Error validator updates change more than 1/3 of the voting power")
+	ErrValUpdateEmptySet      = errors.New("Error validator updates remove all the voting power")
+)
+
+var (
+	ErrCommitteeNoValidator  = errors.New("Error committee without any validator")
+	ErrCommitteeInvalidPower = errors.New("Error committee validator with non-positive voting power")
+	ErrCommitteeDuplicated   = errors.New("Error committee with duplicated validator")
+)
+
+var (
+	ErrProposerNoValidator    = errors.New("Error proposer selection without any validator")
+	ErrProposerInvalidPower   = errors.New("Error proposer selection with non-positive voting power")
+	ErrProposerDuplicated     = errors.New("Error proposer selection with duplicated validator")
+	ErrProposerTooMuchPower   = errors.New("Error proposer selection with too much total voting power")
+	ErrProposerHeightMismatch = errors.New("Error proposer selection height mismatch")
+)
+
+var (
+	ErrAppMsgBuiltin       = errors.New("Error application message of a type of gobft")
+	ErrAppMsgRegistered    = errors.New("Error application message handler registered twice")
+	ErrAppMsgInvalidSigner = errors.New("Error application message not signed by a validator")
+)
+
+var (
+	ErrEvidenceExpired          = errors.New("Error evidence expired")
+	ErrEvidenceFromFuture       = errors.New("Error evidence from future height")
+	ErrEvidenceInvalidOffender  = errors.New("Error evidence offender is not a validator")
+	ErrEvidenceInvalidSignature = errors.New("Error evidence invalid signature")
+	ErrEvidenceUnknownCommittee = errors.New("Error evidence of a height whose committee isn't kept")
+	ErrEvidenceWrongValSet      = errors.New("Error evidence vote of another validator set")
 )
 
 type ErrVoteConflictingVotes struct {
-	//*DuplicateVoteEvidence
+	*message.DuplicateVoteEvidence
 }
 
 func (err *ErrVoteConflictingVotes) Error() string {
-	//return fmt.Sprintf("Conflicting votes from validator %v", err.PubKey.Address())
-	return ""
+	return fmt.Sprintf("Conflicting votes from validator %v", err.PubKey)
 }
 
-func NewConflictingVoteError( /*val *Validator, voteA, voteB *Vote*/ ) *ErrVoteConflictingVotes {
+func NewConflictingVoteError(voteA, voteB *message.Vote) *ErrVoteConflictingVotes {
 	return &ErrVoteConflictingVotes{
-		//&DuplicateVoteEvidence{
-		//	PubKey: val.PubKey,
-		//	VoteA:  voteA,
-		//	VoteB:  voteB,
-		//},
+		message.NewDuplicateVoteEvidence(voteA, voteB),
 	}
 }
@@ -1 +1,184 @@
 package gobft
+
+import (
+	"encoding/hex"
+	"sort"
+	"sync"
+
+	"github.com/coschain/gobft/message"
+	"github.com/pkg/errors"
+)
+
+/*
+EvidencePool keeps verified evidence of validator misbehaviour that is
+not expired yet.
+
+Evidence is verified against the committee of its height before it's
+added to the pool: all votes in it must be signed by the offender under
+that committee, and the evidence itself by its reporter, a validator of
+the same committee. The pool keeps the committees of the last maxAge
+heights for it, from the height before the first one it's updated to.
+Evidence of earlier heights can't be verified and is rejected. Evidence
+older than maxAge heights is pruned.
+*/
+type EvidencePool struct {
+	mtx        sync.Mutex
+	validators *Validators
+	maxAge     int64
+	height     int64 // current height
+	pending    map[string]message.Evidence
+	// committees of the heights evidence can be of, in height order. Each
+	// one is kept from its first height until the next one.
+	committees []committeeSpan
+	// height of the last committee kept
+	lastCommittee int64
+}
+
+type committeeSpan struct {
+	from   int64
+	valSet *ValidatorSet
+}
+
+func NewEvidencePool(vals *Validators, maxAge int64) *EvidencePool {
+	return &EvidencePool{
+		validators: vals,
+		maxAge:     maxAge,
+		pending:    make(map[string]message.Evidence),
+	}
+}
+
+// AddEvidence verifies ev and adds it to the pool. It returns added=false
+// without error if ev is already in the pool.
+func (ep *EvidencePool) AddEvidence(ev message.Evidence) (added bool, err error) {
+	ep.mtx.Lock()
+	defer ep.mtx.Unlock()
+
+	key := hex.EncodeToString(ev.Hash())
+	if _, ok := ep.pending[key]; ok {
+		return false, nil
+	}
+	if err = ep.verify(ev); err != nil {
+		return false, err
+	}
+	ep.pending[key] = ev
+	return true, nil
+}
+
+func (ep *EvidencePool) verify(ev message.Evidence) error {
+	if err := ev.ValidateBasic(); err != nil {
+		return err
+	}
+	if ev.Height() > ep.height {
+		return errors.Wrapf(ErrEvidenceFromFuture, "evidence height %d, current height %d",
+			ev.Height(), ep.height)
+	}
+	if ep.isExpired(ev) {
+		return errors.Wrapf(ErrEvidenceExpired, "evidence height %d, current height %d",
+			ev.Height(), ep.height)
+	}
+	valSet := ep.committee(ev.Height())
+	if valSet == nil {
+		return errors.Wrapf(ErrEvidenceUnknownCommittee, "evidence height %d, current height %d",
+			ev.Height(), ep.height)
+	}
+	if !valSet.Has(ev.Offender()) {
+		return errors.Wrapf(ErrEvidenceInvalidOffender, "%v", ev.Offender())
+	}
+	for _, vote := range ev.Votes() {
+		if vote.ValSet != valSet.Hash() {
+			return errors.Wrapf(ErrEvidenceWrongValSet, "vote %v", vote)
+		}
+		if !valSet.VerifySignature(vote) {
+			return errors.Wrapf(ErrEvidenceInvalidSignature, "vote %v", vote)
+		}
+	}
+	if !valSet.VerifySignature(ev) {
+		return errors.Wrapf(ErrEvidenceInvalidSignature, "reporter %v", ev.GetSigner())
+	}
+	return nil
+}
+
+// SetMaxAge sets how many heights evidence is kept
+func (ep *EvidencePool) SetMaxAge(maxAge int64) {
+	ep.mtx.Lock()
+	defer ep.mtx.Unlock()
+	ep.maxAge = maxAge
+}
+
+func (ep *EvidencePool) isExpired(ev message.Evidence) bool {
+	return ep.maxAge > 0 && ev.Height() < ep.height-ep.maxAge
+}
+
+// Update sets the current height, keeps its committee and prunes expired
+// evidence and committees
+func (ep *EvidencePool) Update(height int64) {
+	ep.mtx.Lock()
+	defer ep.mtx.Unlock()
+
+	ep.height = height
+	for h := height - 1; h <= height; h++ {
+		if valSet := ep.validators.ValidatorSet(h); valSet != nil {
+			ep.addCommittee(h, valSet)
+		}
+	}
+	for key, ev := range ep.pending {
+		if ep.isExpired(ev) {
+			delete(ep.pending, key)
+		}
+	}
+	// the span of the oldest height evidence can be of stays
+	if ep.maxAge > 0 {
+		i := sort.Search(len(ep.committees), func(i int) bool {
+			return ep.committees[i].from > height-ep.maxAge
+		})
+		if i > 1 {
+			ep.committees = ep.committees[i-1:]
+		}
+	}
+}
+
+// addCommittee keeps valSet as the committee of height, which is after the
+// heights kept. Heights of the same committee share a span.
+func (ep *EvidencePool) addCommittee(height int64, valSet *ValidatorSet) {
+	if height <= ep.lastCommittee {
+		return
+	}
+	ep.lastCommittee = height
+	if n := len(ep.committees); n > 0 && ep.committees[n-1].valSet.Hash() == valSet.Hash() {
+		return
+	}
+	ep.committees = append(ep.committees, committeeSpan{height, valSet})
+}
+
+// committee returns the committee of height, nil if it's not kept
+func (ep *EvidencePool) committee(height int64) *ValidatorSet {
+	i := sort.Search(len(ep.committees), func(i int) bool {
+		return ep.committees[i].from > height
+	})
+	if i == 0 || height > ep.lastCommittee {
+		return nil
+	}
+	return ep.committees[i-1].valSet
+}
+
+// PendingEvidence returns all evidence in the pool ordered by height
+func (ep *EvidencePool) PendingEvidence() []message.Evidence {
+	ep.mtx.Lock()
+	defer ep.mtx.Unlock()
+
+	ret := make([]message.Evidence, 0, len(ep.pending))
+	for _, ev := range ep.pending {
+		ret = append(ret, ev)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Height() < ret[j].Height()
+	})
+	return ret
+}
+
+// Size returns the number of evidence in the pool
+func (ep *EvidencePool) Size() int {
+	ep.mtx.Lock()
+	defer ep.mtx.Unlock()
+	return len(ep.pending)
+}
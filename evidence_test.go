@@ -0,0 +1,173 @@
+package gobft
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/coschain/gobft/custom"
+	"github.com/coschain/gobft/custom/mock"
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvidencePool(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	var reporter message.PubKey = "val_pubkey0"
+	var offender message.PubKey = "val_pubkey1"
+	val := mock.NewMockIPubValidator(ctrl)
+	val.EXPECT().VerifySig(gomock.Any(), gomock.Any()).Return(true).AnyTimes()
+	val.EXPECT().GetVotingPower().Return(int64(1)).AnyTimes()
+	privVal := mock.NewMockIPrivValidator(ctrl)
+	privVal.EXPECT().GetPubKey().Return(reporter).AnyTimes()
+	privVal.EXPECT().Sign(gomock.Any()).DoAndReturn(func(digest []byte) []byte {
+		return digest
+	}).AnyTimes()
+
+	committee := mock.NewMockICommittee(ctrl)
+	committee.EXPECT().GetValidator(gomock.Any()).DoAndReturn(func(key message.PubKey) custom.IPubValidator {
+		if key == reporter || key == offender {
+			return val
+		}
+		return nil
+	}).AnyTimes()
+	committee.EXPECT().GetValidatorList().Return([]message.PubKey{reporter, offender}).AnyTimes()
+	vals := NewValidators(committee, privVal)
+	vals.updateHeight(19, 2)
+	valSet, _ := vals.updateHeight(20, 2)
+
+	var prev message.ProposedData
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	y := message.ProposedData(sha256.Sum256([]byte("y")))
+	// the same votes, including their timestamps, make the same evidence
+	voteTime := time.Now()
+	newEvidence := func(height int64, from message.PubKey) *message.DuplicateVoteEvidence {
+		voteX := message.NewVote(message.PrecommitType, height, 0, &x, &prev)
+		voteX.Timestamp = voteTime
+		voteX.Address = from
+		voteX.Signature = []byte("sigX")
+		voteX.ValSet = valSet.Hash()
+		voteY := message.NewVote(message.PrecommitType, height, 0, &y, &prev)
+		voteY.Timestamp = voteTime
+		voteY.Address = from
+		voteY.Signature = []byte("sigY")
+		voteY.ValSet = valSet.Hash()
+		ev := message.NewDuplicateVoteEvidence(voteX, voteY)
+		assert.Nil(vals.Sign(ev))
+		return ev
+	}
+
+	pool := NewEvidencePool(vals, 10)
+	pool.Update(20)
+
+	ev := newEvidence(19, offender)
+	added, err := pool.AddEvidence(ev)
+	assert.True(added)
+	assert.Nil(err)
+
+	// duplicates are ignored
+	added, err = pool.AddEvidence(newEvidence(19, offender))
+	assert.False(added)
+	assert.Nil(err)
+
+	_, err = pool.AddEvidence(newEvidence(21, offender))
+	assert.Equal(ErrEvidenceFromFuture, errors.Cause(err))
+	_, err = pool.AddEvidence(newEvidence(9, offender))
+	assert.Equal(ErrEvidenceExpired, errors.Cause(err))
+	_, err = pool.AddEvidence(newEvidence(20, "stranger"))
+	assert.Equal(ErrEvidenceInvalidOffender, errors.Cause(err))
+	// the committee of a height before the pool started isn't kept
+	_, err = pool.AddEvidence(newEvidence(15, offender))
+	assert.Equal(ErrEvidenceUnknownCommittee, errors.Cause(err))
+	// nor are votes of another validator set counted
+	other := newEvidence(20, offender)
+	other.VoteA.ValSet = message.ValSetHash{}
+	assert.Nil(vals.Sign(other))
+	_, err = pool.AddEvidence(other)
+	assert.Equal(ErrEvidenceWrongValSet, errors.Cause(err))
+
+	assert.Equal([]message.Evidence{ev}, pool.PendingEvidence())
+
+	// proposer equivocation
+	proposalX := message.NewVote(message.ProposalType, 20, 1, &x, &prev)
+	proposalX.Address = offender
+	proposalX.Signature = []byte("sigX")
+	proposalX.ValSet = valSet.Hash()
+	proposalY := message.NewVote(message.ProposalType, 20, 1, &y, &prev)
+	proposalY.Address = offender
+	proposalY.Signature = []byte("sigY")
+	proposalY.ValSet = valSet.Hash()
+	pev := message.NewProposerEquivocationEvidence(proposalY, proposalX)
+	assert.Nil(vals.Sign(pev))
+	added, err = pool.AddEvidence(pev)
+	assert.True(added)
+	assert.Nil(err)
+	assert.Equal([]message.Evidence{ev, pev}, pool.PendingEvidence())
+
+	// evidence some heights old is verified against the committee of its
+	// height, which is kept as long as evidence of it can be
+	for h := int64(21); h <= 25; h++ {
+		vals.updateHeight(h, 2)
+		pool.Update(h)
+	}
+	assert.Nil(vals.ValidatorSet(20))
+	old := newEvidence(20, offender)
+	added, err = pool.AddEvidence(old)
+	assert.True(added)
+	assert.Nil(err)
+
+	// heights of the same committee share it
+	assert.Len(pool.committees, 1)
+
+	pool.Update(30)
+	assert.Equal(2, pool.Size())
+	pool.Update(31)
+	assert.Equal(0, pool.Size())
+}
+
+func TestEvidencePoolCommittees(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	val := mock.NewMockIPubValidator(ctrl)
+	committee := mock.NewMockICommittee(ctrl)
+	committee.EXPECT().GetValidator(gomock.Any()).Return(val).AnyTimes()
+	privVal := mock.NewMockIPrivValidator(ctrl)
+	privVal.EXPECT().GetPubKey().Return(message.PubKey("val_pubkey0")).AnyTimes()
+	newSet := func(height int64, power int64) *ValidatorSet {
+		list := []message.PubKey{"val_pubkey0"}
+		return newValidatorSet(height, list, map[message.PubKey]int64{"val_pubkey0": power}, committee)
+	}
+	a, b := newSet(1, 1), newSet(10, 2)
+
+	pool := NewEvidencePool(NewValidators(committee, privVal), 10)
+	for h := int64(1); h <= 30; h++ {
+		valSet := a
+		if h >= 10 && h < 20 {
+			valSet = b
+		}
+		pool.addCommittee(h, valSet)
+	}
+	pool.addCommittee(5, b)
+	assert.Len(pool.committees, 3)
+	assert.Equal(a, pool.committee(5))
+	assert.Equal(b, pool.committee(10))
+	assert.Equal(b, pool.committee(19))
+	assert.Equal(a, pool.committee(20))
+	assert.Nil(pool.committee(0))
+	assert.Nil(pool.committee(31))
+
+	// evidence can be of height 19 at 29, but not at 30
+	pool.Update(29)
+	assert.Len(pool.committees, 2)
+	assert.Equal(b, pool.committee(19))
+	pool.Update(30)
+	assert.Len(pool.committees, 1)
+	assert.Equal(a, pool.committee(20))
+}
@@ -0,0 +1,142 @@
+package gobft
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coschain/gobft/common"
+	"github.com/coschain/gobft/message"
+)
+
+// ValidatorLock is what a validator is believed to be locked on: its latest
+// precommit for non-nil ProposedData. It might have unlocked since if it
+// saw a newer polka for something else.
+type ValidatorLock struct {
+	Validator message.PubKey
+	Round     int
+	Proposed  message.ProposedData
+}
+
+// Polka is +2/3 prevotes for Proposed at Round
+type Polka struct {
+	Round    int
+	Proposed message.ProposedData
+}
+
+// MissingVotes lists the validators we don't have a vote of Type from at Round
+type MissingVotes struct {
+	Round      int
+	Type       message.VoteType
+	Validators []message.PubKey
+}
+
+/*
+HaltReport describes a height that doesn't get committed, as far as we
+can tell from the votes we have.
+
+Validators locked on different ProposedData point to a lock split, while
+the same validators missing in every round point to a partition or
+offline validators.
+*/
+type HaltReport struct {
+	Height    int64
+	Round     int
+	Step      RoundStepType
+	StartTime time.Time
+
+	Locks   []ValidatorLock
+	Polkas  []Polka
+	Missing []MissingVotes
+}
+
+// makeHaltReport builds a HaltReport of the current height from c.Votes.
+// Core must be locked.
+func (c *Core) makeHaltReport() *HaltReport {
+	report := &HaltReport{
+		Height:    c.Height,
+		Round:     c.Round,
+		Step:      c.Step,
+		StartTime: c.StartTime,
+	}
+	if c.Votes == nil {
+		return report
+	}
+
+	self := c.validators.GetSelfPubKey()
+	validators := c.validators.Current().List()
+	locks := make(map[message.PubKey]ValidatorLock)
+	for r := 0; r <= c.Round; r++ {
+		prevotes := c.Votes.Prevotes(r)
+		precommits := c.Votes.Precommits(r)
+		if polkaData, ok := prevotes.TwoThirdsMajority(); ok {
+			report.Polkas = append(report.Polkas, Polka{r, polkaData})
+		}
+
+		var missingPrevotes, missingPrecommits []message.PubKey
+		for _, val := range validators {
+			if prevotes.GetByAddress(val) == nil {
+				missingPrevotes = append(missingPrevotes, val)
+			}
+			precommit := precommits.GetByAddress(val)
+			if precommit == nil {
+				missingPrecommits = append(missingPrecommits, val)
+			} else if precommit.Proposed != message.NilData {
+				locks[val] = ValidatorLock{val, r, precommit.Proposed}
+			}
+		}
+		if len(missingPrevotes) > 0 {
+			report.Missing = append(report.Missing, MissingVotes{r, message.PrevoteType, missingPrevotes})
+		}
+		if len(missingPrecommits) > 0 {
+			report.Missing = append(report.Missing, MissingVotes{r, message.PrecommitType, missingPrecommits})
+		}
+	}
+
+	// we know our own lock for sure
+	delete(locks, self)
+	if c.LockedRound >= 0 && c.LockedProposal != nil {
+		locks[self] = ValidatorLock{self, c.LockedRound, c.LockedProposal.Proposed}
+	}
+	for _, val := range validators {
+		if lock, ok := locks[val]; ok {
+			report.Locks = append(report.Locks, lock)
+		}
+	}
+	return report
+}
+
+// LockedOn groups the locked validators by what they're locked on
+func (r *HaltReport) LockedOn() map[message.ProposedData][]message.PubKey {
+	ret := make(map[message.ProposedData][]message.PubKey)
+	for _, lock := range r.Locks {
+		ret[lock.Proposed] = append(ret[lock.Proposed], lock.Validator)
+	}
+	return ret
+}
+
+// IsLockSplit returns true if validators are locked on different ProposedData
+func (r *HaltReport) IsLockSplit() bool {
+	return len(r.LockedOn()) > 1
+}
+
+func (r *HaltReport) String() string {
+	locks := make([]string, 0, len(r.Locks))
+	for _, lock := range r.Locks {
+		locks = append(locks, fmt.Sprintf("%s@%d:%X", lock.Validator, lock.Round,
+			common.Fingerprint(lock.Proposed[:])))
+	}
+	polkas := make([]string, 0, len(r.Polkas))
+	for _, polka := range r.Polkas {
+		polkas = append(polkas, fmt.Sprintf("%d:%X", polka.Round, common.Fingerprint(polka.Proposed[:])))
+	}
+	missing := make([]string, 0, len(r.Missing))
+	for _, m := range r.Missing {
+		missing = append(missing, fmt.Sprintf("%d/%d:%v", m.Round, m.Type, m.Validators))
+	}
+	return fmt.Sprintf("HaltReport{H:%v R:%v S:%v since %v locks:[%s] polkas:[%s] missing:[%s]}",
+		r.Height, r.Round, r.Step, r.StartTime,
+		strings.Join(locks, " "),
+		strings.Join(polkas, " "),
+		strings.Join(missing, " "))
+}
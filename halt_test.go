@@ -0,0 +1,125 @@
+package gobft
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHaltReport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	const (
+		A = iota
+		B
+		C
+		D
+	)
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	y := message.ProposedData(sha256.Sum256([]byte("y")))
+	net := newTestNetwork(t, ctrl, 4, []message.ProposedData{x, x, y, y})
+	reports := make(chan *HaltReport, 4)
+	net.nodes[A].core.cfg.HaltRounds = 3
+	net.nodes[A].core.SetHaltCallback(func(report *HaltReport) {
+		reports <- report
+	})
+
+	// round 0: A and B lock on x, C and D miss A's prevote and precommit nil
+	net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+		switch m := msg.(type) {
+		case *message.Vote:
+			if m.Type == message.ProposalType && to == D {
+				return false
+			}
+			if m.Type == message.PrevoteType && from == A && (to == C || to == D) {
+				return false
+			}
+		case *message.FetchVotesReq, *message.FetchVotesRsp:
+			return false
+		}
+		return true
+	}
+	net.start()
+	net.runUntil(func() bool {
+		return net.nodes[A].core.Round >= 1
+	}, 100)
+
+	// then D is gone and nobody gets a proposal from others or missing votes
+	net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+		switch m := msg.(type) {
+		case *message.Vote:
+			if m.Type == message.ProposalType {
+				return false
+			}
+		case *message.FetchVotesReq, *message.FetchVotesRsp:
+			return false
+		}
+		return from != D && to != D
+	}
+	net.runUntil(func() bool {
+		return net.nodes[A].core.Round >= 3
+	}, 100)
+
+	var report *HaltReport
+	select {
+	case report = <-reports:
+	case <-time.After(time.Second):
+		t.Fatal("no HaltReport")
+	}
+	assert.Equal(int64(1), report.Height)
+	assert.Equal(3, report.Round)
+	assert.Equal([]ValidatorLock{
+		{net.pubKeys[A], 0, x},
+		{net.pubKeys[B], 0, x},
+	}, report.Locks)
+	assert.False(report.IsLockSplit())
+	assert.Equal([]Polka{{0, x}}, report.Polkas)
+	assert.Equal([]MissingVotes{
+		{1, message.PrevoteType, []message.PubKey{net.pubKeys[D]}},
+		{1, message.PrecommitType, []message.PubKey{net.pubKeys[D]}},
+		{2, message.PrevoteType, []message.PubKey{net.pubKeys[D]}},
+		{2, message.PrecommitType, []message.PubKey{net.pubKeys[D]}},
+	}, report.Missing[:4])
+
+	assert.Equal(report.Locks, net.nodes[C].core.GetHaltReport().Locks)
+}
+
+// A HaltReport is made once HaltRounds rounds have gone since the last one,
+// even if the round it's due at is skipped
+func TestHaltReportRoundSkip(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 4, []message.ProposedData{x, x, x, x})
+	core := net.nodes[1].core
+	core.cfg.HaltRounds = 3
+	reports := make(chan *HaltReport, 4)
+	core.SetHaltCallback(func(report *HaltReport) {
+		reports <- report
+	})
+	reported := func() int {
+		select {
+		case report := <-reports:
+			return report.Round
+		case <-time.After(time.Second):
+			return -1
+		}
+	}
+	net.start()
+
+	core.enterNewRound(1, 2)
+	core.enterNewRound(1, 4)
+	assert.Equal(4, reported())
+	core.enterNewRound(1, 6)
+	core.enterNewRound(1, 7)
+	assert.Equal(7, reported())
+	assert.Len(reports, 0)
+}
@@ -0,0 +1,79 @@
+package gobft
+
+import (
+	"reflect"
+
+	"github.com/coschain/gobft/custom"
+	"github.com/coschain/gobft/message"
+)
+
+// MessageHandler handles an application-defined message received from p. The
+// error it returns is logged.
+type MessageHandler func(msg message.ConsensusMessage, p custom.IPeer) error
+
+// RegisterHandler makes Core hand the messages of the type of msg to handler.
+// The type must be registered with message.RegisterMessage so that the codecs
+// carry it.
+//
+// Core checks a message with ValidateBasic, and that it's signed by a
+// validator of the current height over the chain ID of Config, before handler
+// is called on the receive routine. Core isn't locked meanwhile so that
+// handler can call its methods, but it holds up the following messages and
+// should return quickly. Application messages are never written to WAL.
+func (c *Core) RegisterHandler(msg message.ConsensusMessage, handler MessageHandler) error {
+	if isCoreMessage(msg) {
+		return ErrAppMsgBuiltin
+	}
+	c.Lock()
+	defer c.Unlock()
+	t := reflect.TypeOf(msg)
+	if c.handlers[t] != nil {
+		return ErrAppMsgRegistered
+	}
+	c.handlers[t] = handler
+	return nil
+}
+
+// SignMessage signs an application-defined message with our key so that the
+// other Cores on the chain accept it
+func (c *Core) SignMessage(msg message.ConsensusMessage) error {
+	if isCoreMessage(msg) {
+		return ErrAppMsgBuiltin
+	}
+	return c.validators.Sign(msg)
+}
+
+func (c *Core) getHandler(msg message.ConsensusMessage) MessageHandler {
+	if isCoreMessage(msg) {
+		return nil
+	}
+	c.RLock()
+	defer c.RUnlock()
+	return c.handlers[reflect.TypeOf(msg)]
+}
+
+func (c *Core) handleAppMsg(mi msgInfo, handler MessageHandler) {
+	msg := mi.Msg
+	if err := msg.ValidateBasic(); err != nil {
+		c.log.Error(err)
+		return
+	}
+	if !c.validators.VerifySignature(msg) {
+		c.log.Error(ErrAppMsgInvalidSigner, " ", msg)
+		return
+	}
+	if err := handler(msg, mi.Peer); err != nil {
+		c.log.Error("Error handling ", reflect.TypeOf(msg), ": ", err)
+	}
+}
+
+// isCoreMessage returns true if msg is one of the messages of gobft
+func isCoreMessage(msg message.ConsensusMessage) bool {
+	switch msg.(type) {
+	case *message.Vote, *message.Commit, *message.FetchVotesReq, *message.FetchVotesRsp,
+		*message.NewRoundStep, *message.FetchCommitsReq, *message.VoteBatch, message.Evidence:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,117 @@
+package gobft
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/coschain/gobft/custom"
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// testHeartbeat is an application-defined message
+type testHeartbeat struct {
+	Height    int64
+	Signer    message.PubKey
+	Signature []byte
+}
+
+func init() {
+	message.RegisterMessage(&testHeartbeat{}, "test/Heartbeat")
+}
+
+func (hb *testHeartbeat) ValidateBasic() error {
+	if hb.Height < 0 {
+		return errors.New("negative height")
+	}
+	return nil
+}
+
+func (hb *testHeartbeat) SignBytes(chainID string) []byte {
+	body := make([]byte, 8, 8+len(hb.Signer))
+	binary.BigEndian.PutUint64(body, uint64(hb.Height))
+	body = append(body, hb.Signer...)
+	return message.AppSignBytes(chainID, "test/Heartbeat", body)
+}
+
+func (hb *testHeartbeat) Digest() []byte {
+	return message.SignDigest(hb, "")
+}
+
+func (hb *testHeartbeat) SetSigner(key message.PubKey) { hb.Signer = key }
+
+func (hb *testHeartbeat) SetSignature(sig []byte) { hb.Signature = sig }
+
+func (hb *testHeartbeat) GetSigner() message.PubKey { return hb.Signer }
+
+func (hb *testHeartbeat) GetSignature() []byte { return hb.Signature }
+
+func (hb *testHeartbeat) Bytes() []byte {
+	bz, err := message.EncodeConsensusMsg(hb, message.AminoCodec)
+	if err != nil {
+		panic(err)
+	}
+	return bz
+}
+
+func (hb *testHeartbeat) String() string {
+	return fmt.Sprintf("Heartbeat{%d %s}", hb.Height, hb.Signer)
+}
+
+func TestAppMessages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	net := newTestNetwork(t, ctrl, 4, make([]message.ProposedData, 4))
+	for _, node := range net.nodes {
+		node.core.validators.updateHeight(1, 0)
+	}
+	var received []*testHeartbeat
+	var from []int
+	handler := func(msg message.ConsensusMessage, p custom.IPeer) error {
+		received = append(received, msg.(*testHeartbeat))
+		from = append(from, int(p.(testPeer)))
+		return nil
+	}
+	core := net.nodes[1].core
+	assert.Nil(core.RegisterHandler(&testHeartbeat{}, handler))
+	assert.Equal(ErrAppMsgRegistered, core.RegisterHandler(&testHeartbeat{}, handler))
+	assert.Equal(ErrAppMsgBuiltin, core.RegisterHandler(&message.Vote{}, handler))
+	assert.Equal(ErrAppMsgBuiltin, net.nodes[0].core.SignMessage(&message.Vote{}))
+
+	// the codecs carry it
+	hb := &testHeartbeat{Height: 7}
+	assert.Nil(net.nodes[0].core.SignMessage(hb))
+	assert.Equal(net.pubKeys[0], hb.Signer)
+	for _, codec := range []message.Codec{message.AminoCodec, message.ProtoCodec} {
+		bz, err := message.EncodeConsensusMsg(hb, codec)
+		if codec == message.ProtoCodec {
+			// it's not a ProtoMessage
+			assert.NotNil(err)
+			continue
+		}
+		assert.Nil(err)
+		decoded, err := message.DecodeConsensusMsg(bz)
+		assert.Nil(err)
+		assert.Equal(hb, decoded)
+	}
+	assert.False(isWalMessage(hb))
+
+	net.send(0, nil, hb)
+	// not signed by a validator
+	stranger := &testHeartbeat{Height: 8, Signer: "stranger"}
+	stranger.SetSignature(stranger.Digest())
+	net.send(2, nil, stranger)
+	// invalid
+	invalid := &testHeartbeat{Height: -1}
+	assert.Nil(net.nodes[3].core.SignMessage(invalid))
+	net.send(3, nil, invalid)
+	net.deliver()
+
+	assert.Equal([]*testHeartbeat{hb}, received)
+	assert.Equal([]int{0}, from)
+}
@@ -15,39 +15,42 @@ type RoundVoteSet struct {
 	Precommits *VoteSet
 }
 
-var (
-	GotVoteFromUnwantedRoundError = errors.New("Peer has sent a vote that does not match our round for more than one round")
-)
+// maxCatchupRounds is the number of rounds beyond ours a validator can
+// make us track by voting in them
+const maxCatchupRounds = 2
 
 /*
 Keeps track of all VoteSets from round 0 to round 'round'.
 
-Also keeps track of up to one RoundVoteSet greater than
-'round' from each peer, to facilitate catchup syncing of commits.
+Also keeps track of up to maxCatchupRounds RoundVoteSets greater than
+'round' from each validator, to facilitate catchup syncing of commits.
 
 A commit is +2/3 precommits for a block at a round,
-but which round is not known in advance, so when a peer
-provides a precommit for a round greater than mtx.round,
+but which round is not known in advance, so when a validator
+provides a vote for a round greater than hvs.round,
 we create a new entry in roundVoteSets but also remember the
-peer to prevent abuse.
+validator to prevent abuse. Its votes for any other round beyond
+ours are dropped with ErrVoteUnwantedRound, until we get to the rounds
+it made us track.
 */
 type HeightVoteSet struct {
 	height int64
-	valSet *Validators
-	base message.ProposedData
+	valSet *ValidatorSet
+	base   message.ProposedData
 
-	mtx           sync.Mutex
-	round         int                  // max tracked round
-	roundVoteSets map[int]RoundVoteSet // keys: [0...round]
+	mtx               sync.Mutex
+	round             int                      // max tracked round
+	roundVoteSets     map[int]RoundVoteSet     // keys: [0...round]
+	peerCatchupRounds map[message.PubKey][]int // keys: validator, values: at most maxCatchupRounds rounds
 }
 
-func NewHeightVoteSet(height int64, valSet *Validators, b *message.ProposedData) *HeightVoteSet {
+func NewHeightVoteSet(height int64, valSet *ValidatorSet, b *message.ProposedData) *HeightVoteSet {
 	hvs := &HeightVoteSet{}
 	hvs.Reset(height, valSet, b)
 	return hvs
 }
 
-func (hvs *HeightVoteSet) Reset(height int64, valSet *Validators, b *message.ProposedData) {
+func (hvs *HeightVoteSet) Reset(height int64, valSet *ValidatorSet, b *message.ProposedData) {
 	hvs.mtx.Lock()
 	defer hvs.mtx.Unlock()
 
@@ -55,6 +58,7 @@ func (hvs *HeightVoteSet) Reset(height int64, valSet *Validators, b *message.Pro
 	hvs.valSet = valSet
 	hvs.base = *b
 	hvs.roundVoteSets = make(map[int]RoundVoteSet)
+	hvs.peerCatchupRounds = make(map[message.PubKey][]int)
 
 	hvs.addRound(0)
 	hvs.round = 0
@@ -86,6 +90,20 @@ func (hvs *HeightVoteSet) SetRound(round int) {
 		hvs.addRound(r)
 	}
 	hvs.round = round
+	// the rounds we've caught up with no longer count against anyone
+	for pk, rounds := range hvs.peerCatchupRounds {
+		beyond := rounds[:0]
+		for _, r := range rounds {
+			if r > round {
+				beyond = append(beyond, r)
+			}
+		}
+		if len(beyond) == 0 {
+			delete(hvs.peerCatchupRounds, pk)
+		} else {
+			hvs.peerCatchupRounds[pk] = beyond
+		}
+	}
 }
 
 func (hvs *HeightVoteSet) addRound(round int) {
@@ -102,18 +120,30 @@ func (hvs *HeightVoteSet) addRound(round int) {
 }
 
 // Duplicate votes return added=false, err=nil.
-// By convention, peerID is "" if origin is self.
+// Votes of a validator for more than maxCatchupRounds rounds beyond ours
+// return added=false, err=ErrVoteUnwantedRound.
 func (hvs *HeightVoteSet) AddVote(vote *message.Vote) (added bool, err error) {
 	hvs.mtx.Lock()
 	defer hvs.mtx.Unlock()
 	if !message.IsVoteTypeValid(vote.Type) {
 		return false, errors.New("invalid vote type")
 	}
+	if vote.ValSet != hvs.valSet.Hash() {
+		return false, ErrVoteWrongValSet
+	}
 	voteSet := hvs.getVoteSet(vote.Round, vote.Type)
 	if voteSet == nil {
+		rounds := hvs.peerCatchupRounds[vote.Address]
+		if len(rounds) >= maxCatchupRounds {
+			return false, ErrVoteUnwantedRound
+		}
+		// don't let anyone use up the rounds of others
+		if !hvs.valSet.VerifySignature(vote) {
+			return false, ErrVoteInvalidSignature
+		}
 		hvs.addRound(vote.Round)
 		voteSet = hvs.getVoteSet(vote.Round, vote.Type)
-		// TODO: valid catchup rounds?
+		hvs.peerCatchupRounds[vote.Address] = append(rounds, vote.Round)
 	}
 	added, err = voteSet.AddVote(vote)
 	return
@@ -2,6 +2,9 @@ package message
 
 import (
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/coschain/gobft/common"
 	"github.com/tendermint/go-amino"
@@ -18,6 +21,10 @@ func init() {
 // ConsensusMessage is a message that can be sent and received on the ConsensusReactor
 type ConsensusMessage interface {
 	ValidateBasic() error
+	// SignBytes returns the canonical encoding of the message signed on the
+	// chain chainID, see SignDigest
+	SignBytes(chainID string) []byte
+	// Digest identifies the message no matter which chain it's signed for
 	Digest() []byte
 	SetSigner(key PubKey)
 	SetSignature(sig []byte)
@@ -27,22 +34,179 @@ type ConsensusMessage interface {
 	String() string
 }
 
+// RegisterConsensusMessages registers the messages of gobft and the ones
+// registered with RegisterMessage so far to cdc
 func RegisterConsensusMessages(cdc *amino.Codec) {
 	cdc.RegisterInterface((*ConsensusMessage)(nil), nil)
 	cdc.RegisterConcrete(&Vote{}, "gobft/Vote", nil)
 	cdc.RegisterConcrete(&Commit{}, "gobft/Commit", nil)
 	cdc.RegisterConcrete(&FetchVotesReq{}, "gobft/FetchVotesReq", nil)
 	cdc.RegisterConcrete(&FetchVotesRsp{}, "gobft/FetchVotesRsp", nil)
+	cdc.RegisterConcrete(&NewRoundStep{}, "gobft/NewRoundStep", nil)
+	cdc.RegisterConcrete(&FetchCommitsReq{}, "gobft/FetchCommitsReq", nil)
+	cdc.RegisterConcrete(&VoteBatch{}, "gobft/VoteBatch", nil)
+	cdc.RegisterConcrete(&DuplicateVoteEvidence{}, "gobft/DuplicateVoteEvidence", nil)
+	cdc.RegisterConcrete(&ProposerEquivocationEvidence{}, "gobft/ProposerEquivocationEvidence", nil)
+
+	appMessages.Lock()
+	defer appMessages.Unlock()
+	for _, m := range appMessages.list {
+		cdc.RegisterConcrete(m.msg, m.name, nil)
+	}
+}
+
+type registeredMessage struct {
+	msg  ConsensusMessage
+	name string
+}
+
+// appMessages are the messages registered with RegisterMessage
+var appMessages struct {
+	sync.Mutex
+	list []registeredMessage
+}
+
+// RegisterMessage lets the codecs carry application-defined messages of the
+// type of msg, which must be a pointer, under name. The name must not start
+// with "gobft/". It's registered to ProtoCodec as well if msg is a
+// ProtoMessage. It must be called before the messages are encoded or
+// decoded, typically in init.
+// Core hands the messages to the handler registered with
+// gobft.Core.RegisterHandler.
+func RegisterMessage(msg ConsensusMessage, name string) {
+	if strings.HasPrefix(name, "gobft/") {
+		panic(fmt.Sprintf("message name %s is reserved", name))
+	}
+	appMessages.Lock()
+	cdc.RegisterConcrete(msg, name, nil)
+	appMessages.list = append(appMessages.list, registeredMessage{msg, name})
+	appMessages.Unlock()
+	if pm, ok := msg.(ProtoMessage); ok {
+		RegisterProtoMessage(pm, name)
+	}
+}
+
+// CodecID identifies the Codec of an envelope
+type CodecID uint8
+
+const (
+	CodecAmino CodecID = 0x01
+	CodecProto CodecID = 0x02
+)
+
+// Codec encodes ConsensusMessages into bytes and back
+type Codec interface {
+	ID() CodecID
+	Encode(msg ConsensusMessage) ([]byte, error)
+	Decode(bz []byte) (ConsensusMessage, error)
+}
+
+/*
+An envelope is
+
+	marker   uint8 0x00
+	version  uint8 EnvelopeVersion
+	codec    uint8 CodecID
+	payload  the message encoded by the codec
+
+Bare amino, which is what nodes that don't know envelopes send, always
+starts with the prefix bytes of the type and amino never makes prefix
+bytes starting with 0x00, so DecodeConsensusMsg tells them apart by the
+first byte and accepts both.
+*/
+const (
+	envelopeMarker     = 0x00
+	envelopeHeaderSize = 3
+
+	// EnvelopeVersion is the version of the envelopes we make
+	EnvelopeVersion = 0x01
+)
+
+// AminoCodec encodes messages in amino, the way gobft always did
+var AminoCodec Codec = aminoCodec{}
+
+var codecs = map[CodecID]Codec{
+	CodecAmino: AminoCodec,
+	CodecProto: ProtoCodec,
 }
 
+// wireCodec holds the Codec Bytes encodes with, see SetWireCodec
+var wireCodec atomic.Value
+
+// SetWireCodec sets the Codec ConsensusMessage.Bytes encodes with. Messages
+// are put in an envelope so that DecodeConsensusMsg can pick the right
+// Codec. If it's nil, which is the default, messages are encoded in bare
+// amino that nodes of older versions understand.
+// To migrate a network to another codec, upgrade all the nodes first, which
+// then decode both, then set the codec node by node.
+func SetWireCodec(codec Codec) {
+	wireCodec.Store(&codec)
+}
+
+// EncodeConsensusMsg encodes msg with codec in an envelope
+func EncodeConsensusMsg(msg ConsensusMessage, codec Codec) ([]byte, error) {
+	payload, err := codec.Encode(msg)
+	if err != nil {
+		return nil, err
+	}
+	bz := make([]byte, envelopeHeaderSize, envelopeHeaderSize+len(payload))
+	bz[0], bz[1], bz[2] = envelopeMarker, EnvelopeVersion, byte(codec.ID())
+	return append(bz, payload...), nil
+}
+
+// DecodeConsensusMsg decodes bz made by EncodeConsensusMsg with any of the
+// known codecs, or bare amino
 func DecodeConsensusMsg(bz []byte) (msg ConsensusMessage, err error) {
 	if len(bz) > maxMsgSize {
 		return msg, fmt.Errorf("Msg exceeds max size (%d > %d)", len(bz), maxMsgSize)
 	}
+	if len(bz) == 0 || bz[0] != envelopeMarker {
+		return AminoCodec.Decode(bz)
+	}
+	if len(bz) < envelopeHeaderSize {
+		return msg, fmt.Errorf("Truncated envelope")
+	}
+	if bz[1] != EnvelopeVersion {
+		return msg, fmt.Errorf("Unsupported envelope version %d", bz[1])
+	}
+	codec := codecs[CodecID(bz[2])]
+	if codec == nil {
+		return msg, fmt.Errorf("Unknown codec %d", bz[2])
+	}
+	return codec.Decode(bz[envelopeHeaderSize:])
+}
+
+type aminoCodec struct{}
+
+func (aminoCodec) ID() CodecID {
+	return CodecAmino
+}
+
+func (aminoCodec) Encode(msg ConsensusMessage) ([]byte, error) {
+	return cdc.MarshalBinaryBare(msg)
+}
+
+func (aminoCodec) Decode(bz []byte) (msg ConsensusMessage, err error) {
 	err = cdc.UnmarshalBinaryBare(bz, &msg)
 	return
 }
 
+// encode encodes msg with the codec of SetWireCodec
+func encode(msg ConsensusMessage) []byte {
+	codec, _ := wireCodec.Load().(*Codec)
+	if codec == nil || *codec == nil {
+		return cdcEncode(msg)
+	}
+	if common.IsTypedNil(msg) {
+		return nil
+	}
+	bz, err := EncodeConsensusMsg(msg, *codec)
+	if err != nil {
+		panic(err)
+	}
+	return bz
+}
+
 // cdcEncode returns nil if the input is nil, otherwise returns
 // cdc.MustMarshalBinaryBare(item)
 func cdcEncode(item interface{}) []byte {
@@ -0,0 +1,102 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestCodecs(t *testing.T) {
+	assert := assert.New(t)
+
+	names, msgs := goldenMessages()
+	for i, msg := range msgs {
+		encodings := [][]byte{cdcEncode(msg)}
+		for _, codec := range []Codec{AminoCodec, ProtoCodec} {
+			bz, err := EncodeConsensusMsg(msg, codec)
+			assert.Nil(err)
+			assert.Equal([]byte{0x00, EnvelopeVersion, byte(codec.ID())}, bz[:3])
+			encodings = append(encodings, bz)
+		}
+		for _, bz := range encodings {
+			decoded, err := DecodeConsensusMsg(bz)
+			assert.Nil(err, names[i])
+			assert.Equal(msg.SignBytes(goldenChainID), decoded.SignBytes(goldenChainID), names[i])
+			assert.Equal(msg.GetSignature(), decoded.GetSignature(), names[i])
+		}
+		// protobuf keeps everything as it is
+		decoded, err := DecodeConsensusMsg(encodings[2])
+		assert.Nil(err)
+		assert.Equal(msg, decoded, names[i])
+	}
+
+	_, err := DecodeConsensusMsg([]byte{0x00, EnvelopeVersion + 1, byte(CodecProto)})
+	assert.NotNil(err)
+	_, err = DecodeConsensusMsg([]byte{0x00, EnvelopeVersion, 0xff})
+	assert.NotNil(err)
+	_, err = DecodeConsensusMsg([]byte{0x00, EnvelopeVersion})
+	assert.NotNil(err)
+	_, err = DecodeConsensusMsg([]byte{0x00, EnvelopeVersion, byte(CodecProto), 0x0a, 0x03, 'f', 'o', 'o'})
+	assert.NotNil(err)
+}
+
+func TestWireCodec(t *testing.T) {
+	assert := assert.New(t)
+	defer SetWireCodec(nil)
+
+	_, msgs := goldenMessages()
+	vote := msgs[0].(*Vote)
+	bare := vote.Bytes()
+	assert.NotEqual(byte(0x00), bare[0])
+
+	SetWireCodec(ProtoCodec)
+	bz := vote.Bytes()
+	assert.Equal([]byte{0x00, EnvelopeVersion, byte(CodecProto)}, bz[:3])
+	decoded, err := DecodeConsensusMsg(bz)
+	assert.Nil(err)
+	assert.Equal(vote, decoded)
+	// bare amino is still understood
+	decoded, err = DecodeConsensusMsg(bare)
+	assert.Nil(err)
+	assert.Equal(vote.Digest(), decoded.Digest())
+
+	SetWireCodec(nil)
+	assert.Equal(bare, vote.Bytes())
+}
+
+// TestProtoInterop decodes what ProtoCodec makes with the protobuf library
+func TestProtoInterop(t *testing.T) {
+	assert := assert.New(t)
+
+	_, msgs := goldenMessages()
+	vote := msgs[0].(*Vote)
+	bz, err := ProtoCodec.Encode(vote)
+	assert.Nil(err)
+
+	any := &anypb.Any{}
+	assert.Nil(proto.Unmarshal(bz, any))
+	assert.Equal("gobft/Vote", any.TypeUrl)
+
+	b := any.Value
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		assert.True(n > 0)
+		b = b[n:]
+		if num == 4 {
+			assert.Equal(protowire.BytesType, typ)
+			v, n := protowire.ConsumeBytes(b)
+			ts := &timestamppb.Timestamp{}
+			assert.Nil(proto.Unmarshal(v, ts))
+			assert.True(vote.Timestamp.Equal(ts.AsTime()))
+			b = b[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		assert.True(n >= 0)
+		b = b[n:]
+	}
+}
@@ -0,0 +1,281 @@
+package message
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/coschain/gobft/common"
+)
+
+// Evidence is a proof that a validator misbehaved. It's made of votes
+// signed by the offender and signed by the validator who reported it.
+type Evidence interface {
+	ConsensusMessage
+	// Height returns the height at which the misbehaviour happened
+	Height() int64
+	// Offender returns the validator who misbehaved
+	Offender() PubKey
+	// Votes returns the signed votes that prove the misbehaviour
+	Votes() []*Vote
+	// Hash identifies the misbehaviour no matter who reported it
+	Hash() []byte
+}
+
+/*
+conflictingVotes is what evidence of a validator signing two conflicting
+votes is made of: the offender, its two votes ordered by their
+ProposedData, and the reporter with its signature. It's the part
+DuplicateVoteEvidence and ProposerEquivocationEvidence share, each of
+them only checks what its votes must be on top of it.
+*/
+type conflictingVotes struct {
+	offender  PubKey
+	a, b      *Vote
+	reporter  PubKey
+	signature []byte
+}
+
+// orderVotes orders a and b by their ProposedData so that the same pair of
+// votes always makes the same evidence
+func orderVotes(a, b *Vote) (*Vote, *Vote) {
+	if bytes.Compare(a.Proposed[:], b.Proposed[:]) > 0 {
+		return b, a
+	}
+	return a, b
+}
+
+func (cv conflictingVotes) signBytes(chainID string, name string) []byte {
+	w := newSignBytesWriter(chainID, name)
+	w.writeString(string(cv.offender))
+	w.writeVote(cv.a)
+	w.writeVote(cv.b)
+	w.writeString(string(cv.reporter))
+	return w.Bytes()
+}
+
+func (cv conflictingVotes) hash() []byte {
+	h := sha256.New()
+	h.Write([]byte(cv.offender))
+	h.Write(cv.a.Digest())
+	h.Write(cv.b.Digest())
+	return h.Sum(nil)
+}
+
+// validateBasic checks that the votes are valid votes of the offender for
+// different ProposedData at the same height/round, and that the evidence is
+// signed
+func (cv conflictingVotes) validateBasic() error {
+	if cv.a == nil || cv.b == nil {
+		return errors.New("missing votes in evidence")
+	}
+	if err := cv.a.ValidateBasic(); err != nil {
+		return fmt.Errorf("invalid vote A: %v", err)
+	}
+	if err := cv.b.ValidateBasic(); err != nil {
+		return fmt.Errorf("invalid vote B: %v", err)
+	}
+	if cv.a.Address != cv.offender || cv.b.Address != cv.offender {
+		return errors.New("votes are not from the offender")
+	}
+	if cv.a.Height != cv.b.Height || cv.a.Round != cv.b.Round {
+		return fmt.Errorf("votes are for different rounds: %d/%d vs %d/%d",
+			cv.a.Height, cv.a.Round, cv.b.Height, cv.b.Round)
+	}
+	if cv.a.Proposed == cv.b.Proposed {
+		return errors.New("votes are for the same ProposedData")
+	}
+	if cv.reporter == "" {
+		return errors.New("missing reporter")
+	}
+	if len(cv.signature) == 0 {
+		return errors.New("missing signature")
+	}
+	return nil
+}
+
+func (cv conflictingVotes) format(name string) string {
+	return fmt.Sprintf("%s{%v %v %v %v %X}",
+		name,
+		cv.offender,
+		cv.a,
+		cv.b,
+		cv.reporter,
+		common.Fingerprint(cv.signature),
+	)
+}
+
+// DuplicateVoteEvidence contains evidence that a validator signed two
+// votes for different ProposedData at the same height/round/type. It's
+// signed by the validator who detected it.
+type DuplicateVoteEvidence struct {
+	PubKey    PubKey `json:"pub_key"`
+	VoteA     *Vote  `json:"vote_a"`
+	VoteB     *Vote  `json:"vote_b"`
+	Reporter  PubKey `json:"reporter"`
+	Signature []byte `json:"signature"`
+}
+
+// NewDuplicateVoteEvidence creates evidence from two conflicting votes, see
+// orderVotes
+func NewDuplicateVoteEvidence(voteA, voteB *Vote) *DuplicateVoteEvidence {
+	voteA, voteB = orderVotes(voteA, voteB)
+	return &DuplicateVoteEvidence{
+		PubKey: voteA.Address,
+		VoteA:  voteA,
+		VoteB:  voteB,
+	}
+}
+
+func (dve *DuplicateVoteEvidence) conflict() conflictingVotes {
+	return conflictingVotes{dve.PubKey, dve.VoteA, dve.VoteB, dve.Reporter, dve.Signature}
+}
+
+func (dve *DuplicateVoteEvidence) SetSigner(key PubKey) {
+	dve.Reporter = key
+}
+
+func (dve *DuplicateVoteEvidence) GetSigner() PubKey {
+	return dve.Reporter
+}
+
+func (dve *DuplicateVoteEvidence) SetSignature(sig []byte) {
+	dve.Signature = sig
+}
+
+func (dve *DuplicateVoteEvidence) GetSignature() []byte {
+	return dve.Signature
+}
+
+func (dve *DuplicateVoteEvidence) SignBytes(chainID string) []byte {
+	return dve.conflict().signBytes(chainID, "gobft/DuplicateVoteEvidence")
+}
+
+func (dve *DuplicateVoteEvidence) Digest() []byte {
+	return digest(dve)
+}
+
+func (dve *DuplicateVoteEvidence) Bytes() []byte {
+	return encode(dve)
+}
+
+// Height returns the height at which the votes were signed
+func (dve *DuplicateVoteEvidence) Height() int64 {
+	return dve.VoteA.Height
+}
+
+func (dve *DuplicateVoteEvidence) Offender() PubKey {
+	return dve.PubKey
+}
+
+func (dve *DuplicateVoteEvidence) Votes() []*Vote {
+	return []*Vote{dve.VoteA, dve.VoteB}
+}
+
+func (dve *DuplicateVoteEvidence) Hash() []byte {
+	return dve.conflict().hash()
+}
+
+// ValidateBasic performs basic validation that doesn't involve state data.
+// Does not actually check the cryptographic signatures.
+func (dve *DuplicateVoteEvidence) ValidateBasic() error {
+	if err := dve.conflict().validateBasic(); err != nil {
+		return err
+	}
+	if dve.VoteA.Type != dve.VoteB.Type {
+		return fmt.Errorf("votes are of different types: %d vs %d", dve.VoteA.Type, dve.VoteB.Type)
+	}
+	return nil
+}
+
+func (dve *DuplicateVoteEvidence) String() string {
+	return dve.conflict().format("DuplicateVoteEvidence")
+}
+
+// ProposerEquivocationEvidence contains evidence that a proposer signed two
+// proposals for different ProposedData at the same height/round. It's signed
+// by the validator who detected it.
+type ProposerEquivocationEvidence struct {
+	Proposer  PubKey `json:"proposer"`
+	ProposalA *Vote  `json:"proposal_a"`
+	ProposalB *Vote  `json:"proposal_b"`
+	Reporter  PubKey `json:"reporter"`
+	Signature []byte `json:"signature"`
+}
+
+// NewProposerEquivocationEvidence creates evidence from two conflicting
+// proposals, see orderVotes
+func NewProposerEquivocationEvidence(proposalA, proposalB *Vote) *ProposerEquivocationEvidence {
+	proposalA, proposalB = orderVotes(proposalA, proposalB)
+	return &ProposerEquivocationEvidence{
+		Proposer:  proposalA.Address,
+		ProposalA: proposalA,
+		ProposalB: proposalB,
+	}
+}
+
+func (pee *ProposerEquivocationEvidence) conflict() conflictingVotes {
+	return conflictingVotes{pee.Proposer, pee.ProposalA, pee.ProposalB, pee.Reporter, pee.Signature}
+}
+
+func (pee *ProposerEquivocationEvidence) SetSigner(key PubKey) {
+	pee.Reporter = key
+}
+
+func (pee *ProposerEquivocationEvidence) GetSigner() PubKey {
+	return pee.Reporter
+}
+
+func (pee *ProposerEquivocationEvidence) SetSignature(sig []byte) {
+	pee.Signature = sig
+}
+
+func (pee *ProposerEquivocationEvidence) GetSignature() []byte {
+	return pee.Signature
+}
+
+func (pee *ProposerEquivocationEvidence) SignBytes(chainID string) []byte {
+	return pee.conflict().signBytes(chainID, "gobft/ProposerEquivocationEvidence")
+}
+
+func (pee *ProposerEquivocationEvidence) Digest() []byte {
+	return digest(pee)
+}
+
+func (pee *ProposerEquivocationEvidence) Bytes() []byte {
+	return encode(pee)
+}
+
+// Height returns the height at which the proposals were signed
+func (pee *ProposerEquivocationEvidence) Height() int64 {
+	return pee.ProposalA.Height
+}
+
+func (pee *ProposerEquivocationEvidence) Offender() PubKey {
+	return pee.Proposer
+}
+
+func (pee *ProposerEquivocationEvidence) Votes() []*Vote {
+	return []*Vote{pee.ProposalA, pee.ProposalB}
+}
+
+func (pee *ProposerEquivocationEvidence) Hash() []byte {
+	return pee.conflict().hash()
+}
+
+// ValidateBasic performs basic validation that doesn't involve state data.
+// Does not actually check the cryptographic signatures.
+func (pee *ProposerEquivocationEvidence) ValidateBasic() error {
+	if err := pee.conflict().validateBasic(); err != nil {
+		return err
+	}
+	if pee.ProposalA.Type != ProposalType || pee.ProposalB.Type != ProposalType {
+		return errors.New("votes in evidence are not proposals")
+	}
+	return nil
+}
+
+func (pee *ProposerEquivocationEvidence) String() string {
+	return pee.conflict().format("ProposerEquivocationEvidence")
+}
@@ -1,9 +1,6 @@
 package message
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"time"
@@ -16,6 +13,9 @@ type PubKey string
 
 type ProposedData [32]byte
 
+// ValSetHash identifies the validator set a vote is signed under
+type ValSetHash [32]byte
+
 var NilData ProposedData
 
 func (pd ProposedData) IsNil() bool {
@@ -53,8 +53,13 @@ type Vote struct {
 	Timestamp time.Time    `json:"timestamp"`
 	Proposed  ProposedData `json:"proposed_data"` // zero if vote is nil.
 	Prev      ProposedData `json:"prev"`
+	POLRound  int          `json:"pol_round"` // -1 if there's no POL for Proposed. Only used by proposals.
+	ValSet    ValSetHash   `json:"valset"`    // hash of the validator set of Height
 	Address   PubKey       `json:"pub_key"`
 	Signature []byte       `json:"signature"`
+	// AggSignature of AggSignBytes by the IAggPrivValidator of a precommit.
+	// Optional and not covered by Signature.
+	AggSignature []byte `json:"agg_signature,omitempty"`
 }
 
 func NewVote(t VoteType, height int64, round int, proposed *ProposedData, prev *ProposedData) *Vote {
@@ -65,6 +70,7 @@ func NewVote(t VoteType, height int64, round int, proposed *ProposedData, prev *
 		Timestamp: common.Now(),
 		Proposed:  *proposed,
 		Prev:      *prev,
+		POLRound:  -1,
 	}
 }
 
@@ -84,23 +90,37 @@ func (v *Vote) GetSignature() []byte {
 	return v.Signature
 }
 
+func (v *Vote) SignBytes(chainID string) []byte {
+	w := newSignBytesWriter(chainID, "gobft/Vote")
+	w.writeVoteFields(v)
+	return w.Bytes()
+}
+
 func (v *Vote) Digest() []byte {
-	buf := &bytes.Buffer{}
-	binary.Write(buf, binary.BigEndian, v.Type)
-	binary.Write(buf, binary.BigEndian, v.Height)
-	binary.Write(buf, binary.BigEndian, v.Round)
-	binary.Write(buf, binary.BigEndian, v.Timestamp)
-	binary.Write(buf, binary.BigEndian, v.Proposed)
-	binary.Write(buf, binary.BigEndian, v.Prev)
-	binary.Write(buf, binary.BigEndian, v.Address)
-	h := sha256.Sum256(buf.Bytes())
-	return h[:]
+	return digest(v)
+}
+
+// AggSignBytes returns what the aggregate signature of a precommit is signed
+// over. Unlike SignBytes, they're the same for all the precommits of the same
+// data in a round, so that their signatures can be aggregated into a
+// CommitCertificate.
+func (v *Vote) AggSignBytes(chainID string) []byte {
+	return aggSignBytes(chainID, v.Height, v.Round, v.Proposed, v.Prev, v.ValSet)
+}
+
+// AggSignDigest is the digest of AggSignBytes handed to
+// IAggPrivValidator.AggSign
+func (v *Vote) AggSignDigest(chainID string) []byte {
+	return aggSignDigest(chainID, v.Height, v.Round, v.Proposed, v.Prev, v.ValSet)
 }
 
 func (v *Vote) Copy() *Vote {
 	copy := *v
 	copy.Signature = make([]byte, 0, len(v.Signature))
 	copy.Signature = append(copy.Signature, v.Signature...)
+	if v.AggSignature != nil {
+		copy.AggSignature = append([]byte(nil), v.AggSignature...)
+	}
 	return &copy
 }
 
@@ -143,6 +163,9 @@ func (vote *Vote) ValidateBasic() error {
 	if vote.Round < 0 {
 		return errors.New("Negative Round")
 	}
+	if vote.POLRound < -1 {
+		return errors.New("Invalid POLRound")
+	}
 
 	// NOTE: Timestamp validation is subtle and handled elsewhere.
 
@@ -153,6 +176,9 @@ func (vote *Vote) ValidateBasic() error {
 	if len(vote.Signature) == 0 {
 		return errors.New("Missing vote signature")
 	}
+	if len(vote.AggSignature) != 0 && (vote.Type != PrecommitType || vote.Proposed.IsNil()) {
+		return errors.New("Aggregate signature of a vote other than a non-nil precommit")
+	}
 	//if len(vote.Signature) > MaxSignatureSize {
 	//	return fmt.Errorf("Signature is too big (max: %d)", MaxSignatureSize)
 	//}
@@ -160,17 +186,60 @@ func (vote *Vote) ValidateBasic() error {
 }
 
 func (vote *Vote) Bytes() []byte {
-	return cdcEncode(vote)
+	return encode(vote)
 }
 
 // Commit contains the evidence that a block was committed by a set of validators.
+// It's either the precommits or, if there's one, a CommitCertificate of them.
 type Commit struct {
-	ProposedData ProposedData `json:"proposed_data"`
-	Prev         ProposedData `json:"prev"`
-	Precommits   []*Vote      `json:"precommits"`
-	CommitTime   time.Time    `json:"committime"`
-	Address      PubKey       `json:"address"`
-	Signature    []byte       `json:"signature"`
+	ProposedData ProposedData       `json:"proposed_data"`
+	Prev         ProposedData       `json:"prev"`
+	Precommits   []*Vote            `json:"precommits"`
+	ValSet       ValSetHash         `json:"valset"` // hash of the validator set the precommits are signed under
+	CommitTime   time.Time          `json:"committime"`
+	Address      PubKey             `json:"address"`
+	Signature    []byte             `json:"signature"`
+	Certificate  *CommitCertificate `json:"certificate,omitempty"`
+}
+
+/*
+CommitCertificate stands for the precommits of a Commit in a compact
+way: which validators precommitted and the aggregate of their
+AggSignatures, which is verified at once with the IAggregator.
+
+Signers is indexed as the validator set of the height. Each signer signed
+Commit.AggSignDigest, i.e. the data, the previous data and the validator
+set of the Commit at Height and Round.
+*/
+type CommitCertificate struct {
+	Height       int64            `json:"height"`
+	Round        int              `json:"round"`
+	Signers      *common.BitArray `json:"signers"`
+	AggSignature []byte           `json:"agg_signature"`
+}
+
+// ValidateBasic performs basic validation. Does not actually check the
+// aggregate signature.
+func (cert *CommitCertificate) ValidateBasic() error {
+	if cert.Height < 0 {
+		return errors.New("negative certificate height")
+	}
+	if cert.Round < 0 {
+		return errors.New("negative certificate round")
+	}
+	if cert.Signers == nil {
+		return errors.New("missing certificate signers")
+	}
+	if err := cert.Signers.ValidateBasic(); err != nil {
+		return err
+	}
+	if cert.Signers.Count() == 0 {
+		return errors.New("no signers in certificate")
+	}
+	if len(cert.AggSignature) == 0 {
+		return errors.New("missing certificate signature")
+	}
+	return nil
 }
 
 func (commit *Commit) SetSigner(key PubKey) {
@@ -189,21 +258,35 @@ func (commit *Commit) GetSignature() []byte {
 	return commit.Signature
 }
 
+func (commit *Commit) SignBytes(chainID string) []byte {
+	w := newSignBytesWriter(chainID, "gobft/Commit")
+	w.Write(commit.ProposedData[:])
+	w.Write(commit.Prev[:])
+	w.writeVotes(commit.Precommits)
+	w.Write(commit.ValSet[:])
+	w.writeTime(commit.CommitTime)
+	w.writeString(string(commit.Address))
+	w.writeCertificate(commit.Certificate)
+	return w.Bytes()
+}
+
 func (commit *Commit) Digest() []byte {
-	h := sha256.New()
-	h.Write(commit.ProposedData[:])
-	h.Write(commit.Prev[:])
-	for i := range commit.Precommits {
-		h.Write(commit.Precommits[i].Bytes())
+	return digest(commit)
+}
+
+// AggSignDigest is the digest the signers of the Certificate signed, see
+// Vote.AggSignDigest. It's only meaningful for a Commit with a Certificate.
+func (commit *Commit) AggSignDigest(chainID string) []byte {
+	var height int64
+	var round int
+	if commit.Certificate != nil {
+		height, round = commit.Certificate.Height, commit.Certificate.Round
 	}
-	b, _ := commit.CommitTime.MarshalBinary()
-	h.Write(b)
-	h.Write([]byte(commit.Address))
-	return h.Sum(nil)
+	return aggSignDigest(chainID, height, round, commit.ProposedData, commit.Prev, commit.ValSet)
 }
 
 func (commit *Commit) Bytes() []byte {
-	return cdcEncode(commit)
+	return encode(commit)
 }
 
 // FirstPrecommit returns the first non-nil precommit in the commit.
@@ -224,6 +307,9 @@ func (commit *Commit) FirstPrecommit() *Vote {
 
 // Height returns the height of the commit
 func (commit *Commit) Height() int64 {
+	if commit.Certificate != nil {
+		return commit.Certificate.Height
+	}
 	if len(commit.Precommits) == 0 {
 		return 0
 	}
@@ -232,6 +318,9 @@ func (commit *Commit) Height() int64 {
 
 // Round returns the round of the commit
 func (commit *Commit) Round() int {
+	if commit.Certificate != nil {
+		return commit.Certificate.Round
+	}
 	if len(commit.Precommits) == 0 {
 		return 0
 	}
@@ -243,7 +332,8 @@ func (commit *Commit) Type() byte {
 	return byte(PrecommitType)
 }
 
-// Size returns the number of votes in the commit
+// Size returns the number of votes in the commit, which is 0 if it has a
+// Certificate
 func (commit *Commit) Size() int {
 	if commit == nil {
 		return 0
@@ -256,9 +346,9 @@ func (commit *Commit) GetByIndex(index int) *Vote {
 	return commit.Precommits[index]
 }
 
-// IsCommit returns true if there is at least one vote
+// IsCommit returns true if there is at least one vote or a Certificate
 func (commit *Commit) IsCommit() bool {
-	return len(commit.Precommits) != 0
+	return len(commit.Precommits) != 0 || commit.Certificate != nil
 }
 
 // ValidateBasic performs basic validation that doesn't involve state data.
@@ -267,7 +357,14 @@ func (commit *Commit) ValidateBasic() error {
 	if commit.ProposedData.IsNil() {
 		return errors.New("commit cannot be for nil block")
 	}
-	if len(commit.Precommits) == 0 {
+	if commit.Certificate != nil {
+		if len(commit.Precommits) != 0 {
+			return errors.New("both precommits and certificate in commit")
+		}
+		if err := commit.Certificate.ValidateBasic(); err != nil {
+			return err
+		}
+	} else if len(commit.Precommits) == 0 {
 		return errors.New("no precommits in commit")
 	}
 	height, round := commit.Height(), commit.Round()
@@ -297,6 +394,9 @@ func (commit *Commit) ValidateBasic() error {
 		if precommit.Prev != commit.Prev {
 			return errors.New("invalid Prev of precommit in Commit")
 		}
+		if precommit.ValSet != commit.ValSet {
+			return errors.New("invalid validator set of precommit in Commit")
+		}
 
 		if _, exist := cache[precommit.Address]; exist {
 			return fmt.Errorf("duplicated precommits in Commit")
@@ -315,11 +415,26 @@ func (commit *Commit) ValidateBasic() error {
 	return nil
 }
 
+// ValidateSize checks that commit fits a committee of valNum validators
+func (commit *Commit) ValidateSize(valNum int) error {
+	if len(commit.Precommits) > valNum {
+		return errors.New("Too many precommits")
+	}
+	if commit.Certificate != nil && commit.Certificate.Signers.Size() != valNum {
+		return errors.New("Certificate signers size mismatch")
+	}
+	return nil
+}
+
 func (commit *Commit) String() string {
+	votes := len(commit.Precommits)
+	if commit.Certificate != nil {
+		votes = commit.Certificate.Signers.Count()
+	}
 	return fmt.Sprintf("Commit{%v/%v/%02d/%v %X @ %v}",
 		commit.ProposedData,
 		commit.Prev,
-		len(commit.Precommits),
+		votes,
 		commit.Address,
 		common.Fingerprint(commit.Signature),
 		commit.CommitTime,
@@ -332,10 +447,11 @@ type FetchVotesReq struct {
 	Round  int      `json:"round"`
 	// Invoker indicates who wants the votes
 	Invoker PubKey `json:"invoker"`
-	// Voters indicates the validators from whom @Invoker currently receive vote
-	Voters    []PubKey  `json:"voters"`
-	Time      time.Time `json:"time"`
-	Signature []byte    `json:"signature"`
+	// Voters indicates the validators from whom @Invoker currently receive
+	// vote, indexed in the order of ICommittee.GetValidatorList
+	Voters    *common.BitArray `json:"voters"`
+	Time      time.Time        `json:"time"`
+	Signature []byte           `json:"signature"`
 }
 
 func (fvr *FetchVotesReq) SetSigner(key PubKey) {
@@ -354,22 +470,23 @@ func (fvr *FetchVotesReq) GetSignature() []byte {
 	return fvr.Signature
 }
 
+func (fvr *FetchVotesReq) SignBytes(chainID string) []byte {
+	w := newSignBytesWriter(chainID, "gobft/FetchVotesReq")
+	w.writeUint8(uint8(fvr.Type))
+	w.writeInt64(fvr.Height)
+	w.writeInt64(int64(fvr.Round))
+	w.writeString(string(fvr.Invoker))
+	w.writeBitArray(fvr.Voters)
+	w.writeTime(fvr.Time)
+	return w.Bytes()
+}
+
 func (fvr *FetchVotesReq) Digest() []byte {
-	buf := &bytes.Buffer{}
-	binary.Write(buf, binary.BigEndian, fvr.Type)
-	binary.Write(buf, binary.BigEndian, fvr.Height)
-	binary.Write(buf, binary.BigEndian, fvr.Round)
-	binary.Write(buf, binary.BigEndian, fvr.Invoker)
-	for i := range fvr.Voters {
-		binary.Write(buf, binary.BigEndian, fvr.Voters[i])
-	}
-	binary.Write(buf, binary.BigEndian, fvr.Time)
-	h := sha256.Sum256(buf.Bytes())
-	return h[:]
+	return digest(fvr)
 }
 
 func (fvr *FetchVotesReq) Bytes() []byte {
-	return cdcEncode(fvr)
+	return encode(fvr)
 }
 
 // ValidateBasic performs basic validation that doesn't involve state data.
@@ -382,8 +499,8 @@ func (fvr *FetchVotesReq) ValidateBasic() error {
 		return errors.New("Invoker is empty")
 	}
 
-	if len(fvr.Voters) > common.ValNum {
-		return errors.New("Voters list too long")
+	if err := fvr.Voters.ValidateBasic(); err != nil {
+		return err
 	}
 
 	if len(fvr.Signature) == 0 {
@@ -392,13 +509,21 @@ func (fvr *FetchVotesReq) ValidateBasic() error {
 	return nil
 }
 
+// ValidateSize checks that fvr fits a committee of valNum validators
+func (fvr *FetchVotesReq) ValidateSize(valNum int) error {
+	if fvr.Voters != nil && fvr.Voters.Size() != valNum {
+		return errors.New("Voters size mismatch")
+	}
+	return nil
+}
+
 func (fvr *FetchVotesReq) String() string {
-	return fmt.Sprintf("FetchVotesReq{%v/%d/%02d/%v %d %v %v}",
+	return fmt.Sprintf("FetchVotesReq{%v/%d/%02d/%v %v %v %v}",
 		fvr.Type,
 		fvr.Height,
 		fvr.Round,
 		fvr.Invoker,
-		len(fvr.Voters),
+		fvr.Voters,
 		common.Fingerprint(fvr.Signature),
 		fvr.Time,
 	)
@@ -430,22 +555,23 @@ func (fvr *FetchVotesRsp) GetSignature() []byte {
 	return fvr.Signature
 }
 
+func (fvr *FetchVotesRsp) SignBytes(chainID string) []byte {
+	w := newSignBytesWriter(chainID, "gobft/FetchVotesRsp")
+	w.writeUint8(uint8(fvr.Type))
+	w.writeInt64(fvr.Height)
+	w.writeInt64(int64(fvr.Round))
+	w.writeString(string(fvr.Responser))
+	w.writeVotes(fvr.MissingVotes)
+	w.writeTime(fvr.Time)
+	return w.Bytes()
+}
+
 func (fvr *FetchVotesRsp) Digest() []byte {
-	buf := &bytes.Buffer{}
-	binary.Write(buf, binary.BigEndian, fvr.Type)
-	binary.Write(buf, binary.BigEndian, fvr.Height)
-	binary.Write(buf, binary.BigEndian, fvr.Round)
-	binary.Write(buf, binary.BigEndian, fvr.Responser)
-	for i := range fvr.MissingVotes {
-		binary.Write(buf, binary.BigEndian, fvr.MissingVotes[i].Digest())
-	}
-	binary.Write(buf, binary.BigEndian, fvr.Time)
-	h := sha256.Sum256(buf.Bytes())
-	return h[:]
+	return digest(fvr)
 }
 
 func (fvr *FetchVotesRsp) Bytes() []byte {
-	return cdcEncode(fvr)
+	return encode(fvr)
 }
 
 // ValidateBasic performs basic validation that doesn't involve state data.
@@ -458,16 +584,20 @@ func (fvr *FetchVotesRsp) ValidateBasic() error {
 		return errors.New("Responser is empty")
 	}
 
-	if len(fvr.MissingVotes) > common.ValNum {
-		return errors.New("Voters list too long")
-	}
-
 	if len(fvr.Signature) == 0 {
 		return errors.New("Missing signature")
 	}
 	return nil
 }
 
+// ValidateSize checks that fvr fits a committee of valNum validators
+func (fvr *FetchVotesRsp) ValidateSize(valNum int) error {
+	if len(fvr.MissingVotes) > valNum {
+		return errors.New("Too many missing votes")
+	}
+	return nil
+}
+
 func (fvr *FetchVotesRsp) String() string {
 	return fmt.Sprintf("FetchVotesRsp{%v/%d/%02d/%v %d %v %v}",
 		fvr.Type,
@@ -479,3 +609,274 @@ func (fvr *FetchVotesRsp) String() string {
 		fvr.Time,
 	)
 }
+
+// NewRoundStep announces the height/round/step of a validator along with the
+// validators it has prevotes and precommits from in that round, so that
+// others know whom to fetch missing votes from. Validators are indexed in
+// the order of ICommittee.GetValidatorList.
+type NewRoundStep struct {
+	Height     int64            `json:"height"`
+	Round      int              `json:"round"`
+	Step       uint8            `json:"step"`
+	Prevotes   *common.BitArray `json:"prevotes"`
+	Precommits *common.BitArray `json:"precommits"`
+	Address    PubKey           `json:"address"`
+	Time       time.Time        `json:"time"`
+	Signature  []byte           `json:"signature"`
+}
+
+func (nrs *NewRoundStep) SetSigner(key PubKey) {
+	nrs.Address = key
+}
+
+func (nrs *NewRoundStep) GetSigner() PubKey {
+	return nrs.Address
+}
+
+func (nrs *NewRoundStep) SetSignature(sig []byte) {
+	nrs.Signature = sig
+}
+
+func (nrs *NewRoundStep) GetSignature() []byte {
+	return nrs.Signature
+}
+
+func (nrs *NewRoundStep) SignBytes(chainID string) []byte {
+	w := newSignBytesWriter(chainID, "gobft/NewRoundStep")
+	w.writeInt64(nrs.Height)
+	w.writeInt64(int64(nrs.Round))
+	w.writeUint8(nrs.Step)
+	w.writeBitArray(nrs.Prevotes)
+	w.writeBitArray(nrs.Precommits)
+	w.writeString(string(nrs.Address))
+	w.writeTime(nrs.Time)
+	return w.Bytes()
+}
+
+func (nrs *NewRoundStep) Digest() []byte {
+	return digest(nrs)
+}
+
+func (nrs *NewRoundStep) Bytes() []byte {
+	return encode(nrs)
+}
+
+// ValidateBasic performs basic validation that doesn't involve state data.
+// Does not actually check the cryptographic signatures.
+func (nrs *NewRoundStep) ValidateBasic() error {
+	if nrs.Height < 0 {
+		return errors.New("Negative Height")
+	}
+	if nrs.Round < 0 {
+		return errors.New("Negative Round")
+	}
+	if err := nrs.Prevotes.ValidateBasic(); err != nil {
+		return err
+	}
+	if err := nrs.Precommits.ValidateBasic(); err != nil {
+		return err
+	}
+	if nrs.Address == "" {
+		return errors.New("Missing address")
+	}
+	if len(nrs.Signature) == 0 {
+		return errors.New("Missing signature")
+	}
+	return nil
+}
+
+// ValidateSize checks that nrs fits a committee of valNum validators
+func (nrs *NewRoundStep) ValidateSize(valNum int) error {
+	if nrs.Prevotes != nil && nrs.Prevotes.Size() != valNum {
+		return errors.New("Prevotes size mismatch")
+	}
+	if nrs.Precommits != nil && nrs.Precommits.Size() != valNum {
+		return errors.New("Precommits size mismatch")
+	}
+	return nil
+}
+
+func (nrs *NewRoundStep) String() string {
+	return fmt.Sprintf("NewRoundStep{%d/%02d/%d %v %v %v %v %v}",
+		nrs.Height,
+		nrs.Round,
+		nrs.Step,
+		nrs.Address,
+		nrs.Prevotes,
+		nrs.Precommits,
+		common.Fingerprint(nrs.Signature),
+		nrs.Time,
+	)
+}
+
+// FetchCommitsReq asks for the Commits of heights From to To inclusive. It's
+// sent by a validator that fell behind to catch up with the others, who
+// answer with the Commits they have.
+type FetchCommitsReq struct {
+	From      int64     `json:"from"`
+	To        int64     `json:"to"`
+	Invoker   PubKey    `json:"invoker"`
+	Time      time.Time `json:"time"`
+	Signature []byte    `json:"signature"`
+}
+
+func (fcr *FetchCommitsReq) SetSigner(key PubKey) {
+	fcr.Invoker = key
+}
+
+func (fcr *FetchCommitsReq) GetSigner() PubKey {
+	return fcr.Invoker
+}
+
+func (fcr *FetchCommitsReq) SetSignature(sig []byte) {
+	fcr.Signature = sig
+}
+
+func (fcr *FetchCommitsReq) GetSignature() []byte {
+	return fcr.Signature
+}
+
+func (fcr *FetchCommitsReq) SignBytes(chainID string) []byte {
+	w := newSignBytesWriter(chainID, "gobft/FetchCommitsReq")
+	w.writeInt64(fcr.From)
+	w.writeInt64(fcr.To)
+	w.writeString(string(fcr.Invoker))
+	w.writeTime(fcr.Time)
+	return w.Bytes()
+}
+
+func (fcr *FetchCommitsReq) Digest() []byte {
+	return digest(fcr)
+}
+
+func (fcr *FetchCommitsReq) Bytes() []byte {
+	return encode(fcr)
+}
+
+// ValidateBasic performs basic validation that doesn't involve state data.
+// Does not actually check the cryptographic signatures.
+func (fcr *FetchCommitsReq) ValidateBasic() error {
+	if fcr.From < 1 {
+		return errors.New("Invalid From")
+	}
+	if fcr.To < fcr.From {
+		return errors.New("To is less than From")
+	}
+	if fcr.Invoker == "" {
+		return errors.New("Invoker is empty")
+	}
+	if len(fcr.Signature) == 0 {
+		return errors.New("Missing signature")
+	}
+	return nil
+}
+
+func (fcr *FetchCommitsReq) String() string {
+	return fmt.Sprintf("FetchCommitsReq{%d~%d %v %v %v}",
+		fcr.From,
+		fcr.To,
+		fcr.Invoker,
+		common.Fingerprint(fcr.Signature),
+		fcr.Time,
+	)
+}
+
+// MaxVoteBatchSize is the max number of votes in a VoteBatch
+const MaxVoteBatchSize = 1024
+
+// VoteBatch carries any mix of proposals, prevotes and precommits of one or
+// more heights and rounds in a single message, e.g. when retransmitting or
+// helping a validator catch up. Every vote is signed by its own validator and
+// handled as if it's received alone. Sender signs the batch as a whole.
+type VoteBatch struct {
+	Votes     []*Vote   `json:"votes"`
+	Sender    PubKey    `json:"sender"`
+	Time      time.Time `json:"time"`
+	Signature []byte    `json:"signature"`
+}
+
+func NewVoteBatch(votes []*Vote) *VoteBatch {
+	return &VoteBatch{
+		Votes: votes,
+		Time:  time.Now(),
+	}
+}
+
+func (vb *VoteBatch) SetSigner(key PubKey) {
+	vb.Sender = key
+}
+
+func (vb *VoteBatch) GetSigner() PubKey {
+	return vb.Sender
+}
+
+func (vb *VoteBatch) SetSignature(sig []byte) {
+	vb.Signature = sig
+}
+
+func (vb *VoteBatch) GetSignature() []byte {
+	return vb.Signature
+}
+
+func (vb *VoteBatch) SignBytes(chainID string) []byte {
+	w := newSignBytesWriter(chainID, "gobft/VoteBatch")
+	w.writeVotes(vb.Votes)
+	w.writeString(string(vb.Sender))
+	w.writeTime(vb.Time)
+	return w.Bytes()
+}
+
+func (vb *VoteBatch) Digest() []byte {
+	return digest(vb)
+}
+
+func (vb *VoteBatch) Bytes() []byte {
+	return encode(vb)
+}
+
+// ValidateBasic performs basic validation that doesn't involve state data.
+// Does not actually check the cryptographic signatures.
+func (vb *VoteBatch) ValidateBasic() error {
+	if len(vb.Votes) == 0 {
+		return errors.New("Empty batch")
+	}
+	if len(vb.Votes) > MaxVoteBatchSize {
+		return errors.New("Too many votes")
+	}
+	type voteKey struct {
+		t      VoteType
+		height int64
+		round  int
+		addr   PubKey
+	}
+	seen := make(map[voteKey]bool, len(vb.Votes))
+	for _, v := range vb.Votes {
+		if v == nil {
+			return errors.New("Nil vote")
+		}
+		if err := v.ValidateBasic(); err != nil {
+			return err
+		}
+		k := voteKey{v.Type, v.Height, v.Round, v.Address}
+		if seen[k] {
+			return errors.New("Duplicated vote")
+		}
+		seen[k] = true
+	}
+	if vb.Sender == "" {
+		return errors.New("Sender is empty")
+	}
+	if len(vb.Signature) == 0 {
+		return errors.New("Missing signature")
+	}
+	return nil
+}
+
+func (vb *VoteBatch) String() string {
+	return fmt.Sprintf("VoteBatch{%d %v %v %v}",
+		len(vb.Votes),
+		vb.Sender,
+		common.Fingerprint(vb.Signature),
+		vb.Time,
+	)
+}
@@ -0,0 +1,626 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/coschain/gobft/common"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ProtoMessage is a ConsensusMessage that can be encoded in protobuf. Its
+// schema is up to the message, the ones of gobft are in gobft.proto.
+type ProtoMessage interface {
+	ConsensusMessage
+	MarshalProto() []byte
+	UnmarshalProto(bz []byte) error
+}
+
+// ProtoCodec encodes messages in protobuf as an Any of the name they're
+// registered with and their MarshalProto, see gobft.proto
+var ProtoCodec Codec = protoCodec{}
+
+var protoTypes = struct {
+	sync.RWMutex
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+}{
+	byName: make(map[string]reflect.Type),
+	byType: make(map[reflect.Type]string),
+}
+
+func init() {
+	RegisterProtoMessage(&Vote{}, "gobft/Vote")
+	RegisterProtoMessage(&Commit{}, "gobft/Commit")
+	RegisterProtoMessage(&FetchVotesReq{}, "gobft/FetchVotesReq")
+	RegisterProtoMessage(&FetchVotesRsp{}, "gobft/FetchVotesRsp")
+	RegisterProtoMessage(&NewRoundStep{}, "gobft/NewRoundStep")
+	RegisterProtoMessage(&FetchCommitsReq{}, "gobft/FetchCommitsReq")
+	RegisterProtoMessage(&VoteBatch{}, "gobft/VoteBatch")
+	RegisterProtoMessage(&DuplicateVoteEvidence{}, "gobft/DuplicateVoteEvidence")
+	RegisterProtoMessage(&ProposerEquivocationEvidence{}, "gobft/ProposerEquivocationEvidence")
+}
+
+// RegisterProtoMessage lets ProtoCodec carry messages of the type of msg,
+// which must be a pointer, under name
+func RegisterProtoMessage(msg ProtoMessage, name string) {
+	rt := reflect.TypeOf(msg)
+	if rt.Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("proto message %v must be a pointer", rt))
+	}
+	protoTypes.Lock()
+	defer protoTypes.Unlock()
+	if _, ok := protoTypes.byName[name]; ok {
+		panic(fmt.Sprintf("proto message %s registered twice", name))
+	}
+	protoTypes.byName[name] = rt.Elem()
+	protoTypes.byType[rt.Elem()] = name
+}
+
+type protoCodec struct{}
+
+func (protoCodec) ID() CodecID {
+	return CodecProto
+}
+
+func (protoCodec) Encode(msg ConsensusMessage) ([]byte, error) {
+	pm, ok := msg.(ProtoMessage)
+	if !ok {
+		return nil, fmt.Errorf("%T can't be encoded in protobuf", msg)
+	}
+	protoTypes.RLock()
+	name, ok := protoTypes.byType[reflect.TypeOf(msg).Elem()]
+	protoTypes.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%T isn't registered for protobuf", msg)
+	}
+	w := &protoWriter{}
+	w.string(1, name)
+	w.bytes(2, pm.MarshalProto())
+	return w.b, nil
+}
+
+func (protoCodec) Decode(bz []byte) (ConsensusMessage, error) {
+	var name string
+	var value []byte
+	err := readProto(bz, func(f protoField) error {
+		switch f.num {
+		case 1:
+			name = string(f.bytes)
+		case 2:
+			value = f.bytes
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	protoTypes.RLock()
+	rt, ok := protoTypes.byName[name]
+	protoTypes.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown proto message %q", name)
+	}
+	msg := reflect.New(rt).Interface().(ProtoMessage)
+	if err := msg.UnmarshalProto(value); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// protoWriter appends fields in protobuf. Scalars of the zero value are
+// left out as proto3 does.
+type protoWriter struct {
+	b []byte
+}
+
+func (w *protoWriter) varint(num protowire.Number, v uint64) {
+	if v == 0 {
+		return
+	}
+	w.b = protowire.AppendTag(w.b, num, protowire.VarintType)
+	w.b = protowire.AppendVarint(w.b, v)
+}
+
+func (w *protoWriter) int64(num protowire.Number, v int64) {
+	w.varint(num, uint64(v))
+}
+
+func (w *protoWriter) bytes(num protowire.Number, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	w.message(num, v)
+}
+
+func (w *protoWriter) string(num protowire.Number, v string) {
+	w.bytes(num, []byte(v))
+}
+
+// message appends an embedded message, even if it's empty
+func (w *protoWriter) message(num protowire.Number, v []byte) {
+	w.b = protowire.AppendTag(w.b, num, protowire.BytesType)
+	w.b = protowire.AppendBytes(w.b, v)
+}
+
+// time appends a google.protobuf.Timestamp
+func (w *protoWriter) time(num protowire.Number, t time.Time) {
+	ts := &protoWriter{}
+	ts.int64(1, t.Unix())
+	ts.int64(2, int64(t.Nanosecond()))
+	w.message(num, ts.b)
+}
+
+func (w *protoWriter) bitArray(num protowire.Number, ba *common.BitArray) {
+	if ba == nil {
+		return
+	}
+	m := &protoWriter{}
+	m.int64(1, int64(ba.Bits))
+	m.bytes(2, ba.Elems)
+	w.message(num, m.b)
+}
+
+// vote appends v, or an empty Vote if it's nil
+func (w *protoWriter) vote(num protowire.Number, v *Vote) {
+	if v == nil {
+		w.message(num, nil)
+		return
+	}
+	w.message(num, v.MarshalProto())
+}
+
+type protoField struct {
+	num    protowire.Number
+	varint uint64
+	bytes  []byte
+}
+
+func (f protoField) int64() int64 {
+	return int64(f.varint)
+}
+
+func (f protoField) int() int {
+	return int(int64(f.varint))
+}
+
+func (f protoField) string() string {
+	return string(f.bytes)
+}
+
+// copyBytes returns a copy of the bytes, so that the message doesn't hold
+// the buffer it's decoded from
+func (f protoField) copyBytes() []byte {
+	return append([]byte(nil), f.bytes...)
+}
+
+func (f protoField) hash(dst []byte) error {
+	if len(f.bytes) != 0 && len(f.bytes) != len(dst) {
+		return fmt.Errorf("field %d has %d bytes, expected %d", f.num, len(f.bytes), len(dst))
+	}
+	copy(dst, f.bytes)
+	return nil
+}
+
+func (f protoField) time() (t time.Time, err error) {
+	var sec, nsec int64
+	err = readProto(f.bytes, func(f protoField) error {
+		switch f.num {
+		case 1:
+			sec = f.int64()
+		case 2:
+			nsec = f.int64()
+		}
+		return nil
+	})
+	if err != nil {
+		return t, err
+	}
+	if nsec < 0 || nsec >= int64(time.Second) {
+		return t, errors.New("Invalid timestamp")
+	}
+	return time.Unix(sec, nsec).UTC(), nil
+}
+
+func (f protoField) bitArray() (*common.BitArray, error) {
+	ba := &common.BitArray{}
+	err := readProto(f.bytes, func(f protoField) error {
+		switch f.num {
+		case 1:
+			ba.Bits = f.int()
+		case 2:
+			ba.Elems = f.copyBytes()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ba.Elems == nil {
+		ba.Elems = []byte{}
+	}
+	return ba, nil
+}
+
+// vote returns nil for an empty Vote
+func (f protoField) vote() (*Vote, error) {
+	if len(f.bytes) == 0 {
+		return nil, nil
+	}
+	v := &Vote{}
+	return v, v.UnmarshalProto(f.bytes)
+}
+
+func (f protoField) certificate() (*CommitCertificate, error) {
+	cert := &CommitCertificate{}
+	err := readProto(f.bytes, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			cert.Height = f.int64()
+		case 2:
+			cert.Round = f.int()
+		case 3:
+			cert.Signers, err = f.bitArray()
+		case 4:
+			cert.AggSignature = f.copyBytes()
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// readProto calls fn with each field of bz
+func readProto(bz []byte, fn func(f protoField) error) error {
+	for len(bz) > 0 {
+		num, typ, n := protowire.ConsumeTag(bz)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		bz = bz[n:]
+		f := protoField{num: num}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(bz)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(bz)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, bz)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		bz = bz[n:]
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *Vote) MarshalProto() []byte {
+	w := &protoWriter{}
+	w.varint(1, uint64(v.Type))
+	w.int64(2, v.Height)
+	w.int64(3, int64(v.Round))
+	w.time(4, v.Timestamp)
+	w.bytes(5, v.Proposed[:])
+	w.bytes(6, v.Prev[:])
+	w.int64(7, int64(v.POLRound))
+	w.bytes(8, v.ValSet[:])
+	w.string(9, string(v.Address))
+	w.bytes(10, v.Signature)
+	w.bytes(11, v.AggSignature)
+	return w.b
+}
+
+func (v *Vote) UnmarshalProto(bz []byte) error {
+	*v = Vote{}
+	return readProto(bz, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			v.Type = VoteType(f.varint)
+		case 2:
+			v.Height = f.int64()
+		case 3:
+			v.Round = f.int()
+		case 4:
+			v.Timestamp, err = f.time()
+		case 5:
+			err = f.hash(v.Proposed[:])
+		case 6:
+			err = f.hash(v.Prev[:])
+		case 7:
+			v.POLRound = f.int()
+		case 8:
+			err = f.hash(v.ValSet[:])
+		case 9:
+			v.Address = PubKey(f.string())
+		case 10:
+			v.Signature = f.copyBytes()
+		case 11:
+			v.AggSignature = f.copyBytes()
+		}
+		return
+	})
+}
+
+func (commit *Commit) MarshalProto() []byte {
+	w := &protoWriter{}
+	w.bytes(1, commit.ProposedData[:])
+	w.bytes(2, commit.Prev[:])
+	for _, v := range commit.Precommits {
+		w.vote(3, v)
+	}
+	w.bytes(4, commit.ValSet[:])
+	w.time(5, commit.CommitTime)
+	w.string(6, string(commit.Address))
+	w.bytes(7, commit.Signature)
+	if cert := commit.Certificate; cert != nil {
+		c := &protoWriter{}
+		c.int64(1, cert.Height)
+		c.int64(2, int64(cert.Round))
+		c.bitArray(3, cert.Signers)
+		c.bytes(4, cert.AggSignature)
+		w.message(8, c.b)
+	}
+	return w.b
+}
+
+func (commit *Commit) UnmarshalProto(bz []byte) error {
+	*commit = Commit{}
+	return readProto(bz, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			err = f.hash(commit.ProposedData[:])
+		case 2:
+			err = f.hash(commit.Prev[:])
+		case 3:
+			var v *Vote
+			v, err = f.vote()
+			commit.Precommits = append(commit.Precommits, v)
+		case 4:
+			err = f.hash(commit.ValSet[:])
+		case 5:
+			commit.CommitTime, err = f.time()
+		case 6:
+			commit.Address = PubKey(f.string())
+		case 7:
+			commit.Signature = f.copyBytes()
+		case 8:
+			commit.Certificate, err = f.certificate()
+		}
+		return
+	})
+}
+
+func (fvr *FetchVotesReq) MarshalProto() []byte {
+	w := &protoWriter{}
+	w.varint(1, uint64(fvr.Type))
+	w.int64(2, fvr.Height)
+	w.int64(3, int64(fvr.Round))
+	w.string(4, string(fvr.Invoker))
+	w.bitArray(5, fvr.Voters)
+	w.time(6, fvr.Time)
+	w.bytes(7, fvr.Signature)
+	return w.b
+}
+
+func (fvr *FetchVotesReq) UnmarshalProto(bz []byte) error {
+	*fvr = FetchVotesReq{}
+	return readProto(bz, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			fvr.Type = VoteType(f.varint)
+		case 2:
+			fvr.Height = f.int64()
+		case 3:
+			fvr.Round = f.int()
+		case 4:
+			fvr.Invoker = PubKey(f.string())
+		case 5:
+			fvr.Voters, err = f.bitArray()
+		case 6:
+			fvr.Time, err = f.time()
+		case 7:
+			fvr.Signature = f.copyBytes()
+		}
+		return
+	})
+}
+
+func (fvr *FetchVotesRsp) MarshalProto() []byte {
+	w := &protoWriter{}
+	w.varint(1, uint64(fvr.Type))
+	w.int64(2, fvr.Height)
+	w.int64(3, int64(fvr.Round))
+	w.string(4, string(fvr.Responser))
+	for _, v := range fvr.MissingVotes {
+		w.vote(5, v)
+	}
+	w.time(6, fvr.Time)
+	w.bytes(7, fvr.Signature)
+	return w.b
+}
+
+func (fvr *FetchVotesRsp) UnmarshalProto(bz []byte) error {
+	*fvr = FetchVotesRsp{}
+	return readProto(bz, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			fvr.Type = VoteType(f.varint)
+		case 2:
+			fvr.Height = f.int64()
+		case 3:
+			fvr.Round = f.int()
+		case 4:
+			fvr.Responser = PubKey(f.string())
+		case 5:
+			var v *Vote
+			v, err = f.vote()
+			fvr.MissingVotes = append(fvr.MissingVotes, v)
+		case 6:
+			fvr.Time, err = f.time()
+		case 7:
+			fvr.Signature = f.copyBytes()
+		}
+		return
+	})
+}
+
+func (nrs *NewRoundStep) MarshalProto() []byte {
+	w := &protoWriter{}
+	w.int64(1, nrs.Height)
+	w.int64(2, int64(nrs.Round))
+	w.varint(3, uint64(nrs.Step))
+	w.bitArray(4, nrs.Prevotes)
+	w.bitArray(5, nrs.Precommits)
+	w.string(6, string(nrs.Address))
+	w.time(7, nrs.Time)
+	w.bytes(8, nrs.Signature)
+	return w.b
+}
+
+func (nrs *NewRoundStep) UnmarshalProto(bz []byte) error {
+	*nrs = NewRoundStep{}
+	return readProto(bz, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			nrs.Height = f.int64()
+		case 2:
+			nrs.Round = f.int()
+		case 3:
+			nrs.Step = uint8(f.varint)
+		case 4:
+			nrs.Prevotes, err = f.bitArray()
+		case 5:
+			nrs.Precommits, err = f.bitArray()
+		case 6:
+			nrs.Address = PubKey(f.string())
+		case 7:
+			nrs.Time, err = f.time()
+		case 8:
+			nrs.Signature = f.copyBytes()
+		}
+		return
+	})
+}
+
+func (fcr *FetchCommitsReq) MarshalProto() []byte {
+	w := &protoWriter{}
+	w.int64(1, fcr.From)
+	w.int64(2, fcr.To)
+	w.string(3, string(fcr.Invoker))
+	w.time(4, fcr.Time)
+	w.bytes(5, fcr.Signature)
+	return w.b
+}
+
+func (fcr *FetchCommitsReq) UnmarshalProto(bz []byte) error {
+	*fcr = FetchCommitsReq{}
+	return readProto(bz, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			fcr.From = f.int64()
+		case 2:
+			fcr.To = f.int64()
+		case 3:
+			fcr.Invoker = PubKey(f.string())
+		case 4:
+			fcr.Time, err = f.time()
+		case 5:
+			fcr.Signature = f.copyBytes()
+		}
+		return
+	})
+}
+
+func (vb *VoteBatch) MarshalProto() []byte {
+	w := &protoWriter{}
+	for _, v := range vb.Votes {
+		w.vote(1, v)
+	}
+	w.string(2, string(vb.Sender))
+	w.time(3, vb.Time)
+	w.bytes(4, vb.Signature)
+	return w.b
+}
+
+func (vb *VoteBatch) UnmarshalProto(bz []byte) error {
+	*vb = VoteBatch{}
+	return readProto(bz, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			var v *Vote
+			v, err = f.vote()
+			vb.Votes = append(vb.Votes, v)
+		case 2:
+			vb.Sender = PubKey(f.string())
+		case 3:
+			vb.Time, err = f.time()
+		case 4:
+			vb.Signature = f.copyBytes()
+		}
+		return
+	})
+}
+
+func (cv conflictingVotes) marshalProto() []byte {
+	w := &protoWriter{}
+	w.string(1, string(cv.offender))
+	if cv.a != nil {
+		w.vote(2, cv.a)
+	}
+	if cv.b != nil {
+		w.vote(3, cv.b)
+	}
+	w.string(4, string(cv.reporter))
+	w.bytes(5, cv.signature)
+	return w.b
+}
+
+func (cv *conflictingVotes) unmarshalProto(bz []byte) error {
+	*cv = conflictingVotes{}
+	return readProto(bz, func(f protoField) (err error) {
+		switch f.num {
+		case 1:
+			cv.offender = PubKey(f.string())
+		case 2:
+			cv.a, err = f.vote()
+		case 3:
+			cv.b, err = f.vote()
+		case 4:
+			cv.reporter = PubKey(f.string())
+		case 5:
+			cv.signature = f.copyBytes()
+		}
+		return
+	})
+}
+
+func (dve *DuplicateVoteEvidence) MarshalProto() []byte {
+	return dve.conflict().marshalProto()
+}
+
+func (dve *DuplicateVoteEvidence) UnmarshalProto(bz []byte) error {
+	var cv conflictingVotes
+	err := cv.unmarshalProto(bz)
+	*dve = DuplicateVoteEvidence{cv.offender, cv.a, cv.b, cv.reporter, cv.signature}
+	return err
+}
+
+func (pee *ProposerEquivocationEvidence) MarshalProto() []byte {
+	return pee.conflict().marshalProto()
+}
+
+func (pee *ProposerEquivocationEvidence) UnmarshalProto(bz []byte) error {
+	var cv conflictingVotes
+	err := cv.unmarshalProto(bz)
+	*pee = ProposerEquivocationEvidence{cv.offender, cv.a, cv.b, cv.reporter, cv.signature}
+	return err
+}
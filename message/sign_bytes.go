@@ -0,0 +1,196 @@
+package message
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+
+	"github.com/coschain/gobft/common"
+)
+
+// SignBytesVersion is the version of the sign bytes encoding. It's part of
+// the sign bytes so that a signature never verifies under another version.
+const SignBytesVersion uint16 = 1
+
+// signBytesDomain starts the sign bytes of every message
+const signBytesDomain = "gobft"
+
+/*
+Sign bytes are the canonical encoding of a message that is signed. They
+start with a header of
+
+	domain   string "gobft"
+	version  uint16 SignBytesVersion
+	chain ID string
+	type     string the name the message is registered with in the
+	                codec, e.g. "gobft/Vote"
+
+followed by every field of the message but its signature, in the order
+they're declared in, encoded as
+
+	string, []byte  uint32 length followed by the bytes
+	int64, int      int64
+	VoteType, step  uint8
+	ProposedData,
+	ValSetHash      the 32 bytes as they are
+	time.Time       int64 seconds since the Unix epoch followed by uint32
+	                nanoseconds, both in UTC
+	*BitArray       uint8 0 if nil, otherwise uint8 1, int64 number of
+	                bits and []byte of the elements
+	*Vote           uint8 0 if nil, otherwise uint8 1, the fields of the
+	                vote and its signature as []byte
+	[]*Vote         uint32 count followed by each *Vote
+
+except for the Certificate of a Commit, which is left out if it's nil so
+that the sign bytes of a Commit without one are the same as before it
+was added. Otherwise it's uint8 1 followed by its fields.
+
+Vote.AggSignature isn't covered by the sign bytes of the vote. It's a
+signature of the aggregation sign bytes, which have the header of type
+"gobft/CommitCertificate" followed by the height, the round, the
+proposed data, the previous data and the validator set of the
+precommit.
+
+Integers are big-endian, signed ones in two's complement. The digest
+handed to IPrivValidator.Sign and IPubValidator.VerifySig is the SHA-256
+of the sign bytes, see SignDigest. testdata/sign_bytes.json has test
+vectors of every message.
+*/
+type signBytesWriter struct {
+	bytes.Buffer
+}
+
+func newSignBytesWriter(chainID string, msgType string) *signBytesWriter {
+	w := &signBytesWriter{}
+	w.writeString(signBytesDomain)
+	w.writeUint16(SignBytesVersion)
+	w.writeString(chainID)
+	w.writeString(msgType)
+	return w
+}
+
+func (w *signBytesWriter) writeUint8(v uint8) {
+	w.WriteByte(v)
+}
+
+func (w *signBytesWriter) writeUint16(v uint16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	w.Write(b[:])
+}
+
+func (w *signBytesWriter) writeUint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	w.Write(b[:])
+}
+
+func (w *signBytesWriter) writeInt64(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	w.Write(b[:])
+}
+
+func (w *signBytesWriter) writeBytes(b []byte) {
+	w.writeUint32(uint32(len(b)))
+	w.Write(b)
+}
+
+func (w *signBytesWriter) writeString(s string) {
+	w.writeUint32(uint32(len(s)))
+	w.WriteString(s)
+}
+
+func (w *signBytesWriter) writeTime(t time.Time) {
+	t = t.UTC()
+	w.writeInt64(t.Unix())
+	w.writeUint32(uint32(t.Nanosecond()))
+}
+
+func (w *signBytesWriter) writeBitArray(ba *common.BitArray) {
+	if ba == nil {
+		w.writeUint8(0)
+		return
+	}
+	w.writeUint8(1)
+	w.writeInt64(int64(ba.Bits))
+	w.writeBytes(ba.Elems)
+}
+
+func (w *signBytesWriter) writeVoteFields(v *Vote) {
+	w.writeUint8(uint8(v.Type))
+	w.writeInt64(v.Height)
+	w.writeInt64(int64(v.Round))
+	w.writeTime(v.Timestamp)
+	w.Write(v.Proposed[:])
+	w.Write(v.Prev[:])
+	w.writeInt64(int64(v.POLRound))
+	w.Write(v.ValSet[:])
+	w.writeString(string(v.Address))
+}
+
+func (w *signBytesWriter) writeVote(v *Vote) {
+	if v == nil {
+		w.writeUint8(0)
+		return
+	}
+	w.writeUint8(1)
+	w.writeVoteFields(v)
+	w.writeBytes(v.Signature)
+}
+
+func (w *signBytesWriter) writeVotes(votes []*Vote) {
+	w.writeUint32(uint32(len(votes)))
+	for _, v := range votes {
+		w.writeVote(v)
+	}
+}
+
+func (w *signBytesWriter) writeCertificate(cert *CommitCertificate) {
+	if cert == nil {
+		return
+	}
+	w.writeUint8(1)
+	w.writeInt64(cert.Height)
+	w.writeInt64(int64(cert.Round))
+	w.writeBitArray(cert.Signers)
+	w.writeBytes(cert.AggSignature)
+}
+
+func aggSignBytes(chainID string, height int64, round int, proposed, prev ProposedData, valSet ValSetHash) []byte {
+	w := newSignBytesWriter(chainID, "gobft/CommitCertificate")
+	w.writeInt64(height)
+	w.writeInt64(int64(round))
+	w.Write(proposed[:])
+	w.Write(prev[:])
+	w.Write(valSet[:])
+	return w.Bytes()
+}
+
+func aggSignDigest(chainID string, height int64, round int, proposed, prev ProposedData, valSet ValSetHash) []byte {
+	h := sha256.Sum256(aggSignBytes(chainID, height, round, proposed, prev, valSet))
+	return h[:]
+}
+
+// AppSignBytes returns the sign bytes of an application-defined message
+// registered as msgType, see RegisterMessage. body encodes every field of the
+// message but its signature. The header is the same as the one of the
+// messages of gobft so that a signature never verifies on another chain or
+// for another type.
+func AppSignBytes(chainID string, msgType string, body []byte) []byte {
+	w := newSignBytesWriter(chainID, msgType)
+	w.Write(body)
+	return w.Bytes()
+}
+
+// SignDigest returns the digest msg is signed over on the chain chainID
+func SignDigest(msg ConsensusMessage, chainID string) []byte {
+	h := sha256.Sum256(msg.SignBytes(chainID))
+	return h[:]
+}
+
+// digest identifies a message no matter which chain it's signed for
+func digest(msg ConsensusMessage) []byte {
+	return SignDigest(msg, "")
+}
@@ -0,0 +1,265 @@
+package message
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coschain/gobft/common"
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata")
+
+const goldenChainID = "gobft-test"
+
+// signBytesVector is a golden test vector of the sign bytes of a message
+// signed on ChainID. Message is its JSON encoding.
+type signBytesVector struct {
+	Name      string          `json:"name"`
+	ChainID   string          `json:"chain_id"`
+	Type      string          `json:"type"`
+	Message   json.RawMessage `json:"message"`
+	SignBytes string          `json:"sign_bytes"`
+	Digest    string          `json:"digest"`
+}
+
+func goldenMessages() (names []string, msgs []ConsensusMessage) {
+	t0 := time.Date(2019, 6, 1, 12, 30, 45, 123456789, time.UTC)
+	x := ProposedData(sha256.Sum256([]byte("x")))
+	prev := ProposedData(sha256.Sum256([]byte("prev")))
+	valSet := ValSetHash(sha256.Sum256([]byte("valset")))
+	vote := func(t VoteType, round int, addr PubKey) *Vote {
+		return &Vote{
+			Type:      t,
+			Height:    42,
+			Round:     round,
+			Timestamp: t0,
+			Proposed:  x,
+			Prev:      prev,
+			POLRound:  -1,
+			ValSet:    valSet,
+			Address:   addr,
+			Signature: []byte("sig-" + string(addr)),
+		}
+	}
+	voters := common.NewBitArray(10)
+	voters.SetIndex(1, true)
+	voters.SetIndex(9, true)
+
+	proposal := vote(ProposalType, 3, "alice")
+	proposal.POLRound = 1
+	otherProposal := vote(ProposalType, 3, "alice")
+	otherProposal.Proposed = NilData
+	nilPrevote := vote(PrevoteType, 0, "bob")
+	nilPrevote.Proposed = NilData
+	add := func(name string, msg ConsensusMessage) {
+		names = append(names, name)
+		msgs = append(msgs, msg)
+	}
+	add("proposal", proposal)
+	add("prevote", vote(PrevoteType, 0, "alice"))
+	add("nil prevote", nilPrevote)
+	add("precommit", vote(PrecommitType, 2, "carol"))
+	add("commit", &Commit{
+		ProposedData: x,
+		Prev:         prev,
+		Precommits:   []*Vote{vote(PrecommitType, 2, "alice"), nil, vote(PrecommitType, 2, "carol")},
+		ValSet:       valSet,
+		CommitTime:   t0,
+		Address:      "bob",
+		Signature:    []byte("sig-bob"),
+	})
+	aggregated := vote(PrecommitType, 2, "carol")
+	aggregated.AggSignature = []byte("aggsig-carol")
+	add("aggregated precommit", aggregated)
+	add("commit with certificate", &Commit{
+		ProposedData: x,
+		Prev:         prev,
+		ValSet:       valSet,
+		CommitTime:   t0,
+		Address:      "bob",
+		Signature:    []byte("sig-bob"),
+		Certificate: &CommitCertificate{
+			Height:       42,
+			Round:        2,
+			Signers:      voters,
+			AggSignature: []byte("aggsig"),
+		},
+	})
+	add("fetch votes request", &FetchVotesReq{
+		Type:      PrevoteType,
+		Height:    42,
+		Round:     1,
+		Invoker:   "bob",
+		Voters:    voters,
+		Time:      t0,
+		Signature: []byte("sig-bob"),
+	})
+	add("fetch votes response", &FetchVotesRsp{
+		Type:         PrecommitType,
+		Height:       42,
+		Round:        2,
+		Responser:    "alice",
+		MissingVotes: []*Vote{vote(PrecommitType, 2, "carol")},
+		Time:         t0,
+		Signature:    []byte("sig-alice"),
+	})
+	add("new round step", &NewRoundStep{
+		Height:     42,
+		Round:      2,
+		Step:       6,
+		Prevotes:   voters,
+		Precommits: nil,
+		Address:    "carol",
+		Time:       t0,
+		Signature:  []byte("sig-carol"),
+	})
+	add("fetch commits request", &FetchCommitsReq{
+		From:      10,
+		To:        41,
+		Invoker:   "dave",
+		Time:      t0,
+		Signature: []byte("sig-dave"),
+	})
+	add("vote batch", &VoteBatch{
+		Votes:     []*Vote{proposal, vote(PrevoteType, 3, "alice"), vote(PrecommitType, 2, "carol")},
+		Sender:    "dave",
+		Time:      t0,
+		Signature: []byte("sig-dave"),
+	})
+	dve := NewDuplicateVoteEvidence(vote(PrevoteType, 0, "alice"), nilPrevote)
+	dve.PubKey = "bob"
+	dve.VoteA.Address = "bob"
+	dve.Reporter = "carol"
+	dve.Signature = []byte("sig-carol")
+	add("duplicate vote evidence", dve)
+	pee := NewProposerEquivocationEvidence(proposal, otherProposal)
+	pee.Reporter = "bob"
+	pee.Signature = []byte("sig-bob")
+	add("proposer equivocation evidence", pee)
+	return
+}
+
+func TestSignBytesGolden(t *testing.T) {
+	assert := assert.New(t)
+
+	names, msgs := goldenMessages()
+	var vectors []signBytesVector
+	for i, msg := range msgs {
+		bz, err := json.Marshal(msg)
+		assert.Nil(err)
+		vectors = append(vectors, signBytesVector{
+			Name:      names[i],
+			ChainID:   goldenChainID,
+			Type:      "gobft/" + reflect.TypeOf(msg).Elem().Name(),
+			Message:   bz,
+			SignBytes: hex.EncodeToString(msg.SignBytes(goldenChainID)),
+			Digest:    hex.EncodeToString(SignDigest(msg, goldenChainID)),
+		})
+	}
+
+	path := filepath.Join("testdata", "sign_bytes.json")
+	if *updateGolden {
+		bz, err := json.MarshalIndent(vectors, "", "  ")
+		assert.Nil(err)
+		assert.Nil(ioutil.WriteFile(path, append(bz, '\n'), 0644))
+	}
+	bz, err := ioutil.ReadFile(path)
+	assert.Nil(err)
+	var golden []signBytesVector
+	assert.Nil(json.Unmarshal(bz, &golden))
+	assert.Equal(len(golden), len(vectors))
+	for i := range golden {
+		// the golden file is indented
+		compact := &bytes.Buffer{}
+		assert.Nil(json.Compact(compact, golden[i].Message))
+		golden[i].Message = compact.Bytes()
+		assert.Equal(golden[i], vectors[i], golden[i].Name)
+	}
+}
+
+// TestSignBytesCoverage shows that every field but the signature is signed,
+// as well as the chain ID
+func TestSignBytesCoverage(t *testing.T) {
+	assert := assert.New(t)
+
+	x := ProposedData(sha256.Sum256([]byte("x")))
+	vote := NewVote(PrevoteType, 1, 0, &x, &NilData)
+	vote.Address = "alice"
+	vote.Signature = []byte("sig")
+	signed := vote.SignBytes(goldenChainID)
+
+	changes := []func(v *Vote){
+		func(v *Vote) { v.Type = PrecommitType },
+		func(v *Vote) { v.Height++ },
+		func(v *Vote) { v.Round++ },
+		func(v *Vote) { v.Timestamp = v.Timestamp.Add(time.Nanosecond) },
+		func(v *Vote) { v.Proposed = NilData },
+		func(v *Vote) { v.Prev = x },
+		func(v *Vote) { v.POLRound = 0 },
+		func(v *Vote) { v.ValSet[0] = 1 },
+		func(v *Vote) { v.Address = "bob" },
+	}
+	for i, change := range changes {
+		v := vote.Copy()
+		change(v)
+		assert.NotEqual(signed, v.SignBytes(goldenChainID), "change %d", i)
+	}
+	v := vote.Copy()
+	v.Signature = []byte("another")
+	v.AggSignature = []byte("another")
+	assert.Equal(signed, v.SignBytes(goldenChainID))
+	assert.NotEqual(signed, vote.SignBytes("another-chain"))
+	assert.NotEqual(SignDigest(vote, goldenChainID), vote.Digest())
+
+	// the same time in another location is the same time
+	v = vote.Copy()
+	v.Timestamp = v.Timestamp.In(time.FixedZone("UTC+8", 8*3600))
+	assert.Equal(signed, v.SignBytes(goldenChainID))
+
+	// the fields of requests binary.Write used to skip are signed too
+	fvr := &FetchVotesReq{Type: PrevoteType, Invoker: "alice", Time: time.Now()}
+	signed = fvr.SignBytes(goldenChainID)
+	for i, change := range []func(r *FetchVotesReq){
+		func(r *FetchVotesReq) { r.Round++ },
+		func(r *FetchVotesReq) { r.Invoker = "bob" },
+		func(r *FetchVotesReq) { r.Time = r.Time.Add(time.Second) },
+		func(r *FetchVotesReq) { r.Voters = common.NewBitArray(0) },
+	} {
+		r := *fvr
+		change(&r)
+		assert.NotEqual(signed, r.SignBytes(goldenChainID), "change %d", i)
+	}
+}
+
+// TestAggSignBytes shows that the precommits of the same data in a round
+// aggregate over the same digest as their Commit
+func TestAggSignBytes(t *testing.T) {
+	assert := assert.New(t)
+
+	x := ProposedData(sha256.Sum256([]byte("x")))
+	alice := NewVote(PrecommitType, 3, 1, &x, &NilData)
+	alice.Address = "alice"
+	bob := alice.Copy()
+	bob.Address = "bob"
+	bob.Timestamp = bob.Timestamp.Add(time.Second)
+	digest := alice.AggSignDigest(goldenChainID)
+	assert.Equal(digest, bob.AggSignDigest(goldenChainID))
+	assert.NotEqual(digest, alice.AggSignDigest("another-chain"))
+
+	commit := &Commit{
+		ProposedData: x,
+		Certificate:  &CommitCertificate{Height: 3, Round: 1},
+	}
+	assert.Equal(digest, commit.AggSignDigest(goldenChainID))
+	commit.Certificate.Round = 2
+	assert.NotEqual(digest, commit.AggSignDigest(goldenChainID))
+}
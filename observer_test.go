@@ -0,0 +1,64 @@
+package gobft
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestObserver shows that an observer commits what the validators commit
+// without signing anything but its requests, even with the key of a
+// validator.
+func TestObserver(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	const D = 3
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 4, []message.ProposedData{x, x, x, x})
+	net.nodes[D].core.observer = true
+	assert.True(net.nodes[D].core.IsObserver())
+	maxHeight := int64(3)
+	var sent []message.ConsensusMessage
+	net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+		if from == D {
+			sent = append(sent, msg)
+		}
+		vote, ok := msg.(*message.Vote)
+		return !ok || vote.Height <= maxHeight
+	}
+	committed := func(height int) func() bool {
+		return func() bool {
+			for _, node := range net.nodes {
+				if len(node.commits) < height {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	net.start()
+	net.runUntil(committed(3), 100)
+	for h := 0; h < 3; h++ {
+		commit := net.nodes[D].commits[h]
+		assert.Equal(net.nodes[0].commits[h].ProposedData, commit.ProposedData)
+		assert.Empty(commit.Signature)
+		for _, vote := range commit.Precommits {
+			if vote != nil {
+				assert.NotEqual(net.pubKeys[D], vote.Address)
+			}
+		}
+	}
+	for _, msg := range sent {
+		switch msg.(type) {
+		case *message.FetchVotesReq, *message.FetchCommitsReq:
+		default:
+			t.Errorf("observer sent %v", msg)
+		}
+	}
+}
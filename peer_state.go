@@ -0,0 +1,231 @@
+package gobft
+
+import (
+	"sort"
+	"time"
+
+	"github.com/coschain/gobft/common"
+	"github.com/coschain/gobft/custom"
+	"github.com/coschain/gobft/message"
+)
+
+// PeerRoundState is what we know about the round state of a validator
+type PeerRoundState struct {
+	Height     int64
+	Round      int
+	Step       RoundStepType
+	Prevotes   *common.BitArray // validators it has prevotes from at Round
+	Precommits *common.BitArray // validators it has precommits from at Round
+	Peer       custom.IPeer
+	Updated    time.Time
+}
+
+func (prs *PeerRoundState) isAheadOf(height int64, round int, step RoundStepType) bool {
+	if prs.Height != height {
+		return prs.Height > height
+	}
+	if prs.Round != round {
+		return prs.Round > round
+	}
+	return prs.Step > step
+}
+
+func (prs *PeerRoundState) voters(t message.VoteType) *common.BitArray {
+	if t == message.PrevoteType {
+		return prs.Prevotes
+	}
+	return prs.Precommits
+}
+
+/*
+peerStates keeps the latest PeerRoundState of each validator, learnt from
+their NewRoundStep and FetchVotesReq messages, and picks whom to fetch
+missing votes from.
+
+Fetches for the same height/round/type rotate among the peers known to
+hold any of the missing votes, starting from the one holding the most, so
+that a peer which doesn't answer isn't asked again until the others are.
+It's only used in receiveRoutine.
+*/
+type peerStates struct {
+	states map[message.PubKey]*PeerRoundState
+
+	fetchHeight int64
+	fetchRound  int
+	fetchType   message.VoteType
+	tried       map[message.PubKey]bool
+}
+
+func newPeerStates() *peerStates {
+	return &peerStates{
+		states: make(map[message.PubKey]*PeerRoundState),
+		tried:  make(map[message.PubKey]bool),
+	}
+}
+
+// get returns the PeerRoundState of key, nil if we know nothing about it
+func (ps *peerStates) get(key message.PubKey) *PeerRoundState {
+	return ps.states[key]
+}
+
+// update applies msg received from p. msg is ignored if it's older than what
+// we already know.
+func (ps *peerStates) update(msg *message.NewRoundStep, p custom.IPeer) {
+	step := RoundStepType(msg.Step)
+	prs, ok := ps.states[msg.Address]
+	if ok && prs.isAheadOf(msg.Height, msg.Round, step) {
+		return
+	}
+	if !ok {
+		prs = &PeerRoundState{}
+		ps.states[msg.Address] = prs
+	}
+	prs.Height = msg.Height
+	prs.Round = msg.Round
+	prs.Step = step
+	prs.Prevotes = msg.Prevotes
+	prs.Precommits = msg.Precommits
+	if p != nil {
+		prs.Peer = p
+	}
+	prs.Updated = time.Now()
+}
+
+// updateFromFetch applies what msg received from p tells about its sender:
+// it's fetching the votes of msg.Type at msg.Height/msg.Round and has those
+// of msg.Voters.
+func (ps *peerStates) updateFromFetch(msg *message.FetchVotesReq, p custom.IPeer) {
+	step := RoundStepPrevoteFetch
+	if msg.Type == message.PrecommitType {
+		step = RoundStepPrecommitFetch
+	}
+	prs, ok := ps.states[msg.Invoker]
+	if ok && prs.isAheadOf(msg.Height, msg.Round, step) {
+		return
+	}
+	if !ok || prs.Height != msg.Height || prs.Round != msg.Round {
+		prs = &PeerRoundState{Peer: prs.peer()}
+		ps.states[msg.Invoker] = prs
+	}
+	prs.Height = msg.Height
+	prs.Round = msg.Round
+	prs.Step = step
+	if msg.Type == message.PrevoteType {
+		prs.Prevotes = msg.Voters
+	} else {
+		prs.Precommits = msg.Voters
+	}
+	if p != nil {
+		prs.Peer = p
+	}
+	prs.Updated = time.Now()
+}
+
+func (prs *PeerRoundState) peer() custom.IPeer {
+	if prs == nil {
+		return nil
+	}
+	return prs.Peer
+}
+
+// usefulness returns how many of the votes of type t at height/round we
+// don't have key is known to hold. A validator ahead of us holds +2/3 of
+// them at least, which counts as all of them.
+func (ps *peerStates) usefulness(key message.PubKey, height int64, round int,
+	t message.VoteType, have *common.BitArray) int {
+	prs, ok := ps.states[key]
+	if !ok || prs.Peer == nil || prs.Height < height {
+		return 0
+	}
+	if prs.Height > height || prs.Round > round {
+		return have.Size() - have.Count()
+	}
+	if prs.Round < round {
+		return 0
+	}
+	return prs.voters(t).Sub(have).Count()
+}
+
+func (ps *peerStates) resetFetch(height int64, round int, t message.VoteType) {
+	if ps.fetchHeight != height || ps.fetchRound != round || ps.fetchType != t {
+		ps.fetchHeight = height
+		ps.fetchRound = round
+		ps.fetchType = t
+		ps.tried = make(map[message.PubKey]bool)
+	}
+}
+
+// fetchTarget picks the validator to fetch the votes of type t at
+// height/round we don't have from. It returns nil if no known peer holds
+// any of them.
+func (ps *peerStates) fetchTarget(height int64, round int, t message.VoteType,
+	have *common.BitArray, self message.PubKey) custom.IPeer {
+	ps.resetFetch(height, round, t)
+
+	type candidate struct {
+		key   message.PubKey
+		score int
+	}
+	var candidates []candidate
+	allTried := true
+	for key := range ps.states {
+		if key == self {
+			continue
+		}
+		if score := ps.usefulness(key, height, round, t, have); score > 0 {
+			candidates = append(candidates, candidate{key, score})
+			allTried = allTried && ps.tried[key]
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	if allTried {
+		// start another rotation
+		ps.tried = make(map[message.PubKey]bool)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].key < candidates[j].key
+	})
+	for _, c := range candidates {
+		if !ps.tried[c.key] {
+			ps.tried[c.key] = true
+			return ps.states[c.key].Peer
+		}
+	}
+	return nil
+}
+
+// shouldFetchFrom returns true if key holds some of the missing votes of
+// type t at height/round and hasn't been asked for them yet
+func (ps *peerStates) shouldFetchFrom(key message.PubKey, height int64, round int, t message.VoteType,
+	have *common.BitArray) bool {
+	ps.resetFetch(height, round, t)
+	if ps.tried[key] {
+		return false
+	}
+	return ps.usefulness(key, height, round, t, have) > 0
+}
+
+// markTried records that key was asked for the votes being fetched
+func (ps *peerStates) markTried(key message.PubKey) {
+	ps.tried[key] = true
+}
+
+// highest returns the state of the validator known to be at the highest
+// height we can reach, nil if we know nothing about the others
+func (ps *peerStates) highest(self message.PubKey) *PeerRoundState {
+	var ret *PeerRoundState
+	for key, prs := range ps.states {
+		if key == self || prs.Peer == nil {
+			continue
+		}
+		if ret == nil || prs.Height > ret.Height {
+			ret = prs
+		}
+	}
+	return ret
+}
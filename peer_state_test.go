@@ -0,0 +1,122 @@
+package gobft
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/coschain/gobft/common"
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeerStatesFetchTarget(t *testing.T) {
+	assert := assert.New(t)
+
+	ps := newPeerStates()
+	vals := []message.PubKey{"val0", "val1", "val2", "val3"}
+	bitArray := func(indexes ...int) *common.BitArray {
+		ba := common.NewBitArray(len(vals))
+		for _, i := range indexes {
+			ba.SetIndex(i, true)
+		}
+		return ba
+	}
+	nrs := func(i int, height int64, round int, prevotes ...int) *message.NewRoundStep {
+		return &message.NewRoundStep{
+			Height:   height,
+			Round:    round,
+			Step:     uint8(RoundStepPrevoteFetch),
+			Prevotes: bitArray(prevotes...),
+			Address:  vals[i],
+			Time:     time.Now(),
+		}
+	}
+	have := bitArray(0)
+	assert.Nil(ps.fetchTarget(1, 0, message.PrevoteType, have, vals[0]))
+
+	ps.update(nrs(1, 1, 0, 0, 1), testPeer(1))
+	ps.update(nrs(2, 1, 0, 0, 1, 2), testPeer(2))
+	ps.update(nrs(3, 1, 0, 0), testPeer(3))
+	// older states are ignored
+	ps.update(nrs(2, 0, 5), testPeer(2))
+	assert.Equal(int64(1), ps.get(vals[2]).Height)
+
+	// the one with most missing votes first, then rotate among the useful ones
+	assert.Equal(testPeer(2), ps.fetchTarget(1, 0, message.PrevoteType, have, vals[0]))
+	assert.Equal(testPeer(1), ps.fetchTarget(1, 0, message.PrevoteType, have, vals[0]))
+	assert.Equal(testPeer(2), ps.fetchTarget(1, 0, message.PrevoteType, have, vals[0]))
+	assert.False(ps.shouldFetchFrom(vals[2], 1, 0, message.PrevoteType, have))
+	assert.True(ps.shouldFetchFrom(vals[1], 1, 0, message.PrevoteType, have))
+	assert.False(ps.shouldFetchFrom(vals[3], 1, 0, message.PrevoteType, have))
+
+	// a validator in a later round has +2/3 of them
+	ps.update(nrs(3, 1, 1), testPeer(3))
+	assert.Equal(testPeer(3), ps.fetchTarget(1, 0, message.PrecommitType, have, vals[0]))
+
+	// it's fetching, so it has what it tells
+	ps.updateFromFetch(&message.FetchVotesReq{
+		Type:    message.PrecommitType,
+		Height:  2,
+		Round:   0,
+		Invoker: vals[1],
+		Voters:  bitArray(0, 1, 2, 3),
+	}, testPeer(1))
+	prs := ps.get(vals[1])
+	assert.Equal(RoundStepPrecommitFetch, prs.Step)
+	assert.Equal(4, prs.Precommits.Count())
+	assert.Equal(0, prs.Prevotes.Count())
+	assert.Equal(testPeer(1), ps.fetchTarget(2, 0, message.PrecommitType, have, vals[0]))
+}
+
+func TestFetchFromPeersHavingVotes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	const (
+		A = iota
+		B
+		C
+		D
+	)
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 4, []message.ProposedData{x, x, x, x})
+
+	// D gets no votes other than by fetching them, and A never answers
+	fetchedFrom := make(map[int]int)
+	recipients := make(map[*message.FetchVotesReq]int)
+	net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+		switch m := msg.(type) {
+		case *message.Vote:
+			// stay at height 1
+			if m.Height > 1 {
+				return false
+			}
+			return to != D || m.Type == message.ProposalType
+		case *message.FetchVotesReq:
+			if from == D {
+				fetchedFrom[to]++
+				recipients[m]++
+			}
+		case *message.FetchVotesRsp:
+			return from != A
+		}
+		return true
+	}
+	net.start()
+	net.runUntil(func() bool {
+		return len(net.nodes[D].commits) > 0
+	}, 100)
+	assert.Equal(x, net.nodes[D].commits[0].ProposedData)
+	assert.Equal(0, net.nodes[D].commits[0].Round())
+
+	// each fetch went to a single validator having the votes, A didn't
+	// answer so others were asked as well
+	for _, n := range recipients {
+		assert.Equal(1, n)
+	}
+	assert.True(fetchedFrom[A] > 0)
+	assert.True(fetchedFrom[B]+fetchedFrom[C] > 0)
+}
@@ -0,0 +1,288 @@
+package gobft
+
+import (
+	"math"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/coschain/gobft/custom"
+	"github.com/coschain/gobft/message"
+	"github.com/pkg/errors"
+)
+
+const (
+	// priorities are rescaled before each round so that the highest one is
+	// at most proposerPriorityWindow times the total voting power above the
+	// lowest one
+	proposerPriorityWindow = 2
+	// maxProposerTotalPower leaves enough room for the priorities to never
+	// clip
+	maxProposerTotalPower = math.MaxInt64 / 8
+)
+
+// ProposerPriority is the voting power and proposer priority of a validator
+type ProposerPriority struct {
+	PubKey   message.PubKey `json:"pub_key"`
+	Power    int64          `json:"power"`
+	Priority int64          `json:"priority"`
+}
+
+// ProposerState is what a ProposerSelector persists: the priorities of the
+// validators when Height starts, sorted by PubKey
+type ProposerState struct {
+	Height     int64              `json:"height"`
+	Validators []ProposerPriority `json:"validators"`
+}
+
+/*
+ProposerSelector picks the proposer of each round with the proposer
+priority algorithm of Tendermint, so that every validator proposes in
+proportion to its voting power and in turns across rounds and heights.
+
+Before each round, every validator's priority grows by its voting power
+and the one of the highest priority is the proposer, whose priority then
+drops by the total voting power. Ties go to the lowest PubKey. Round 0
+of a height goes on from the priorities round 0 of the height before
+left, no matter which round it was committed at.
+
+It's meant to be embedded in an ICommittee to provide GetCurrentProposer.
+The ICommittee calls Advance once a height is committed, typically in
+Commit, with the validators of the next height if they change. New
+validators start at a low priority so that joining doesn't make one
+propose right away.
+
+The result only depends on the ProposerState and the validators passed
+to Advance, so all nodes agree on the proposers. The ProposerState can
+be persisted with the committed data and loaded back with
+LoadProposerSelector.
+*/
+type ProposerSelector struct {
+	mtx        sync.Mutex
+	state      ProposerState
+	totalPower int64
+
+	// priorities after the rounds in proposers
+	cur       []ProposerPriority
+	proposers []message.PubKey
+}
+
+// NewProposerSelector creates a ProposerSelector for validators starting at
+// height with the same priority. Validators with no voting power never
+// propose and are left out.
+func NewProposerSelector(height int64, validators []custom.IPubValidator) (*ProposerSelector, error) {
+	vals := make([]ProposerPriority, 0, len(validators))
+	for _, v := range validators {
+		if power := v.GetVotingPower(); power != 0 {
+			vals = append(vals, ProposerPriority{PubKey: v.GetPubKey(), Power: power})
+		}
+	}
+	return LoadProposerSelector(ProposerState{Height: height, Validators: vals})
+}
+
+// LoadProposerSelector creates a ProposerSelector from a persisted
+// ProposerState
+func LoadProposerSelector(state ProposerState) (*ProposerSelector, error) {
+	vals, total, err := checkProposerPriorities(state.Validators)
+	if err != nil {
+		return nil, err
+	}
+	ps := &ProposerSelector{}
+	ps.reset(state.Height, vals, total)
+	return ps, nil
+}
+
+// Height returns the height GetCurrentProposer picks the proposers of
+func (ps *ProposerSelector) Height() int64 {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+	return ps.state.Height
+}
+
+// State returns the ProposerState to persist
+func (ps *ProposerSelector) State() ProposerState {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+	state := ProposerState{
+		Height:     ps.state.Height,
+		Validators: make([]ProposerPriority, len(ps.state.Validators)),
+	}
+	copy(state.Validators, ps.state.Validators)
+	return state
+}
+
+// GetCurrentProposer returns the proposer of round at the current height
+func (ps *ProposerSelector) GetCurrentProposer(round int) message.PubKey {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+	if round < 0 || len(ps.cur) == 0 {
+		return ""
+	}
+	for len(ps.proposers) <= round {
+		ps.proposers = append(ps.proposers, incrementProposerPriority(ps.cur, ps.totalPower))
+	}
+	return ps.proposers[round]
+}
+
+// Advance moves to the height after height once it's committed. If
+// validators isn't nil, they're the validators of the next height: the ones
+// not in it are removed, the others get their new voting power and the new
+// ones join with a priority of -1.125 times the total voting power.
+// The selector is left as it is if an error is returned.
+func (ps *ProposerSelector) Advance(height int64, validators []custom.IPubValidator) error {
+	ps.mtx.Lock()
+	defer ps.mtx.Unlock()
+	if height != ps.state.Height {
+		return errors.Wrapf(ErrProposerHeightMismatch, "got %d, expected %d", height, ps.state.Height)
+	}
+
+	vals := make([]ProposerPriority, len(ps.state.Validators))
+	copy(vals, ps.state.Validators)
+	incrementProposerPriority(vals, ps.totalPower)
+	total := ps.totalPower
+	if validators != nil {
+		priorities := make(map[message.PubKey]int64, len(vals))
+		for _, v := range vals {
+			priorities[v.PubKey] = v.Priority
+		}
+		vals = make([]ProposerPriority, 0, len(validators))
+		total = 0
+		for _, v := range validators {
+			if power := v.GetVotingPower(); power != 0 {
+				vals = append(vals, ProposerPriority{PubKey: v.GetPubKey(), Power: power})
+				total += power
+			}
+		}
+		for i := range vals {
+			if priority, ok := priorities[vals[i].PubKey]; ok {
+				vals[i].Priority = priority
+			} else {
+				vals[i].Priority = -(total + total>>3)
+			}
+		}
+	}
+	vals, total, err := checkProposerPriorities(vals)
+	if err != nil {
+		return err
+	}
+	rescaleProposerPriorities(vals, proposerPriorityWindow*total)
+	centerProposerPriorities(vals)
+	ps.reset(height+1, vals, total)
+	return nil
+}
+
+func (ps *ProposerSelector) reset(height int64, vals []ProposerPriority, total int64) {
+	ps.state = ProposerState{Height: height, Validators: vals}
+	ps.totalPower = total
+	ps.cur = make([]ProposerPriority, len(vals))
+	copy(ps.cur, vals)
+	ps.proposers = nil
+}
+
+// checkProposerPriorities returns a copy of vals sorted by PubKey and their
+// total voting power
+func checkProposerPriorities(vals []ProposerPriority) ([]ProposerPriority, int64, error) {
+	if len(vals) == 0 {
+		return nil, 0, ErrProposerNoValidator
+	}
+	sorted := make([]ProposerPriority, len(vals))
+	copy(sorted, vals)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].PubKey < sorted[j].PubKey
+	})
+	var total int64
+	for i, v := range sorted {
+		if v.Power <= 0 {
+			return nil, 0, errors.Wrapf(ErrProposerInvalidPower, "%s has %d", v.PubKey, v.Power)
+		}
+		if i > 0 && sorted[i-1].PubKey == v.PubKey {
+			return nil, 0, errors.Wrapf(ErrProposerDuplicated, "%s", v.PubKey)
+		}
+		total += v.Power
+		if total > maxProposerTotalPower {
+			return nil, 0, ErrProposerTooMuchPower
+		}
+	}
+	return sorted, total, nil
+}
+
+// incrementProposerPriority moves vals a round forward and returns the
+// proposer of the round
+func incrementProposerPriority(vals []ProposerPriority, total int64) message.PubKey {
+	rescaleProposerPriorities(vals, proposerPriorityWindow*total)
+	centerProposerPriorities(vals)
+
+	proposer := 0
+	for i := range vals {
+		vals[i].Priority = safeAddClip(vals[i].Priority, vals[i].Power)
+		// vals are sorted by PubKey, so the first of the highest wins ties
+		if vals[i].Priority > vals[proposer].Priority {
+			proposer = i
+		}
+	}
+	vals[proposer].Priority = safeSubClip(vals[proposer].Priority, total)
+	return vals[proposer].PubKey
+}
+
+// rescaleProposerPriorities scales the priorities down so that the highest
+// is at most window above the lowest
+func rescaleProposerPriorities(vals []ProposerPriority, window int64) {
+	if len(vals) == 0 || window <= 0 {
+		return
+	}
+	max, min := vals[0].Priority, vals[0].Priority
+	for _, v := range vals[1:] {
+		if v.Priority > max {
+			max = v.Priority
+		}
+		if v.Priority < min {
+			min = v.Priority
+		}
+	}
+	diff := max - min
+	if diff < 0 {
+		diff = math.MaxInt64
+	}
+	if diff <= window {
+		return
+	}
+	ratio := (diff + window - 1) / window
+	for i := range vals {
+		vals[i].Priority /= ratio
+	}
+}
+
+// centerProposerPriorities shifts the priorities so that they average 0
+func centerProposerPriorities(vals []ProposerPriority) {
+	if len(vals) == 0 {
+		return
+	}
+	sum := new(big.Int)
+	for _, v := range vals {
+		sum.Add(sum, big.NewInt(v.Priority))
+	}
+	avg := sum.Div(sum, big.NewInt(int64(len(vals)))).Int64()
+	for i := range vals {
+		vals[i].Priority = safeSubClip(vals[i].Priority, avg)
+	}
+}
+
+func safeAddClip(a, b int64) int64 {
+	if b > 0 && a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	if b < 0 && a < math.MinInt64-b {
+		return math.MinInt64
+	}
+	return a + b
+}
+
+func safeSubClip(a, b int64) int64 {
+	if b > 0 && a < math.MinInt64+b {
+		return math.MinInt64
+	}
+	if b < 0 && a > math.MaxInt64+b {
+		return math.MaxInt64
+	}
+	return a - b
+}
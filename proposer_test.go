@@ -0,0 +1,159 @@
+package gobft
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/coschain/gobft/custom"
+	"github.com/coschain/gobft/custom/mock"
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newProposerTestValidators(ctrl *gomock.Controller, keys []message.PubKey, powers []int64) []custom.IPubValidator {
+	vals := make([]custom.IPubValidator, len(keys))
+	for i := range keys {
+		val := mock.NewMockIPubValidator(ctrl)
+		val.EXPECT().GetPubKey().Return(keys[i]).AnyTimes()
+		val.EXPECT().GetVotingPower().Return(powers[i]).AnyTimes()
+		vals[i] = val
+	}
+	return vals
+}
+
+func TestProposerSelector(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	keys := []message.PubKey{"A", "B", "C", "D"}
+	ps, err := NewProposerSelector(1, newProposerTestValidators(ctrl, keys, []int64{1, 2, 3, 4}))
+	assert.Nil(err)
+
+	// each validator proposes as many heights as its voting power out of
+	// every 10
+	count := make(map[message.PubKey]int)
+	for h := int64(1); h <= 1000; h++ {
+		assert.Equal(h, ps.Height())
+		count[ps.GetCurrentProposer(0)]++
+		assert.Nil(ps.Advance(h, nil))
+	}
+	for i, key := range keys {
+		assert.InDelta(100*(i+1), count[key], 1, string(key))
+	}
+
+	// the same goes for the rounds of a height
+	count = make(map[message.PubKey]int)
+	for r := 0; r < 1000; r++ {
+		count[ps.GetCurrentProposer(r)]++
+	}
+	for i, key := range keys {
+		assert.InDelta(100*(i+1), count[key], 1, string(key))
+	}
+	assert.Equal(message.PubKey(""), ps.GetCurrentProposer(-1))
+
+	assert.NotNil(ps.Advance(1, nil))
+	assert.Equal(int64(1001), ps.Height())
+}
+
+func TestProposerSelectorRoundRobin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	keys := []message.PubKey{"D", "C", "B", "A"}
+	ps, err := NewProposerSelector(1, newProposerTestValidators(ctrl, keys, []int64{1, 1, 1, 1}))
+	assert.Nil(err)
+
+	// with the same voting power, ties go to the lowest PubKey, whatever
+	// the order of the validators
+	for r, key := range []message.PubKey{"A", "B", "C", "D", "A"} {
+		assert.Equal(key, ps.GetCurrentProposer(r))
+	}
+	// round 0 of the next height goes on from round 0 of this one, not from
+	// the round it's committed at
+	assert.Nil(ps.Advance(1, nil))
+	assert.Equal(message.PubKey("B"), ps.GetCurrentProposer(0))
+	assert.Equal(message.PubKey("C"), ps.GetCurrentProposer(1))
+}
+
+func TestProposerSelectorPersistence(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	keys := []message.PubKey{"A", "B", "C"}
+	ps, err := NewProposerSelector(5, newProposerTestValidators(ctrl, keys, []int64{3, 5, 7}))
+	assert.Nil(err)
+	for h := int64(5); h < 10; h++ {
+		ps.GetCurrentProposer(2)
+		assert.Nil(ps.Advance(h, nil))
+	}
+
+	bz, err := json.Marshal(ps.State())
+	assert.Nil(err)
+	var state ProposerState
+	assert.Nil(json.Unmarshal(bz, &state))
+	loaded, err := LoadProposerSelector(state)
+	assert.Nil(err)
+	assert.Equal(int64(10), loaded.Height())
+	for h := int64(10); h < 30; h++ {
+		for r := 0; r < 3; r++ {
+			assert.Equal(ps.GetCurrentProposer(r), loaded.GetCurrentProposer(r))
+		}
+		assert.Nil(ps.Advance(h, nil))
+		assert.Nil(loaded.Advance(h, nil))
+	}
+	assert.Equal(ps.State(), loaded.State())
+
+	_, err = LoadProposerSelector(ProposerState{Height: 1})
+	assert.Equal(ErrProposerNoValidator, err)
+	_, err = LoadProposerSelector(ProposerState{Height: 1, Validators: []ProposerPriority{{"A", 1, 0}, {"A", 2, 0}}})
+	assert.NotNil(err)
+	_, err = LoadProposerSelector(ProposerState{Height: 1, Validators: []ProposerPriority{{"A", -1, 0}}})
+	assert.NotNil(err)
+	_, err = LoadProposerSelector(ProposerState{Height: 1, Validators: []ProposerPriority{{"A", maxProposerTotalPower, 0}, {"B", 1, 0}}})
+	assert.Equal(ErrProposerTooMuchPower, err)
+}
+
+func TestProposerSelectorValidatorChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	keys := []message.PubKey{"A", "B", "C"}
+	ps, err := NewProposerSelector(1, newProposerTestValidators(ctrl, keys, []int64{10, 10, 10}))
+	assert.Nil(err)
+	ps.GetCurrentProposer(0)
+
+	// D joins with as much voting power as the others, B leaves
+	next := newProposerTestValidators(ctrl, []message.PubKey{"A", "C", "D"}, []int64{10, 10, 10})
+	assert.Nil(ps.Advance(1, next))
+	state := ps.State()
+	assert.Len(state.Validators, 3)
+	for _, v := range state.Validators[:2] {
+		assert.True(v.Priority > state.Validators[2].Priority)
+	}
+
+	// D doesn't propose right away but takes its turns once it catches up
+	var proposers []message.PubKey
+	for h := int64(2); h < 32; h++ {
+		proposers = append(proposers, ps.GetCurrentProposer(0))
+		assert.Nil(ps.Advance(h, nil))
+	}
+	assert.NotEqual(message.PubKey("D"), proposers[0])
+	count := make(map[message.PubKey]int)
+	for _, pk := range proposers {
+		count[pk]++
+	}
+	assert.Zero(count["B"])
+	for _, key := range []message.PubKey{"A", "C", "D"} {
+		assert.InDelta(10, count[key], 1, string(key))
+	}
+
+	// an invalid change leaves the selector as it is
+	state = ps.State()
+	assert.NotNil(ps.Advance(32, newProposerTestValidators(ctrl, []message.PubKey{"A"}, []int64{0})))
+	assert.Equal(state, ps.State())
+}
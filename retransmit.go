@@ -0,0 +1,101 @@
+package gobft
+
+import (
+	"time"
+
+	"github.com/coschain/gobft/message"
+)
+
+/*
+retransmitter keeps our latest proposal, prevote and precommit of the
+current height and tells when to broadcast them again, so that a single
+lost broadcast doesn't hold back the whole height.
+
+The first retransmission happens interval after we sign a vote. The
+interval doubles after each retransmission up to maxInterval, and is
+reset whenever we sign a new vote. Everything is dropped when the height
+is committed. It's only used in receiveRoutine.
+*/
+type retransmitter struct {
+	interval    time.Duration
+	maxInterval time.Duration
+	next        time.Duration
+	height      int64
+	votes       map[message.VoteType]*message.Vote
+	timer       *time.Timer
+}
+
+// newRetransmitter creates a retransmitter. Retransmission is disabled if
+// interval is 0
+func newRetransmitter(interval, maxInterval time.Duration) *retransmitter {
+	rt := &retransmitter{
+		interval:    interval,
+		maxInterval: maxInterval,
+		votes:       make(map[message.VoteType]*message.Vote),
+		timer:       time.NewTimer(0),
+	}
+	rt.stopTimer()
+	return rt
+}
+
+// C returns the channel on which it's time to call due
+func (rt *retransmitter) C() <-chan time.Time {
+	return rt.timer.C
+}
+
+// track replaces the vote of the same type with vote and restarts the backoff
+func (rt *retransmitter) track(vote *message.Vote) {
+	if rt.interval <= 0 {
+		return
+	}
+	if vote.Height != rt.height {
+		rt.reset(vote.Height)
+	}
+	rt.votes[vote.Type] = vote
+	rt.next = rt.interval
+	rt.schedule(rt.next)
+}
+
+// reset drops all votes and stops retransmission until a vote of height is
+// tracked
+func (rt *retransmitter) reset(height int64) {
+	rt.height = height
+	rt.votes = make(map[message.VoteType]*message.Vote)
+	rt.stopTimer()
+}
+
+// due returns the votes to broadcast again and schedules the next
+// retransmission
+func (rt *retransmitter) due() []*message.Vote {
+	ret := make([]*message.Vote, 0, len(rt.votes))
+	for _, t := range []message.VoteType{message.ProposalType, message.PrevoteType, message.PrecommitType} {
+		if vote, ok := rt.votes[t]; ok {
+			ret = append(ret, vote)
+		}
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+
+	rt.next *= 2
+	if rt.next > rt.maxInterval {
+		rt.next = rt.maxInterval
+	}
+	rt.schedule(rt.next)
+	return ret
+}
+
+func (rt *retransmitter) schedule(d time.Duration) {
+	rt.stopTimer()
+	rt.timer.Reset(d)
+}
+
+// stop the timer and drain if necessary
+func (rt *retransmitter) stopTimer() {
+	if !rt.timer.Stop() {
+		select {
+		case <-rt.timer.C:
+		default:
+		}
+	}
+}
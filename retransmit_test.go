@@ -0,0 +1,105 @@
+package gobft
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetransmitter(t *testing.T) {
+	assert := assert.New(t)
+
+	var prev message.ProposedData
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	rt := newRetransmitter(10*time.Millisecond, 40*time.Millisecond)
+	assert.Nil(rt.due())
+
+	proposal := message.NewVote(message.ProposalType, 1, 0, &x, &prev)
+	prevote := message.NewVote(message.PrevoteType, 1, 0, &x, &prev)
+	rt.track(proposal)
+	rt.track(prevote)
+	select {
+	case <-rt.C():
+	case <-time.After(time.Second):
+		t.Fatal("retransmitter didn't fire")
+	}
+	assert.Equal([]*message.Vote{proposal, prevote}, rt.due())
+	assert.Equal(20*time.Millisecond, rt.next)
+	rt.due()
+	rt.due()
+	assert.Equal(40*time.Millisecond, rt.next)
+
+	// a new vote restarts the backoff and replaces the old one
+	prevote1 := message.NewVote(message.PrevoteType, 1, 1, &x, &prev)
+	precommit1 := message.NewVote(message.PrecommitType, 1, 1, &x, &prev)
+	rt.track(prevote1)
+	rt.track(precommit1)
+	assert.Equal(10*time.Millisecond, rt.next)
+	assert.Equal([]*message.Vote{proposal, prevote1, precommit1}, rt.due())
+
+	// votes of older heights are dropped
+	prevote2 := message.NewVote(message.PrevoteType, 2, 0, &x, &prev)
+	rt.track(prevote2)
+	assert.Equal([]*message.Vote{prevote2}, rt.due())
+	rt.reset(3)
+	assert.Nil(rt.due())
+
+	// disabled
+	rt = newRetransmitter(0, 0)
+	rt.track(prevote)
+	assert.Nil(rt.due())
+}
+
+func TestRetransmitOnLossyLinks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 4, []message.ProposedData{x, x, x, x})
+
+	// every vote is lost the first time it's sent to a node, and nobody
+	// answers a fetch
+	sent := make(map[string]bool)
+	net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+		switch m := msg.(type) {
+		case *message.Vote:
+			key := fmt.Sprintf("%d/%d/%X", from, to, m.Digest())
+			if !sent[key] {
+				sent[key] = true
+				return false
+			}
+		case *message.FetchVotesReq, *message.FetchVotesRsp:
+			return false
+		}
+		return true
+	}
+	committed := func() bool {
+		for _, node := range net.nodes {
+			if len(node.commits) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	net.start()
+	for i := 0; i < 100 && !committed(); i++ {
+		net.deliver()
+		// retransmission is quicker than any timeout here
+		for _, node := range net.nodes {
+			node.core.retransmit()
+		}
+		net.deliver()
+		net.fireTimeouts()
+	}
+	assert.True(committed())
+	for _, node := range net.nodes {
+		assert.Equal(x, node.commits[0].ProposedData)
+		assert.Equal(0, node.commits[0].Round())
+	}
+}
@@ -0,0 +1,179 @@
+package gobft
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/coschain/gobft/custom"
+	"github.com/coschain/gobft/message"
+	"github.com/pkg/errors"
+)
+
+// signStep orders the votes signed within a round
+type signStep int8
+
+const (
+	signStepNone      signStep = 0
+	signStepPropose   signStep = 1
+	signStepPrevote   signStep = 2
+	signStepPrecommit signStep = 3
+)
+
+func voteToSignStep(t message.VoteType) signStep {
+	switch t {
+	case message.ProposalType:
+		return signStepPropose
+	case message.PrevoteType:
+		return signStepPrevote
+	case message.PrecommitType:
+		return signStepPrecommit
+	default:
+		return signStepNone
+	}
+}
+
+// LastSignState is the height/round/step of the last vote we signed along
+// with its digest and signature
+type LastSignState struct {
+	Height    int64     `json:"height"`
+	Round     int       `json:"round"`
+	Step      signStep  `json:"step"`
+	Digest    []byte    `json:"digest"`
+	Signature []byte    `json:"signature"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+/*
+SignGuard sits between Core and IPrivValidator and makes sure we never
+sign two different votes for the same height/round/step, nor a vote for
+a height/round/step older than the last one we signed.
+
+If asked to sign a vote for the same height/round/step again, it returns
+the signature of the earlier vote as long as the vote is identical,
+except for the timestamp which is reset to the signed one.
+
+LastSignState is persisted to disk before a signature is handed out if
+a file is provided, so the guard works across restarts and can be shared
+by nodes running with the same key.
+*/
+type SignGuard struct {
+	mtx     sync.Mutex
+	privVal custom.IPrivValidator
+	path    string
+	chainID string
+	LastSignState
+}
+
+// NewSignGuard creates a SignGuard. LastSignState is loaded from path if it
+// exists. If path is empty, LastSignState is only kept in memory.
+func NewSignGuard(pVal custom.IPrivValidator, path string) (*SignGuard, error) {
+	sg := &SignGuard{
+		privVal: pVal,
+		path:    path,
+	}
+	if path == "" {
+		return sg, nil
+	}
+
+	bz, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return sg, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(bz, &sg.LastSignState); err != nil {
+		return nil, errors.Wrapf(err, "failed to load sign state from %s", path)
+	}
+	return sg, nil
+}
+
+// setChainID sets the chain votes are signed on
+func (sg *SignGuard) setChainID(chainID string) {
+	sg.mtx.Lock()
+	defer sg.mtx.Unlock()
+	sg.chainID = chainID
+}
+
+// SignVote signs vote if it doesn't conflict with the last signed one.
+// vote.Address must be set before calling it.
+func (sg *SignGuard) SignVote(vote *message.Vote) error {
+	sg.mtx.Lock()
+	defer sg.mtx.Unlock()
+
+	step := voteToSignStep(vote.Type)
+	sameHRS, err := sg.checkHRS(vote.Height, vote.Round, step)
+	if err != nil {
+		return err
+	}
+
+	if sameHRS {
+		// it's the same vote if only timestamp differs
+		ts := vote.Timestamp
+		vote.Timestamp = sg.Timestamp
+		if bytes.Equal(message.SignDigest(vote, sg.chainID), sg.Digest) {
+			vote.Signature = sg.Signature
+			return nil
+		}
+		vote.Timestamp = ts
+		return errors.Wrapf(ErrSignConflictingData, "already signed %d/%d/%d", sg.Height, sg.Round, sg.Step)
+	}
+
+	digest := message.SignDigest(vote, sg.chainID)
+	sig := sg.privVal.Sign(digest)
+	state := LastSignState{
+		Height:    vote.Height,
+		Round:     vote.Round,
+		Step:      step,
+		Digest:    digest,
+		Signature: sig,
+		Timestamp: vote.Timestamp,
+	}
+	if err := sg.save(&state); err != nil {
+		return err
+	}
+	sg.LastSignState = state
+	vote.Signature = sig
+	return nil
+}
+
+// checkHRS returns sameHRS=true if height/round/step is the same as the last
+// signed one, or an error if it regresses.
+func (sg *SignGuard) checkHRS(height int64, round int, step signStep) (sameHRS bool, err error) {
+	if sg.Height > height {
+		return false, errors.Wrapf(ErrSignHeightRegression, "got %d, last %d", height, sg.Height)
+	}
+	if sg.Height == height {
+		if sg.Round > round {
+			return false, errors.Wrapf(ErrSignRoundRegression, "got %d/%d, last %d/%d",
+				height, round, sg.Height, sg.Round)
+		}
+		if sg.Round == round {
+			if sg.Step > step {
+				return false, errors.Wrapf(ErrSignStepRegression, "got %d/%d/%d, last %d/%d/%d",
+					height, round, step, sg.Height, sg.Round, sg.Step)
+			} else if sg.Step == step && len(sg.Signature) > 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (sg *SignGuard) save(state *LastSignState) error {
+	if sg.path == "" {
+		return nil
+	}
+	bz, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmpPath := sg.path + ".tmp"
+	if err = writeFileSync(tmpPath, bz); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, sg.path)
+}
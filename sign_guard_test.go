@@ -0,0 +1,126 @@
+package gobft
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coschain/gobft/custom/mock"
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignGuard(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "gobft_sign_guard")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sign_state.json")
+
+	var pubkey message.PubKey = "val_pubkey0"
+	privVal := mock.NewMockIPrivValidator(ctrl)
+	privVal.EXPECT().GetPubKey().Return(pubkey).AnyTimes()
+	privVal.EXPECT().Sign(gomock.Any()).DoAndReturn(func(digest []byte) []byte {
+		return digest
+	}).AnyTimes()
+
+	var prev message.ProposedData
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	y := message.ProposedData(sha256.Sum256([]byte("y")))
+	newVote := func(t message.VoteType, height int64, round int, data *message.ProposedData) *message.Vote {
+		v := message.NewVote(t, height, round, data, &prev)
+		v.Address = pubkey
+		return v
+	}
+
+	sg, err := NewSignGuard(privVal, path)
+	assert.Nil(err)
+
+	prevote := newVote(message.PrevoteType, 2, 1, &x)
+	assert.Nil(sg.SignVote(prevote))
+	assert.NotEmpty(prevote.Signature)
+
+	// the identical vote gets the identical signature
+	again := newVote(message.PrevoteType, 2, 1, &x)
+	assert.Nil(sg.SignVote(again))
+	assert.Equal(prevote.Signature, again.Signature)
+	assert.Equal(prevote.Timestamp, again.Timestamp)
+
+	// conflicting and regressing votes are refused
+	err = sg.SignVote(newVote(message.PrevoteType, 2, 1, &y))
+	assert.Equal(ErrSignConflictingData, errors.Cause(err))
+	err = sg.SignVote(newVote(message.ProposalType, 2, 1, &y))
+	assert.Equal(ErrSignStepRegression, errors.Cause(err))
+	err = sg.SignVote(newVote(message.PrecommitType, 2, 0, &y))
+	assert.Equal(ErrSignRoundRegression, errors.Cause(err))
+	err = sg.SignVote(newVote(message.PrecommitType, 1, 5, &y))
+	assert.Equal(ErrSignHeightRegression, errors.Cause(err))
+
+	assert.Nil(sg.SignVote(newVote(message.PrecommitType, 2, 1, &x)))
+
+	// the state survives a restart
+	sg, err = NewSignGuard(privVal, path)
+	assert.Nil(err)
+	err = sg.SignVote(newVote(message.PrecommitType, 2, 1, &y))
+	assert.Equal(ErrSignConflictingData, errors.Cause(err))
+	err = sg.SignVote(newVote(message.PrevoteType, 2, 1, &x))
+	assert.Equal(ErrSignStepRegression, errors.Cause(err))
+	assert.Nil(sg.SignVote(newVote(message.ProposalType, 2, 2, &y)))
+}
+
+// TestSignChainID shows that a signature is only valid on the chain it's
+// made for and for the exact vote it's made for
+func TestSignChainID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	var pubkey message.PubKey = "val_pubkey0"
+	privVal := mock.NewMockIPrivValidator(ctrl)
+	privVal.EXPECT().GetPubKey().Return(pubkey).AnyTimes()
+	privVal.EXPECT().Sign(gomock.Any()).DoAndReturn(func(digest []byte) []byte {
+		return digest
+	}).AnyTimes()
+	pubVal := mock.NewMockIPubValidator(ctrl)
+	pubVal.EXPECT().VerifySig(gomock.Any(), gomock.Any()).DoAndReturn(func(digest, sig []byte) bool {
+		return bytes.Equal(digest, sig)
+	}).AnyTimes()
+	pubVal.EXPECT().GetVotingPower().Return(int64(1)).AnyTimes()
+	committee := mock.NewMockICommittee(ctrl)
+	committee.EXPECT().GetValidator(pubkey).Return(pubVal).AnyTimes()
+	committee.EXPECT().GetValidatorList().Return([]message.PubKey{pubkey}).AnyTimes()
+
+	valsA := NewValidators(committee, privVal)
+	valsA.SetChainID("chain-a")
+	valsA.updateHeight(2, 0)
+	valsB := NewValidators(committee, privVal)
+	valsB.SetChainID("chain-b")
+	valsB.updateHeight(2, 0)
+
+	var prev message.ProposedData
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	prevote := message.NewVote(message.PrevoteType, 2, 1, &x, &prev)
+	assert.Nil(valsA.Sign(prevote))
+	assert.Equal(message.SignDigest(prevote, "chain-a"), prevote.Signature)
+	assert.True(valsA.VerifySignature(prevote))
+	assert.False(valsB.VerifySignature(prevote))
+
+	// it can't be replayed into another round
+	replayed := prevote.Copy()
+	replayed.Round = 2
+	assert.False(valsA.VerifySignature(replayed))
+
+	fcr := &message.FetchCommitsReq{From: 1, To: 2, Time: time.Now()}
+	assert.Nil(valsB.Sign(fcr))
+	assert.True(valsB.VerifySignature(fcr))
+	assert.False(valsA.VerifySignature(fcr))
+}
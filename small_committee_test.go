@@ -0,0 +1,95 @@
+package gobft
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSoleValidator(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 1, []message.ProposedData{x})
+	node := net.nodes[0]
+	net.start()
+	// each height is committed right after TimeoutCommit, our proposal,
+	// prevote and precommit are broadcast in one VoteBatch before the Commit
+	for h := 1; h <= 3; h++ {
+		node.broadcast = nil
+		net.fireTimeouts()
+		assert.Len(node.commits, h)
+		if assert.Len(node.broadcast, 2) {
+			assert.IsType(&message.Commit{}, node.broadcast[1])
+			batch, ok := node.broadcast[0].(*message.VoteBatch)
+			if assert.True(ok) && assert.Len(batch.Votes, 3) {
+				for i, t := range []message.VoteType{message.ProposalType, message.PrevoteType, message.PrecommitType} {
+					assert.Equal(t, batch.Votes[i].Type)
+					assert.Equal(int64(h), batch.Votes[i].Height)
+					assert.Equal(x, batch.Votes[i].Proposed)
+					assert.NotEmpty(batch.Votes[i].Signature)
+				}
+			}
+		}
+		assert.Equal(x, node.commits[h-1].ProposedData)
+		assert.Equal(0, node.commits[h-1].Round())
+		assert.Len(node.core.msgQueue, 0)
+		assert.Equal(int64(h+1), node.core.Height)
+		assert.Equal(RoundStepNewHeight, node.ticker.ti.Step)
+		assert.Equal(int64(h+1), node.ticker.ti.Height)
+	}
+	assert.Len(net.queue, 0)
+}
+
+// TestTwoValidators shows that two validators commit as long as both are
+// online, and neither commits anything while the other is gone.
+func TestTwoValidators(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	y := message.ProposedData(sha256.Sum256([]byte("y")))
+	net := newTestNetwork(t, ctrl, 2, []message.ProposedData{x, y})
+	online := true
+	maxHeight := int64(2)
+	net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+		if vote, ok := msg.(*message.Vote); ok && vote.Height > maxHeight {
+			return false
+		}
+		return online
+	}
+	committed := func(height int) func() bool {
+		return func() bool {
+			return len(net.nodes[0].commits) >= height && len(net.nodes[1].commits) >= height
+		}
+	}
+	net.start()
+	net.runUntil(committed(2), 20)
+	for _, node := range net.nodes {
+		assert.Equal(x, node.commits[0].ProposedData)
+		assert.Equal(0, node.commits[0].Round())
+	}
+
+	// validator 1 is gone, nothing is committed however long we wait
+	online = false
+	maxHeight = 3
+	for i := 0; i < 20; i++ {
+		net.deliver()
+		net.fireTimeouts()
+	}
+	for _, node := range net.nodes {
+		assert.Len(node.commits, 2)
+		assert.Equal(int64(3), node.core.Height)
+	}
+
+	// and both commit the same data once it's back
+	online = true
+	net.runUntil(committed(3), 100)
+	assert.Equal(net.nodes[0].commits[2].ProposedData, net.nodes[1].commits[2].ProposedData)
+}
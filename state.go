@@ -96,9 +96,12 @@ type RoundState struct {
 	Proposal       *message.Vote
 	LockedRound    int
 	LockedProposal *message.Vote
+	ValidRound     int           // last round with a polka for ValidProposal, -1 if none
+	ValidProposal  *message.Vote // re-proposed when we're the proposer
 	Votes          *HeightVoteSet
 	CommitRound    int
 	LastCommit     *VoteSet // Last precommits at Height-1
+	Timeouts       Timeouts // timeouts of round 0 at Height
 
 	lastCommittedData message.ProposedData
 }
@@ -117,7 +120,10 @@ func (rs *RoundState) StringIndented(indent string) string {
 %s  Proposal:      %v
 %s  LockedRound:   %v
 %s  LockedProposal:   %v
+%s  ValidRound:    %v
+%s  ValidProposal: %v
 %s  Votes:         %v
+%s  Timeouts:      %v
 %s}`,
 		indent, rs.Height, rs.Round, rs.Step,
 		indent, rs.StartTime,
@@ -125,7 +131,10 @@ func (rs *RoundState) StringIndented(indent string) string {
 		indent, rs.Proposal,
 		indent, rs.LockedRound,
 		indent, rs.LockedProposal.String(),
+		indent, rs.ValidRound,
+		indent, rs.ValidProposal.String(),
 		indent, rs.Votes.StringIndented(indent+"  "),
+		indent, rs.Timeouts,
 		//		indent, rs.LastCommit.String(),
 		indent)
 }
@@ -2,84 +2,24 @@ package gobft
 
 import "github.com/coschain/gobft/message"
 
+// StateSync used to jump to the height and round of the votes above ours.
+//
+// Deprecated: Core catches up the heights it missed with verified Commits
+// by itself. StateSync only hands the votes to Core.
 type StateSync struct {
-	heightVotes map[int64]*HeightVoteSet
-	core        *Core
+	core *Core
 }
 
+// Deprecated: see StateSync.
 func NewStateSync(c *Core) *StateSync {
 	return &StateSync{
-		heightVotes: make(map[int64]*HeightVoteSet),
-		core:        c,
+		core: c,
 	}
 }
 
+// AddVote delivers v to Core as if it's received from a peer
 func (s *StateSync) AddVote(v *message.Vote) {
-	s.core.log.Info("[StateSync] AddVote ", v.String())
-
-	for k := range s.heightVotes {
-		if k <= s.core.Height {
-			delete(s.heightVotes, k)
-		}
-	}
-
-	votesByHeight, ok := s.heightVotes[v.Height]
-	if !ok {
-		votesByHeight = NewHeightVoteSet(v.Height, s.core.validators, &s.core.lastCommittedData)
-		s.heightVotes[v.Height] = votesByHeight
+	if err := s.core.RecvMsg(v, nil); err != nil {
+		s.core.log.Error("StateSync AddVote: ", err)
 	}
-
-	added, err := votesByHeight.AddVote(v)
-	if !added {
-		if err != nil {
-			s.core.log.Error("StateSync AddVote: ", err)
-		}
-		return
-	}
-
-	if v.Type == message.PrevoteType {
-		prevotes := votesByHeight.Prevotes(v.Round)
-		if prevotes.HasTwoThirdsMajority() {
-			s.updateState(v.Height, v.Round, RoundStepNewHeight)
-			s.core.enterNewRound(v.Height, v.Round)
-			c := s.core
-			if (c.LockedProposal != nil) &&
-				(c.LockedRound < v.Round) {
-
-				c.log.Info("Unlocking because of POL.", " lockedRound ", c.LockedRound, " POLRound ", v.Round)
-				c.LockedRound = -1
-				c.LockedProposal = nil
-			}
-			s.core.enterPrecommit(v.Height, v.Round)
-		} else if prevotes.HasTwoThirdsAny() {
-			s.updateState(v.Height, v.Round, RoundStepNewHeight)
-			s.core.enterNewRound(v.Height, v.Round)
-			//s.core.enterPrevote(v.Height, v.Round)
-			s.core.enterPrevoteWait(v.Height, v.Round)
-		}
-	} else if v.Type == message.PrecommitType {
-		precommits := votesByHeight.Precommits(v.Round)
-		if precommits.HasTwoThirdsMajority() {
-			s.updateState(v.Height, v.Round, RoundStepNewHeight)
-			s.core.enterNewRound(v.Height, v.Round)
-			//s.core.enterPrecommit(v.Height, v.Round)
-			s.core.enterCommit(v.Height, v.Round)
-			if s.core.cfg.SkipTimeoutCommit && precommits.HasAll() {
-				s.core.enterNewRound(v.Height, 0)
-			}
-		} else if precommits.HasTwoThirdsAny() {
-			s.updateState(v.Height, v.Round, RoundStepNewHeight)
-			s.core.enterNewRound(v.Height, v.Round)
-			s.core.enterPrecommitWait(v.Height, v.Round)
-		}
-	}
-}
-
-func (s *StateSync) updateState(height int64, round int, step RoundStepType) {
-	s.core.Height = height
-	s.core.Round = round
-	s.core.Step = step
-
-	s.core.Votes = s.heightVotes[height]
-	delete(s.heightVotes, height)
 }
@@ -0,0 +1,185 @@
+package gobft
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// minLatencySamples is the number of heights a latency must be observed
+	// at before a timeout is derived from it
+	minLatencySamples = 10
+
+	// latencyPercentile of the observed latencies, times latencyMargin, is
+	// the derived timeout
+	latencyPercentile = 0.9
+	latencyMargin     = 2
+)
+
+// Timeouts are the timeouts of round 0. Those of round r are longer by the
+// deltas of Config times r.
+type Timeouts struct {
+	Propose   time.Duration
+	Prevote   time.Duration
+	Precommit time.Duration
+}
+
+func (t Timeouts) String() string {
+	return fmt.Sprintf("Timeouts{propose:%v prevote:%v precommit:%v}", t.Propose, t.Prevote, t.Precommit)
+}
+
+type latencyStep int
+
+const (
+	latencyPropose   latencyStep = iota // enterPropose to a proposal from others
+	latencyPrevote                      // +2/3 any prevotes to +2/3 for one value
+	latencyPrecommit                    // +2/3 any precommits to +2/3 for one value
+	latencySteps
+)
+
+type stepStart struct {
+	height int64
+	round  int
+	time   time.Time
+}
+
+/*
+latencyTracker measures what the timeouts wait for, once per height and
+step, over the last window heights: how long a proposal takes to arrive
+after we enter propose, and how long +2/3 votes for one value take to
+arrive after +2/3 votes for anything, which is when the waits of
+TimeoutPrevote and TimeoutPrecommit start.
+
+A sample is only taken if the wait starts and is over in the same round.
+Waits that time out don't make samples. It's only used in
+receiveRoutine.
+*/
+type latencyTracker struct {
+	window  int64
+	started [latencySteps]stepStart
+	samples [latencySteps]map[int64]time.Duration // keys: height
+	// clock of Core.startLatency and Core.observeLatency
+	now func() time.Time
+}
+
+func newLatencyTracker(window int64) *latencyTracker {
+	lt := &latencyTracker{window: window, now: time.Now}
+	for i := range lt.samples {
+		lt.samples[i] = make(map[int64]time.Duration)
+	}
+	return lt
+}
+
+// start records that we start waiting for step at height/round, unless we
+// already do
+func (lt *latencyTracker) start(step latencyStep, height int64, round int, now time.Time) {
+	if s := lt.started[step]; s.height == height && s.round == round && !s.time.IsZero() {
+		return
+	}
+	lt.started[step] = stepStart{height, round, now}
+}
+
+// observe records the time it took to get what we wait for at step if it's
+// the first time at height
+func (lt *latencyTracker) observe(step latencyStep, height int64, round int, now time.Time) {
+	s := lt.started[step]
+	if s.height != height || s.round != round || s.time.IsZero() {
+		return
+	}
+	samples := lt.samples[step]
+	if _, ok := samples[height]; ok {
+		return
+	}
+	samples[height] = now.Sub(s.time)
+	for h := range samples {
+		if h <= height-lt.window {
+			delete(samples, h)
+		}
+	}
+}
+
+// percentile returns the p-th percentile of the latencies observed at step.
+// ok is false if there're not enough samples.
+func (lt *latencyTracker) percentile(step latencyStep, p float64) (d time.Duration, ok bool) {
+	samples := lt.samples[step]
+	if len(samples) < minLatencySamples && int64(len(samples)) < lt.window {
+		return 0, false
+	}
+	sorted := make([]time.Duration, 0, len(samples))
+	for _, d := range samples {
+		sorted = append(sorted, d)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return sorted[int(float64(len(sorted)-1)*p)], true
+}
+
+// timeouts returns the timeouts derived from the latencies observed, bounded
+// by cfg.TimeoutMin and cfg.TimeoutMax. The configured ones are used until
+// there're enough samples.
+func (lt *latencyTracker) timeouts(cfg *Config) Timeouts {
+	derive := func(step latencyStep, configured time.Duration) time.Duration {
+		d, ok := lt.percentile(step, latencyPercentile)
+		if !ok {
+			return configured
+		}
+		d *= latencyMargin
+		if d < cfg.TimeoutMin {
+			d = cfg.TimeoutMin
+		}
+		if d > cfg.TimeoutMax {
+			d = cfg.TimeoutMax
+		}
+		return d
+	}
+	return Timeouts{
+		Propose:   derive(latencyPropose, cfg.TimeoutPropose),
+		Prevote:   derive(latencyPrevote, cfg.TimeoutPrevote),
+		Precommit: derive(latencyPrecommit, cfg.TimeoutPrecommit),
+	}
+}
+
+// updateTimeouts sets the Timeouts of the new height
+func (c *Core) updateTimeouts() {
+	if !c.cfg.AdaptiveTimeouts {
+		c.Timeouts = Timeouts{
+			Propose:   c.cfg.TimeoutPropose,
+			Prevote:   c.cfg.TimeoutPrevote,
+			Precommit: c.cfg.TimeoutPrecommit,
+		}
+		return
+	}
+	c.Timeouts = c.latency.timeouts(c.cfg)
+	c.log.Debugf("timeouts of height %d: %v", c.Height, c.Timeouts)
+}
+
+// startLatency records that we start waiting for step in the current round
+func (c *Core) startLatency(step latencyStep) {
+	if c.cfg.AdaptiveTimeouts && !c.replayMode {
+		c.latency.start(step, c.Height, c.Round, c.latency.now())
+	}
+}
+
+// observeLatency records that what we wait for at step in round arrives
+func (c *Core) observeLatency(step latencyStep, round int) {
+	if c.cfg.AdaptiveTimeouts && !c.replayMode {
+		c.latency.observe(step, c.Height, round, c.latency.now())
+	}
+}
+
+// timeoutPropose returns the amount of time to wait for a proposal
+func (c *Core) timeoutPropose(round int) time.Duration {
+	return c.Timeouts.Propose + c.cfg.TimeoutProposeDelta*time.Duration(round)
+}
+
+// timeoutPrevote returns the amount of time to wait for straggler votes after receiving any +2/3 prevotes
+func (c *Core) timeoutPrevote(round int) time.Duration {
+	return c.Timeouts.Prevote + c.cfg.TimeoutPrevoteDelta*time.Duration(round)
+}
+
+// timeoutPrecommit returns the amount of time to wait for straggler votes after receiving any +2/3 precommits
+func (c *Core) timeoutPrecommit(round int) time.Duration {
+	return c.Timeouts.Precommit + c.cfg.TimeoutPrecommitDelta*time.Duration(round)
+}
@@ -0,0 +1,123 @@
+package gobft
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg := TestConfig()
+	cfg.AdaptiveTimeouts = true
+	lt := newLatencyTracker(20)
+	configured := Timeouts{cfg.TimeoutPropose, cfg.TimeoutPrevote, cfg.TimeoutPrecommit}
+	assert.Equal(configured, lt.timeouts(cfg))
+
+	t0 := time.Now()
+	for h := int64(1); h <= minLatencySamples; h++ {
+		lt.start(latencyPrevote, h, 0, t0)
+		// only the first sample of a height counts
+		lt.observe(latencyPrevote, h, 0, t0.Add(time.Duration(h)*time.Millisecond))
+		lt.observe(latencyPrevote, h, 0, t0.Add(time.Second))
+	}
+	// p90 of 1ms..10ms is 9ms, twice of it is 18ms
+	assert.Equal(18*time.Millisecond, lt.timeouts(cfg).Prevote)
+	assert.Equal(cfg.TimeoutPropose, lt.timeouts(cfg).Propose)
+
+	// a wait that has started isn't restarted by later votes
+	lt.start(latencyPrecommit, 1, 0, t0)
+	lt.start(latencyPrecommit, 1, 0, t0.Add(time.Second))
+	lt.observe(latencyPrecommit, 1, 0, t0.Add(time.Second))
+	assert.Equal(time.Second, lt.samples[latencyPrecommit][1])
+	delete(lt.samples[latencyPrecommit], 1)
+
+	// a wait over in another round than it started isn't a sample
+	lt.start(latencyPrecommit, 1, 0, t0)
+	lt.observe(latencyPrecommit, 1, 1, t0.Add(time.Millisecond))
+	assert.Len(lt.samples[latencyPrecommit], 0)
+
+	// slow heights push it up to TimeoutMax and old heights slide out of
+	// the window
+	for h := int64(11); h <= 30; h++ {
+		lt.start(latencyPrevote, h, 0, t0)
+		lt.observe(latencyPrevote, h, 0, t0.Add(time.Second))
+	}
+	assert.Len(lt.samples[latencyPrevote], 20)
+	assert.Equal(cfg.TimeoutMax, lt.timeouts(cfg).Prevote)
+
+	// fast heights bring it down to TimeoutMin
+	for h := int64(31); h <= 50; h++ {
+		lt.start(latencyPrevote, h, 0, t0)
+		lt.observe(latencyPrevote, h, 0, t0)
+	}
+	assert.Equal(cfg.TimeoutMin, lt.timeouts(cfg).Prevote)
+}
+
+func TestAdaptiveTimeouts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 4, []message.ProposedData{x, x, x, x})
+	// time stands still in the test network, every latency is 0
+	clock := time.Now()
+	for _, node := range net.nodes {
+		assert.Nil(node.core.cfg.ValidateBasic())
+		node.core.cfg.AdaptiveTimeouts = true
+		node.core.latency.now = func() time.Time { return clock }
+	}
+	// heights go on without any timeout, so votes above maxHeight are
+	// dropped to stop somewhere
+	maxHeight := int64(minLatencySamples - 1)
+	net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+		vote, ok := msg.(*message.Vote)
+		return !ok || vote.Height <= maxHeight
+	}
+	committed := func(height int) func() bool {
+		return func() bool {
+			for _, node := range net.nodes {
+				if len(node.commits) < height {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	cfg := TestConfig()
+	net.start()
+	net.runUntil(committed(minLatencySamples-1), 100)
+	for _, node := range net.nodes {
+		rs := node.core.GetRoundState()
+		assert.Equal(Timeouts{cfg.TimeoutPropose, cfg.TimeoutPrevote, cfg.TimeoutPrecommit}, rs.Timeouts)
+		assert.Equal(cfg.TimeoutPropose+cfg.TimeoutProposeDelta, node.core.timeoutPropose(1))
+	}
+
+	// all validators vote for x, so the timeouts go down to TimeoutMin once
+	// there're enough samples
+	maxHeight = minLatencySamples + 1
+	net.runUntil(committed(minLatencySamples+1), 100)
+	for i, node := range net.nodes {
+		rs := node.core.GetRoundState()
+		assert.Equal(cfg.TimeoutMin, rs.Timeouts.Prevote)
+		assert.Equal(cfg.TimeoutMin, rs.Timeouts.Precommit)
+		assert.Equal(cfg.TimeoutMin+cfg.TimeoutPrevoteDelta*2, node.core.timeoutPrevote(2))
+		if i == net.proposer(0) {
+			// the proposer of round 0 never waits for a proposal
+			assert.Equal(cfg.TimeoutPropose, rs.Timeouts.Propose)
+		} else {
+			assert.Equal(cfg.TimeoutMin, rs.Timeouts.Propose)
+		}
+	}
+
+	cfg.AdaptiveTimeouts = true
+	cfg.TimeoutMax = cfg.TimeoutMin - 1
+	assert.NotNil(cfg.ValidateBasic())
+}
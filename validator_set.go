@@ -0,0 +1,247 @@
+package gobft
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/coschain/gobft/custom"
+	"github.com/coschain/gobft/message"
+)
+
+/*
+ValidatorSet is the committee voting at a height, snapshotted from
+ICommittee when the height starts so that changes of ICommittee in the
+middle of a height don't change how its votes are counted.
+
+Its hash covers the validators in the order of GetValidatorList and their
+voting power. Votes and Commits carry the hash of the set they're signed
+under and are only counted against a set of the same hash.
+
+If ICommittee is an IValidatorUpdater, only the set of height 1 is
+snapshotted. The set of a later height is the one of the height before
+with the ValidatorUpdates decided ValidatorUpdateDelay heights earlier.
+*/
+type ValidatorSet struct {
+	height     int64
+	list       []message.PubKey
+	validators map[message.PubKey]custom.IPubValidator
+	powers     map[message.PubKey]int64
+	totalPower int64
+	hash       message.ValSetHash
+	// signatures are verified on this chain
+	chainID string
+	// verifies the AggSignatures and CommitCertificates, nil if it's off
+	aggregator custom.IAggregator
+}
+
+// NewValidatorSet snapshots the validators of committee as the ones voting
+// at height
+func NewValidatorSet(height int64, committee custom.ICommittee) *ValidatorSet {
+	list := committee.GetValidatorList()
+	powers := make(map[message.PubKey]int64, len(list))
+	for _, pk := range list {
+		if val := committee.GetValidator(pk); val != nil {
+			powers[pk] = val.GetVotingPower()
+		}
+	}
+	return newValidatorSet(height, list, powers, committee)
+}
+
+// newValidatorSet makes the set of the validators in list with powers.
+// Their signatures are verified by the IPubValidator committee returns.
+func newValidatorSet(height int64, list []message.PubKey, powers map[message.PubKey]int64, committee custom.ICommittee) *ValidatorSet {
+	vs := &ValidatorSet{
+		height:     height,
+		list:       make([]message.PubKey, len(list)),
+		validators: make(map[message.PubKey]custom.IPubValidator, len(list)),
+		powers:     make(map[message.PubKey]int64, len(list)),
+	}
+	copy(vs.list, list)
+
+	h := sha256.New()
+	for _, pk := range vs.list {
+		if val := committee.GetValidator(pk); val != nil {
+			vs.validators[pk] = val
+		}
+		power := powers[pk]
+		vs.powers[pk] = power
+		vs.totalPower += power
+
+		binary.Write(h, binary.BigEndian, uint32(len(pk)))
+		h.Write([]byte(pk))
+		binary.Write(h, binary.BigEndian, power)
+	}
+	copy(vs.hash[:], h.Sum(nil))
+	return vs
+}
+
+// update returns the set of height, which is vs with updates applied. New
+// validators are appended in the order of updates. updates are discarded
+// with an error if any of them is invalid or they change more than 1/3 of
+// the voting power of vs, in which case vs is kept as the set of height.
+func (vs *ValidatorSet) update(height int64, updates []custom.ValidatorUpdate, committee custom.ICommittee) (*ValidatorSet, error) {
+	keep := *vs
+	keep.height = height
+	if len(updates) == 0 {
+		return &keep, nil
+	}
+
+	list := make([]message.PubKey, 0, len(vs.list)+len(updates))
+	list = append(list, vs.list...)
+	powers := make(map[message.PubKey]int64, len(vs.powers)+len(updates))
+	for pk, power := range vs.powers {
+		powers[pk] = power
+	}
+	seen := make(map[message.PubKey]bool, len(updates))
+	var changed int64
+	for _, u := range updates {
+		if u.Power < 0 {
+			return &keep, ErrValUpdateNegativePower
+		}
+		if seen[u.PubKey] {
+			return &keep, ErrValUpdateDuplicated
+		}
+		seen[u.PubKey] = true
+
+		old, ok := powers[u.PubKey]
+		if u.Power > old {
+			changed += u.Power - old
+		} else {
+			changed += old - u.Power
+		}
+		if u.Power == 0 {
+			if ok {
+				delete(powers, u.PubKey)
+				for i, pk := range list {
+					if pk == u.PubKey {
+						list = append(list[:i], list[i+1:]...)
+						break
+					}
+				}
+			}
+			continue
+		}
+		if !ok {
+			list = append(list, u.PubKey)
+		}
+		powers[u.PubKey] = u.Power
+	}
+	if len(list) == 0 {
+		return &keep, ErrValUpdateEmptySet
+	}
+	if 3*changed > vs.totalPower {
+		return &keep, ErrValUpdateTooMuchPower
+	}
+	next := newValidatorSet(height, list, powers, committee)
+	next.chainID = vs.chainID
+	next.aggregator = vs.aggregator
+	return next, nil
+}
+
+// updates returns the validators in order with their voting power, as they're
+// saved by IValidatorUpdater.SaveValidatorSet
+func (vs *ValidatorSet) updates() []custom.ValidatorUpdate {
+	vals := make([]custom.ValidatorUpdate, len(vs.list))
+	for i, pk := range vs.list {
+		vals[i] = custom.ValidatorUpdate{PubKey: pk, Power: vs.powers[pk]}
+	}
+	return vals
+}
+
+// Height returns the height the set votes at
+func (vs *ValidatorSet) Height() int64 {
+	return vs.height
+}
+
+// Hash returns the hash Votes and Commits of this set carry
+func (vs *ValidatorSet) Hash() message.ValSetHash {
+	return vs.hash
+}
+
+// Size returns the number of validators
+func (vs *ValidatorSet) Size() int {
+	return len(vs.list)
+}
+
+// List returns the validators in the order of ICommittee.GetValidatorList,
+// which is also the order of the validator bit arrays
+func (vs *ValidatorSet) List() []message.PubKey {
+	return vs.list
+}
+
+// Has returns true if key is one of the validators
+func (vs *ValidatorSet) Has(key message.PubKey) bool {
+	_, ok := vs.powers[key]
+	return ok
+}
+
+func (vs *ValidatorSet) GetVotingPower(key message.PubKey) int64 {
+	return vs.powers[key]
+}
+
+func (vs *ValidatorSet) TotalVotingPower() int64 {
+	return vs.totalPower
+}
+
+// VerifySignature returns true if msg is signed by one of the validators
+func (vs *ValidatorSet) VerifySignature(msg message.ConsensusMessage) bool {
+	val := vs.validators[msg.GetSigner()]
+	if val == nil {
+		return false
+	}
+	return val.VerifySig(message.SignDigest(msg, vs.chainID), msg.GetSignature())
+}
+
+// aggKey returns the key of a validator for the aggregator, nil if there's no
+// aggregator or the validator isn't an IAggPubValidator
+func (vs *ValidatorSet) aggKey(key message.PubKey) []byte {
+	if vs.aggregator == nil {
+		return nil
+	}
+	if val, ok := vs.validators[key].(custom.IAggPubValidator); ok {
+		return val.GetAggKey()
+	}
+	return nil
+}
+
+// verifyAggSignature returns true if the AggSignature of vote is made by the
+// validator who signed it
+func (vs *ValidatorSet) verifyAggSignature(vote *message.Vote) bool {
+	key := vs.aggKey(vote.Address)
+	if key == nil {
+		return false
+	}
+	return vs.aggregator.Verify(key, vote.AggSignDigest(vs.chainID), vote.AggSignature)
+}
+
+// verifyCertificate checks that the Certificate of commit aggregates the
+// signatures of +2/3 of the voting power
+func (vs *ValidatorSet) verifyCertificate(commit *message.Commit) error {
+	if vs.aggregator == nil {
+		return ErrCommitNoAggregator
+	}
+	cert := commit.Certificate
+	if cert.Signers.Size() != len(vs.list) {
+		return ErrCommitInvalidCertificate
+	}
+	keys := make([][]byte, 0, cert.Signers.Count())
+	var power int64
+	for i, pk := range vs.list {
+		if !cert.Signers.GetIndex(i) {
+			continue
+		}
+		key := vs.aggKey(pk)
+		if key == nil {
+			return ErrCommitInvalidCertificate
+		}
+		keys = append(keys, key)
+		power += vs.powers[pk]
+	}
+	if power <= vs.totalPower*2/3 {
+		return ErrCommitNoMajority
+	}
+	if !vs.aggregator.VerifyAggregate(keys, commit.AggSignDigest(vs.chainID), cert.AggSignature) {
+		return ErrCommitInvalidCertificate
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package gobft
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/coschain/gobft/custom/mock"
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidatorSetChange shows that the votes of a height are counted
+// against the committee the height starts with, even if ICommittee changes
+// in the middle of it, and the new committee takes over at the next height.
+func TestValidatorSetChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 4, []message.ProposedData{x, x, x, x})
+	maxHeight := int64(1)
+	online := func(i int) bool { return true }
+	net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+		vote, ok := msg.(*message.Vote)
+		return online(from) && (!ok || vote.Height <= maxHeight)
+	}
+	committed := func(height int, nodes ...*testNode) func() bool {
+		return func() bool {
+			for _, node := range nodes {
+				if len(node.commits) < height {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	net.start()
+	net.runUntil(committed(1, net.nodes...), 100)
+	oldSet := net.nodes[0].core.validators.Current()
+	assert.Equal(int64(2), oldSet.Height())
+	assert.Equal(oldSet.Hash(), net.nodes[0].commits[0].ValSet)
+
+	// the stake moves to A in the middle of height 2. A and B would have
+	// +2/3 of the new voting power but they don't have it in the committee
+	// of height 2
+	net.powers[0] = 5
+	maxHeight = 2
+	online = func(i int) bool { return i < 2 }
+	for i := 0; i < 4; i++ {
+		net.deliver()
+		net.fireTimeouts()
+	}
+	for _, node := range net.nodes[:2] {
+		assert.Len(node.commits, 1)
+		assert.Equal(int64(4), node.core.Votes.Prevotes(0).valSet.TotalVotingPower())
+		assert.False(node.core.Votes.Prevotes(0).HasTwoThirdsAny())
+	}
+
+	// height 2 is committed with C and D under the old committee, and the
+	// new one takes over at height 3
+	online = func(i int) bool { return true }
+	net.runUntil(committed(2, net.nodes...), 100)
+	for _, node := range net.nodes {
+		assert.Equal(oldSet.Hash(), node.commits[1].ValSet)
+		newSet := node.core.validators.Current()
+		assert.Equal(int64(3), newSet.Height())
+		assert.Equal(int64(8), newSet.TotalVotingPower())
+		assert.NotEqual(oldSet.Hash(), newSet.Hash())
+		// the committee of the previous height is kept for the stragglers
+		assert.Equal(oldSet.Hash(), node.core.validators.ValidatorSet(2).Hash())
+		assert.Nil(node.core.validators.ValidatorSet(1))
+	}
+
+	// a vote of height 3 signed under the old committee is rejected
+	var prev message.ProposedData = net.nodes[0].commits[1].ProposedData
+	c := net.nodes[0].core
+	stale := message.NewVote(message.PrevoteType, 3, 0, &x, &prev)
+	stale.ValSet = oldSet.Hash()
+	stale.Address = net.pubKeys[2]
+	stale.Signature = []byte("sig")
+	added, err := c.tryAddVote(stale)
+	assert.False(added)
+	assert.Equal(ErrVoteWrongValSet, err)
+
+	// A and B are enough for height 3
+	maxHeight = 3
+	online = func(i int) bool { return i < 2 }
+	net.runUntil(committed(3, net.nodes[:2]...), 100)
+	newSet := c.validators.ValidatorSet(3)
+	assert.Equal(newSet.Hash(), net.nodes[0].commits[2].ValSet)
+	_, err = net.nodes[2].core.verifyCommit(net.nodes[0].commits[2])
+	assert.Nil(err)
+	// a Commit of height 3 that claims the old committee doesn't verify
+	forged := *net.nodes[0].commits[2]
+	forged.ValSet = oldSet.Hash()
+	_, err = net.nodes[2].core.verifyCommit(&forged)
+	assert.Equal(ErrCommitWrongValSet, err)
+}
+
+func TestValidatorSetHash(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 4, []message.ProposedData{x, x, x, x})
+	committee := net.nodes[0].committee
+
+	a := NewValidatorSet(1, committee)
+	b := NewValidatorSet(2, committee)
+	assert.Equal(a.Hash(), b.Hash())
+	assert.Equal(4, a.Size())
+	assert.True(a.Has(net.pubKeys[3]))
+	assert.False(a.Has("nobody"))
+
+	net.powers[3] = 2
+	c := NewValidatorSet(3, committee)
+	assert.NotEqual(a.Hash(), c.Hash())
+	assert.Equal(int64(2), c.GetVotingPower(net.pubKeys[3]))
+	assert.Equal(int64(1), a.GetVotingPower(net.pubKeys[3]))
+}
+
+// TestVerifySignatureCommittee shows that messages are only taken from the
+// validators of the height they're verified at, not from any key ICommittee
+// knows
+func TestVerifySignatureCommittee(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	var a, b message.PubKey = "val_pubkey0", "val_pubkey1"
+	pubVal := mock.NewMockIPubValidator(ctrl)
+	pubVal.EXPECT().VerifySig(gomock.Any(), gomock.Any()).Return(true).AnyTimes()
+	pubVal.EXPECT().GetVotingPower().Return(int64(1)).AnyTimes()
+	privVal := mock.NewMockIPrivValidator(ctrl)
+	privVal.EXPECT().GetPubKey().Return(a).AnyTimes()
+	committee := mock.NewMockICommittee(ctrl)
+	committee.EXPECT().GetValidator(gomock.Any()).Return(pubVal).AnyTimes()
+	list := []message.PubKey{a}
+	committee.EXPECT().GetValidatorList().DoAndReturn(func() []message.PubKey {
+		return list
+	}).AnyTimes()
+
+	vals := NewValidators(committee, privVal)
+	nrs := func(height int64, signer message.PubKey) *message.NewRoundStep {
+		return &message.NewRoundStep{Height: height, Address: signer, Signature: []byte("sig")}
+	}
+	// no committee yet
+	assert.False(vals.VerifySignature(nrs(1, a)))
+
+	vals.updateHeight(1, 0)
+	assert.True(vals.VerifySignature(nrs(1, a)))
+	assert.False(vals.VerifySignature(nrs(1, b)))
+
+	// b joins at height 2
+	list = []message.PubKey{a, b}
+	vals.updateHeight(2, 0)
+	assert.True(vals.VerifySignature(nrs(2, b)))
+	assert.False(vals.VerifySignatureAt(nrs(1, b), 1))
+	assert.True(vals.VerifySignatureAt(nrs(1, a), 1))
+	// the committee of a height above ours is the current one
+	assert.True(vals.VerifySignatureAt(nrs(5, b), 5))
+}
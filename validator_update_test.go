@@ -0,0 +1,195 @@
+package gobft
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/coschain/gobft/custom"
+	"github.com/coschain/gobft/custom/mock"
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// updaterCommittee is an ICommittee that lets gobft apply its validator
+// updates
+type updaterCommittee struct {
+	*mock.MockICommittee
+	initial []message.PubKey
+	updates map[int64][]custom.ValidatorUpdate
+	saved   map[int64][]custom.ValidatorUpdate
+	// the lowest height ValidatorUpdates is asked for
+	lowest int64
+}
+
+func (uc *updaterCommittee) GetValidatorList() []message.PubKey {
+	return uc.initial
+}
+
+func (uc *updaterCommittee) ValidatorUpdates(height int64) []custom.ValidatorUpdate {
+	if uc.lowest == 0 || height < uc.lowest {
+		uc.lowest = height
+	}
+	return uc.updates[height]
+}
+
+func (uc *updaterCommittee) SaveValidatorSet(height int64, validators []custom.ValidatorUpdate) error {
+	if uc.saved == nil {
+		uc.saved = make(map[int64][]custom.ValidatorUpdate)
+	}
+	uc.saved[height] = validators
+	return nil
+}
+
+func (uc *updaterCommittee) LoadValidatorSet(height int64) (int64, []custom.ValidatorUpdate, bool) {
+	for h := height; h >= 1; h-- {
+		if vals, ok := uc.saved[h]; ok {
+			return h, vals, true
+		}
+	}
+	return 0, nil, false
+}
+
+func TestValidatorSetUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 5, []message.ProposedData{x, x, x, x, x})
+	committee := net.nodes[0].committee
+	keys := net.pubKeys
+	vs := NewValidatorSet(1, committee)
+
+	for _, c := range []struct {
+		updates []custom.ValidatorUpdate
+		err     error
+	}{
+		{[]custom.ValidatorUpdate{{PubKey: keys[0], Power: -1}}, ErrValUpdateNegativePower},
+		{[]custom.ValidatorUpdate{{PubKey: keys[0], Power: 2}, {PubKey: keys[0], Power: 2}}, ErrValUpdateDuplicated},
+		{[]custom.ValidatorUpdate{{PubKey: keys[0], Power: 3}}, ErrValUpdateTooMuchPower},
+		{[]custom.ValidatorUpdate{{PubKey: keys[0], Power: 0}, {PubKey: keys[1], Power: 0}}, ErrValUpdateTooMuchPower},
+	} {
+		next, err := vs.update(2, c.updates, committee)
+		assert.Equal(c.err, err)
+		assert.Equal(int64(2), next.Height())
+		assert.Equal(vs.Hash(), next.Hash())
+	}
+
+	single := newValidatorSet(1, keys[:1], map[message.PubKey]int64{keys[0]: 1}, committee)
+	_, err := single.update(2, []custom.ValidatorUpdate{{PubKey: keys[0], Power: 0}}, committee)
+	assert.Equal(ErrValUpdateEmptySet, err)
+
+	// removed validators leave the others in order, new ones are appended
+	next, err := vs.update(2, []custom.ValidatorUpdate{{PubKey: keys[1], Power: 0}}, committee)
+	assert.Nil(err)
+	next, err = next.update(3, []custom.ValidatorUpdate{{PubKey: "new", Power: 1}}, committee)
+	assert.Nil(err)
+	assert.Equal([]message.PubKey{keys[0], keys[2], keys[3], keys[4], "new"}, next.List())
+	assert.Equal(vs.TotalVotingPower(), next.TotalVotingPower())
+	assert.False(next.Has(keys[1]))
+	assert.NotEqual(vs.Hash(), next.Hash())
+}
+
+// TestValidatorUpdates shows that validator updates returned after a
+// commit take effect ValidatorUpdateDelay heights later, unless they're
+// invalid, and that a restarted node works out the same committee.
+func TestValidatorUpdates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	const E = 4
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 5, []message.ProposedData{x, x, x, x, x})
+	updates := map[int64][]custom.ValidatorUpdate{
+		// E joins at height 3
+		1: {{PubKey: net.pubKeys[E], Power: 1}},
+		// discarded at height 4
+		2: {{PubKey: net.pubKeys[0], Power: -1}},
+		// discarded at height 5, 2 out of 5 is more than 1/3
+		3: {{PubKey: net.pubKeys[0], Power: 0}, {PubKey: net.pubKeys[1], Power: 0}},
+	}
+	for _, node := range net.nodes {
+		node.core.validators.CustomValidators = &updaterCommittee{
+			MockICommittee: node.committee,
+			initial:        net.pubKeys[:E],
+			updates:        updates,
+		}
+	}
+	maxHeight := int64(1)
+	votedAt := make(map[int64]bool)
+	net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+		vote, ok := msg.(*message.Vote)
+		if ok && from == E {
+			votedAt[vote.Height] = true
+		}
+		return !ok || vote.Height <= maxHeight
+	}
+	committed := func(height int) func() bool {
+		return func() bool {
+			for _, node := range net.nodes {
+				if len(node.commits) < height {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	net.start()
+	for h := int64(1); h <= 4; h++ {
+		maxHeight = h
+		net.runUntil(committed(int(h)), 100)
+	}
+	assert.False(votedAt[1])
+	assert.False(votedAt[2])
+	assert.True(votedAt[3])
+	assert.True(votedAt[4])
+
+	for _, node := range net.nodes {
+		set := node.core.validators.Current()
+		assert.Equal(int64(5), set.Height())
+		assert.Equal(net.pubKeys, set.List())
+		assert.Equal(int64(5), set.TotalVotingPower())
+		assert.Equal(set.Hash(), node.commits[3].ValSet)
+		assert.NotEqual(set.Hash(), node.commits[1].ValSet)
+	}
+
+	// a node that starts at height 5 loads the committee saved
+	expected := net.nodes[0].core.validators.Current().Hash()
+	saved := net.nodes[0].core.validators.CustomValidators.(*updaterCommittee).saved
+	assert.Len(saved, 5)
+	delay := DefaultConfig().ValidatorUpdateDelay
+	restart := func(saved map[int64][]custom.ValidatorUpdate) (*updaterCommittee, *ValidatorSet, []error) {
+		uc := &updaterCommittee{
+			MockICommittee: net.nodes[0].committee,
+			initial:        net.pubKeys[:E],
+			updates:        updates,
+			saved:          saved,
+		}
+		set, errs := NewValidators(uc, nil).updateHeight(5, delay)
+		return uc, set, errs
+	}
+	uc, set, errs := restart(saved)
+	assert.Empty(errs)
+	assert.Equal(expected, set.Hash())
+	assert.Equal(5-delay+1, uc.lowest)
+
+	// or works it out from the last one saved, reporting the updates
+	// discarded on the way
+	uc, set, errs = restart(map[int64][]custom.ValidatorUpdate{3: saved[3]})
+	assert.Equal(expected, set.Hash())
+	assert.Equal(3-delay+1, uc.lowest)
+	if assert.Len(errs, 2) {
+		assert.Equal(ErrValUpdateNegativePower, errors.Cause(errs[0]))
+		assert.Equal(ErrValUpdateTooMuchPower, errors.Cause(errs[1]))
+	}
+	// and from height 1 if there's none
+	uc, set, errs = restart(nil)
+	assert.Equal(expected, set.Hash())
+	assert.Equal(int64(1), uc.lowest)
+	assert.Len(errs, 2)
+	assert.Len(uc.saved, 1)
+}
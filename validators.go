@@ -5,6 +5,7 @@ import (
 
 	"github.com/coschain/gobft/custom"
 	"github.com/coschain/gobft/message"
+	"github.com/pkg/errors"
 )
 
 type Validators struct {
@@ -13,47 +14,210 @@ type Validators struct {
 
 	CustomValidators custom.ICommittee
 	privVal          custom.IPrivValidator
+	signGuard        *SignGuard
+	// messages are signed and verified on this chain
+	chainID string
+	// aggregates the precommits into CommitCertificates, nil if it's off
+	aggregator custom.IAggregator
+
+	// committees of the current and the previous height
+	sets map[int64]*ValidatorSet
+	// validator updates of an IValidatorUpdater, keys: height they take
+	// effect at
+	updates map[int64][]custom.ValidatorUpdate
 }
 
 func NewValidators(val custom.ICommittee, pVal custom.IPrivValidator) *Validators {
+	// an in-memory guard never fails to be created
+	sg, _ := NewSignGuard(pVal, "")
 	v := &Validators{
 		CustomValidators: val,
 		privVal:          pVal,
+		signGuard:        sg,
+		sets:             make(map[int64]*ValidatorSet),
+		updates:          make(map[int64][]custom.ValidatorUpdate),
 	}
 	return v
 }
 
-func (v *Validators) Sign(msg message.ConsensusMessage) {
-	msg.SetSigner(v.privVal.GetPubKey())
-	msg.SetSignature(v.privVal.Sign(msg.Digest()))
+// updateHeight switches to the committee of height, the new current height.
+// It's a snapshot of CustomValidators unless it's an IValidatorUpdater, see
+// ValidatorSet. The errors report the validator updates discarded at height,
+// or at the heights replayed when we just started, and a failure to save the
+// committee. Committees before the previous height are dropped.
+func (v *Validators) updateHeight(height int64, delay int64) (*ValidatorSet, []error) {
+	v.Lock()
+	defer v.Unlock()
+
+	var vs *ValidatorSet
+	var errs []error
+	updater, ok := v.CustomValidators.(custom.IValidatorUpdater)
+	if !ok {
+		vs = NewValidatorSet(height, v.CustomValidators)
+	} else if prev := v.sets[height-1]; prev != nil {
+		var err error
+		if vs, err = prev.update(height, v.updates[height], v.CustomValidators); err != nil {
+			errs = append(errs, errors.Wrapf(err, "height %d", height))
+		}
+	} else {
+		// we just started, go on from the last committee saved
+		vs, errs = v.replay(updater, height, delay)
+	}
+	if ok {
+		if err := updater.SaveValidatorSet(height, vs.updates()); err != nil {
+			errs = append(errs, errors.Wrapf(err, "saving the committee of height %d", height))
+		}
+	}
+	vs.chainID = v.chainID
+	vs.aggregator = v.aggregator
+	v.height = height
+	v.sets[height] = vs
+	for h := range v.sets {
+		if h < height-1 || h > height {
+			delete(v.sets, h)
+		}
+	}
+	for h := range v.updates {
+		if h <= height-1 {
+			delete(v.updates, h)
+		}
+	}
+	return vs, errs
 }
 
-func (v *Validators) GetSelfPubKey() message.PubKey {
-	return v.privVal.GetPubKey()
+// replay works out the committee of height from the last one saved, or from
+// the one of height 1 if there's none, and gets the updates decided in the
+// last delay heights, which take effect from height on
+func (v *Validators) replay(updater custom.IValidatorUpdater, height int64, delay int64) (*ValidatorSet, []error) {
+	var vs *ValidatorSet
+	if saved, vals, ok := updater.LoadValidatorSet(height); ok && saved >= 1 && saved <= height {
+		list := make([]message.PubKey, len(vals))
+		powers := make(map[message.PubKey]int64, len(vals))
+		for i, val := range vals {
+			list[i] = val.PubKey
+			powers[val.PubKey] = val.Power
+		}
+		vs = newValidatorSet(saved, list, powers, v.CustomValidators)
+	} else {
+		vs = NewValidatorSet(1, v.CustomValidators)
+	}
+	from := vs.Height() - delay + 1
+	if from < 1 {
+		from = 1
+	}
+	for h := from; h < height; h++ {
+		v.addUpdates(updater, h, delay)
+	}
+	var errs []error
+	for h := vs.Height(); h < height; h++ {
+		var err error
+		if vs, err = vs.update(h+1, v.updates[h+1], v.CustomValidators); err != nil {
+			errs = append(errs, errors.Wrapf(err, "height %d", h+1))
+		}
+	}
+	return vs, errs
 }
 
-func (v *Validators) VerifySignature(msg message.ConsensusMessage) bool {
-	val := v.CustomValidators.GetValidator(msg.GetSigner())
-	if val == nil {
-		return false
+// committed gets the validator updates decided at height, which is just
+// committed, if CustomValidators is an IValidatorUpdater
+func (v *Validators) committed(height int64, delay int64) {
+	if updater, ok := v.CustomValidators.(custom.IValidatorUpdater); ok {
+		v.Lock()
+		v.addUpdates(updater, height, delay)
+		v.Unlock()
+	}
+}
+
+func (v *Validators) addUpdates(updater custom.IValidatorUpdater, height int64, delay int64) {
+	if updates := updater.ValidatorUpdates(height); len(updates) > 0 {
+		v.updates[height+delay] = updates
+	}
+}
+
+// ValidatorSet returns the committee of height, nil if it's neither the
+// current height nor the previous one
+func (v *Validators) ValidatorSet(height int64) *ValidatorSet {
+	v.RLock()
+	defer v.RUnlock()
+	return v.sets[height]
+}
+
+// Current returns the committee of the current height
+func (v *Validators) Current() *ValidatorSet {
+	v.RLock()
+	defer v.RUnlock()
+	return v.sets[v.height]
+}
+
+// SetChainID sets the chain messages are signed and verified on
+func (v *Validators) SetChainID(chainID string) {
+	v.Lock()
+	defer v.Unlock()
+	v.chainID = chainID
+	v.signGuard.setChainID(chainID)
+	for _, vs := range v.sets {
+		vs.chainID = chainID
+	}
+}
+
+// SetAggregator sets the IAggregator precommits are aggregated with
+func (v *Validators) SetAggregator(agg custom.IAggregator) {
+	v.Lock()
+	defer v.Unlock()
+	v.aggregator = agg
+	for _, vs := range v.sets {
+		vs.aggregator = agg
 	}
-	return val.VerifySig(msg.Digest(), msg.GetSignature())
 }
 
-func (v *Validators) GetVotingPower(address *message.PubKey) int64 {
-	val := v.CustomValidators.GetValidator(*address)
-	if val == nil {
-		//log.Errorf("%s is not a  validator", *address)
-		return 0
+// LoadSignGuard replaces the in-memory SignGuard with one persisted in path
+func (v *Validators) LoadSignGuard(path string) error {
+	sg, err := NewSignGuard(v.privVal, path)
+	if err != nil {
+		return err
 	}
+	sg.setChainID(v.chainID)
+	v.signGuard = sg
+	return nil
+}
 
-	return val.GetVotingPower()
+// Sign signs msg. Votes are signed through SignGuard so that we never
+// double sign. Non-nil precommits are also signed for aggregation if there's
+// an IAggregator and privVal is an IAggPrivValidator.
+func (v *Validators) Sign(msg message.ConsensusMessage) error {
+	msg.SetSigner(v.privVal.GetPubKey())
+	if vote, ok := msg.(*message.Vote); ok {
+		if err := v.signGuard.SignVote(vote); err != nil {
+			return err
+		}
+		if aggVal, ok := v.privVal.(custom.IAggPrivValidator); ok && v.aggregator != nil &&
+			vote.Type == message.PrecommitType && !vote.Proposed.IsNil() {
+			vote.AggSignature = aggVal.AggSign(vote.AggSignDigest(v.chainID))
+		}
+		return nil
+	}
+	msg.SetSignature(v.privVal.Sign(message.SignDigest(msg, v.chainID)))
+	return nil
 }
 
-func (v *Validators) GetTotalVotingPower() int64 {
-	return v.CustomValidators.TotalVotingPower()
+func (v *Validators) GetSelfPubKey() message.PubKey {
+	return v.privVal.GetPubKey()
 }
 
-func (v *Validators) GetValidatorNum() int {
-	return v.CustomValidators.GetValidatorNum()
+// VerifySignature returns true if msg is signed by a validator of the
+// current height
+func (v *Validators) VerifySignature(msg message.ConsensusMessage) bool {
+	vs := v.Current()
+	return vs != nil && vs.VerifySignature(msg)
+}
+
+// VerifySignatureAt returns true if msg is signed by a validator of height,
+// or of the current height if the committee of height isn't kept, e.g. it's
+// above ours
+func (v *Validators) VerifySignatureAt(msg message.ConsensusMessage, height int64) bool {
+	vs := v.ValidatorSet(height)
+	if vs == nil {
+		vs = v.Current()
+	}
+	return vs != nil && vs.VerifySignature(msg)
 }
@@ -0,0 +1,110 @@
+package gobft
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// The link from A to D is down and D gets no vote from B. C's precommits are
+// lost so that A and B can't commit without D's precommit, which D only signs
+// once C relays the proposal and the prevotes it missed.
+func TestRelayVotes(t *testing.T) {
+	const (
+		A = iota
+		B
+		C
+		D
+	)
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+
+	run := func(relay bool) (*testNetwork, int) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		net := newTestNetwork(t, ctrl, 4, []message.ProposedData{x, x, x, x})
+		for _, node := range net.nodes {
+			node.core.cfg.RelayVotes = relay
+		}
+		batches := 0
+		net.filter = func(from, to int, msg message.ConsensusMessage) bool {
+			switch m := msg.(type) {
+			case *message.Vote:
+				if m.Height > 1 || m.Type == message.PrecommitType && m.Address == net.pubKeys[C] {
+					return false
+				}
+				if from == B && to == D {
+					return false
+				}
+			case *message.VoteBatch:
+				if to == D {
+					batches++
+				}
+			case *message.FetchVotesReq, *message.FetchVotesRsp, *message.Commit:
+				return false
+			}
+			return from != A || to != D
+		}
+		net.start()
+		for i := 0; i < 20 && len(net.nodes[A].commits) == 0; i++ {
+			net.deliver()
+			net.fireTimeouts()
+		}
+		return net, batches
+	}
+
+	assert := assert.New(t)
+	net, batches := run(false)
+	assert.Equal(0, batches)
+	for _, i := range []int{A, B, D} {
+		assert.Equal(0, len(net.nodes[i].commits))
+	}
+
+	net, batches = run(true)
+	assert.True(batches > 0)
+	for _, i := range []int{A, B, C} {
+		if assert.Equal(1, len(net.nodes[i].commits)) {
+			assert.Equal(x, net.nodes[i].commits[0].ProposedData)
+			assert.Equal(0, net.nodes[i].commits[0].Round())
+		}
+	}
+}
+
+func TestHandleVoteBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 4, []message.ProposedData{x, x, x, x})
+	net.start()
+	core := net.nodes[1].core
+
+	var votes []*message.Vote
+	for i := 2; i < 4; i++ {
+		vote := message.NewVote(message.PrevoteType, 1, 0, &x, &message.NilData)
+		assert.True(net.nodes[i].core.signVote(vote))
+		votes = append(votes, vote)
+	}
+
+	// not signed by a validator
+	batch := message.NewVoteBatch(votes)
+	batch.SetSigner("stranger")
+	batch.SetSignature(batch.Digest())
+	core.handleMsg(msgInfo{batch, testPeer(0)})
+	assert.Equal(0, core.Votes.Prevotes(0).BitArray().Count())
+
+	batch = message.NewVoteBatch(votes)
+	assert.Nil(net.nodes[0].core.validators.Sign(batch))
+	assert.Nil(batch.ValidateBasic())
+	core.handleMsg(msgInfo{batch, testPeer(0)})
+	assert.Equal(2, core.Votes.Prevotes(0).BitArray().Count())
+
+	// duplicated votes
+	batch = message.NewVoteBatch(append(votes, votes[0]))
+	assert.Nil(net.nodes[0].core.validators.Sign(batch))
+	assert.NotNil(batch.ValidateBasic())
+}
@@ -13,33 +13,38 @@ import (
 )
 
 /*
-	VoteSet helps collect signatures from validators at each height+round for a
-	predefined vote type.
+VoteSet helps collect signatures from validators at each height+round for a
+predefined vote type.
 
-	We need VoteSet to be able to keep track of conflicting votes when validators
-	double-sign.  Yet, we can't keep track of *all* the votes seen, as that could
-	be a DoS attack vector.
+We need VoteSet to be able to keep track of conflicting votes when validators
+double-sign.  Yet, we can't keep track of *all* the votes seen, as that could
+be a DoS attack vector.
 
-	NOTE: Assumes that the sum total of voting power does not exceed MaxUInt64.
+NOTE: Assumes that the sum total of voting power does not exceed MaxUInt64.
 */
 type VoteSet struct {
-	height     int64
-	round      int
-	type_      message.VoteType
-	validators *Validators
-	base       message.ProposedData
+	height int64
+	round  int
+	type_  message.VoteType
+	valSet *ValidatorSet
+	base   message.ProposedData
 
 	mtx                 sync.Mutex
 	sum                 int64
 	distinctVoter       int
 	minorQuorum         message.ProposedData
-	maj23               message.ProposedData // First 2/3 majority seen
+	maj23               message.ProposedData             // First 2/3 majority seen
+	votes               map[message.PubKey]*message.Vote // First vote seen from each validator
 	votesByProposedData map[message.ProposedData]*proposedDataVotes
-	conflictingVotes    map[message.PubKey][]*message.Vote // TODO: track conflicting votes
+	conflictingVotes    map[message.PubKey][]*message.Vote
+	// verified AggSignatures of the counted precommits
+	aggSigs map[message.PubKey][]byte
+	// certificate of the Commit the set is made from, see newCertifiedVoteSet
+	cert *message.CommitCertificate
 }
 
 // Constructs a new VoteSet struct used to accumulate votes for given height/round.
-func NewVoteSet(height int64, round int, type_ message.VoteType, valSet *Validators, b *message.ProposedData) *VoteSet {
+func NewVoteSet(height int64, round int, type_ message.VoteType, valSet *ValidatorSet, b *message.ProposedData) *VoteSet {
 	if height == 0 {
 		common.PanicSanity("Cannot make VoteSet for height == 0, doesn't make sense.")
 	}
@@ -47,13 +52,24 @@ func NewVoteSet(height int64, round int, type_ message.VoteType, valSet *Validat
 		height:              height,
 		round:               round,
 		type_:               type_,
-		validators:          valSet,
+		valSet:              valSet,
 		base:                *b,
+		votes:               make(map[message.PubKey]*message.Vote),
 		votesByProposedData: make(map[message.ProposedData]*proposedDataVotes),
 		conflictingVotes:    make(map[message.PubKey][]*message.Vote),
+		aggSigs:             make(map[message.PubKey][]byte),
 	}
 }
 
+// newCertifiedVoteSet makes the precommits of a Commit whose Certificate is
+// verified. We don't have the precommits, but they reach +2/3.
+func newCertifiedVoteSet(commit *message.Commit, valSet *ValidatorSet) *VoteSet {
+	voteSet := NewVoteSet(commit.Height(), commit.Round(), message.PrecommitType, valSet, &commit.Prev)
+	voteSet.maj23 = commit.ProposedData
+	voteSet.cert = commit.Certificate
+	return voteSet
+}
+
 func (voteSet *VoteSet) Height() int64 {
 	if voteSet == nil {
 		return 0
@@ -84,8 +100,10 @@ func (voteSet *VoteSet) Type() byte {
 
 // Returns added=true if vote is valid and new.
 // Otherwise returns err=ErrVote[
-//		UnexpectedStep | InvalidIndex | InvalidAddress |
-//		InvalidSignature | InvalidBlockHash | ConflictingVotes ]
+//
+//	UnexpectedStep | InvalidIndex | InvalidAddress |
+//	InvalidSignature | InvalidBlockHash | ConflictingVotes ]
+//
 // Duplicate votes return added=false, err=nil.
 // Conflicting votes return added=*, err=ErrVoteConflictingVotes.
 // NOTE: vote should not be mutated after adding.
@@ -109,6 +127,9 @@ func (voteSet *VoteSet) addVote(vote *message.Vote) (added bool, err error) {
 	if vote.Prev != voteSet.base {
 		return false, ErrVoteMismatchedBase
 	}
+	if vote.ValSet != voteSet.valSet.Hash() {
+		return false, ErrVoteWrongValSet
+	}
 
 	// Make sure the step matches.
 	if (vote.Height != voteSet.height) ||
@@ -122,6 +143,8 @@ func (voteSet *VoteSet) addVote(vote *message.Vote) (added bool, err error) {
 	// If we already know of this vote, return false.
 	if existing, ok := voteSet.getVote(&vote.Proposed, vote.Address); ok {
 		if bytes.Equal(existing.Signature, vote.Signature) {
+			// the copy we have may have come without its AggSignature
+			voteSet.addAggSignature(vote)
 			return false, errors.New("duplicate vote") // duplicate
 		}
 		return false, errors.Wrapf(ErrVoteNonDeterministicSignature, "Existing vote: %v; New vote: %v", existing, vote)
@@ -129,22 +152,46 @@ func (voteSet *VoteSet) addVote(vote *message.Vote) (added bool, err error) {
 
 	// Check signature.
 
-	if !voteSet.validators.VerifySignature(vote) {
+	if !voteSet.valSet.VerifySignature(vote) {
 		return false, errors.Wrapf(ErrVoteInvalidSignature, "Failed to verify vote with PubKey %s", vote.Address)
 	}
 
 	// Add vote and get conflicting vote if any.
-	added, conflicting := voteSet.addVerifiedVote(vote, voteSet.validators.GetVotingPower(&vote.Address))
+	added, conflicting := voteSet.addVerifiedVote(vote, voteSet.valSet.GetVotingPower(vote.Address))
 	if conflicting != nil {
-		//return added, NewConflictingVoteError()
-		return added, errors.New("conflicting vote")
+		return added, NewConflictingVoteError(conflicting, vote)
 	}
 	if !added {
 		common.PanicSanity("Expected to add non-conflicting vote")
 	}
+	voteSet.addAggSignature(vote)
 	return added, nil
 }
 
+// addAggSignature keeps the AggSignature of a counted precommit if it's valid
+func (voteSet *VoteSet) addAggSignature(vote *message.Vote) {
+	if len(vote.AggSignature) == 0 || voteSet.type_ != message.PrecommitType || vote.Proposed.IsNil() {
+		return
+	}
+	if _, ok := voteSet.aggSigs[vote.Address]; ok {
+		return
+	}
+	if voteSet.valSet.verifyAggSignature(vote) {
+		voteSet.aggSigs[vote.Address] = vote.AggSignature
+	}
+}
+
+// GetByAddress returns the vote counted for the validator, or nil if we
+// don't have one
+func (voteSet *VoteSet) GetByAddress(address message.PubKey) *message.Vote {
+	if voteSet == nil {
+		return nil
+	}
+	voteSet.mtx.Lock()
+	defer voteSet.mtx.Unlock()
+	return voteSet.votes[address]
+}
+
 // Returns (vote, true) if vote exists for valIndex and blockKey.
 func (voteSet *VoteSet) getVote(pd *message.ProposedData, address message.PubKey) (vote *message.Vote, ok bool) {
 	if pdvotes, ok := voteSet.votesByProposedData[*pd]; ok {
@@ -156,12 +203,22 @@ func (voteSet *VoteSet) getVote(pd *message.ProposedData, address message.PubKey
 }
 
 // Assumes signature is valid.
-// If conflicting vote exists, returns it.
+// If conflicting vote exists, returns it. Only the first vote of a validator
+// is counted, the conflicting ones are kept aside as evidence.
 func (voteSet *VoteSet) addVerifiedVote(vote *message.Vote, votingPower int64) (added bool, conflicting *message.Vote) {
+	if existing, ok := voteSet.votes[vote.Address]; ok {
+		// votes for the same ProposedData are filtered out by addVote, so
+		// existing must be for a different one. One conflicting vote is
+		// enough to prove the misbehaviour, don't let it eat up memory.
+		if _, tracked := voteSet.conflictingVotes[vote.Address]; !tracked {
+			voteSet.conflictingVotes[vote.Address] = []*message.Vote{vote}
+		}
+		return false, existing
+	}
+	voteSet.votes[vote.Address] = vote
+
 	byProposed, ok := voteSet.votesByProposedData[vote.Proposed]
-	if ok {
-		// TODO: check conflicting vote
-	} else {
+	if !ok {
 		byProposed = newProposedDataVotes()
 		voteSet.votesByProposedData[vote.Proposed] = byProposed
 	}
@@ -169,7 +226,7 @@ func (voteSet *VoteSet) addVerifiedVote(vote *message.Vote, votingPower int64) (
 	// no conflict, add the vote
 	// Before adding to votesByBlock, see if we'll exceed quorum
 	origSum := byProposed.sum
-	quorum := voteSet.validators.GetTotalVotingPower()*2/3 + 1
+	quorum := voteSet.valSet.TotalVotingPower()*2/3 + 1
 
 	// Add vote to votesByBlock
 	byProposed.addVote(vote, votingPower)
@@ -221,7 +278,7 @@ func (voteSet *VoteSet) MinorQuorum() (message.ProposedData, bool) {
 	voteSet.mtx.Lock()
 	defer voteSet.mtx.Unlock()
 
-	valNum := voteSet.validators.GetValidatorNum()
+	valNum := voteSet.valSet.Size()
 	if voteSet.distinctVoter > valNum*2/3 ||
 		valNum < 4 && voteSet.distinctVoter >= (valNum+1)/2 {
 		return voteSet.minorQuorum, true
@@ -236,13 +293,13 @@ func (voteSet *VoteSet) HasTwoThirdsAny() bool {
 	}
 	voteSet.mtx.Lock()
 	defer voteSet.mtx.Unlock()
-	return voteSet.sum > voteSet.validators.GetTotalVotingPower()*2/3
+	return voteSet.sum > voteSet.valSet.TotalVotingPower()*2/3
 }
 
 func (voteSet *VoteSet) HasAll() bool {
 	voteSet.mtx.Lock()
 	defer voteSet.mtx.Unlock()
-	return voteSet.sum == voteSet.validators.GetTotalVotingPower()
+	return voteSet.sum == voteSet.valSet.TotalVotingPower()
 }
 
 // If there was a +2/3 majority for blockID, return blockID and true.
@@ -270,7 +327,7 @@ func (voteSet *VoteSet) StringIndented(indent string) string {
 	voteSet.mtx.Lock()
 	defer voteSet.mtx.Unlock()
 
-	voteStrings := make([]string, 0, common.ValNum)
+	voteStrings := make([]string, 0, len(voteSet.votes))
 	for _, proposedVotes := range voteSet.votesByProposedData {
 		for _, vote := range proposedVotes.votes {
 			if vote == nil {
@@ -292,7 +349,7 @@ func (voteSet *VoteSet) StringIndented(indent string) string {
 
 // return the power voted, the total, and the fraction
 func (voteSet *VoteSet) sumTotalFrac() (int64, int64, float64) {
-	voted, total := voteSet.sum, voteSet.validators.GetTotalVotingPower()
+	voted, total := voteSet.sum, voteSet.valSet.TotalVotingPower()
 	fracVoted := float64(voted) / float64(total)
 	return voted, total, fracVoted
 }
@@ -300,56 +357,117 @@ func (voteSet *VoteSet) sumTotalFrac() (int64, int64, float64) {
 //--------------------------------------------------------------------------------
 // Commit
 
+// MakeCommit returns the Commit of the +2/3 precommits. It carries a
+// CommitCertificate instead of them if there's one, see makeCertificate.
 func (voteSet *VoteSet) MakeCommit() *message.Commit {
 	if voteSet.maj23 == message.NilData {
 		common.PanicSanity("[MakeCommit] precommit doen't reach +2/3")
 	}
-	precommits := voteSet.votesByProposedData[voteSet.maj23].getAllVotes()
-	return &message.Commit{
+	commit := &message.Commit{
 		ProposedData: voteSet.maj23,
-		Precommits:   precommits,
-		Prev:         precommits[0].Prev,
+		Prev:         voteSet.base,
+		ValSet:       voteSet.valSet.Hash(),
+	}
+	if cert := voteSet.makeCertificate(); cert != nil {
+		commit.Certificate = cert
+	} else {
+		commit.Precommits = voteSet.votesByProposedData[voteSet.maj23].getAllVotes()
 	}
+	return commit
 }
 
-func (voteSet *VoteSet) MakeFetchVotesReq() *message.FetchVotesReq {
-	voters := make([]message.PubKey, 0, common.ValNum)
-	for _, pd := range voteSet.votesByProposedData {
-		for pk := range pd.votes {
-			voters = append(voters, pk)
+// makeCertificate aggregates the AggSignatures of the precommits for maj23
+// if they're from +2/3 of the voting power. Otherwise it's the certificate
+// the set is made from, nil if there's none.
+func (voteSet *VoteSet) makeCertificate() *message.CommitCertificate {
+	agg := voteSet.valSet.aggregator
+	byProposed := voteSet.votesByProposedData[voteSet.maj23]
+	if agg == nil || byProposed == nil || len(voteSet.aggSigs) == 0 {
+		return voteSet.cert
+	}
+	validators := voteSet.valSet.List()
+	signers := common.NewBitArray(len(validators))
+	sigs := make([][]byte, 0, len(voteSet.aggSigs))
+	var power int64
+	for i, pk := range validators {
+		sig, ok := voteSet.aggSigs[pk]
+		if !ok || byProposed.getVote(pk) == nil {
+			continue
 		}
+		signers.SetIndex(i, true)
+		sigs = append(sigs, sig)
+		power += voteSet.valSet.GetVotingPower(pk)
+	}
+	if power <= voteSet.valSet.TotalVotingPower()*2/3 {
+		return voteSet.cert
 	}
+	aggSig, err := agg.Aggregate(sigs)
+	if err != nil {
+		return voteSet.cert
+	}
+	return &message.CommitCertificate{
+		Height:       voteSet.height,
+		Round:        voteSet.round,
+		Signers:      signers,
+		AggSignature: aggSig,
+	}
+}
+
+// BitArray returns the validators we have a vote from, indexed in the order
+// of ICommittee.GetValidatorList
+func (voteSet *VoteSet) BitArray() *common.BitArray {
+	if voteSet == nil {
+		return nil
+	}
+	voteSet.mtx.Lock()
+	defer voteSet.mtx.Unlock()
+	validators := voteSet.valSet.List()
+	ba := common.NewBitArray(len(validators))
+	for i, pk := range validators {
+		if _, ok := voteSet.votes[pk]; ok {
+			ba.SetIndex(i, true)
+		}
+	}
+	return ba
+}
+
+func (voteSet *VoteSet) MakeFetchVotesReq() *message.FetchVotesReq {
 	return &message.FetchVotesReq{
 		Type:   voteSet.type_,
 		Height: voteSet.height,
 		Round:  voteSet.round,
-		Voters: voters,
-		Time: time.Now(),
+		Voters: voteSet.BitArray(),
+		Time:   time.Now(),
 	}
 }
 
 func (voteSet *VoteSet) MakeFetchVotesRsp(req *message.FetchVotesReq) *message.FetchVotesRsp {
-	votes := make([]*message.Vote, 0, common.ValNum)
-	cache := make(map[message.PubKey]bool)
-	for i := range req.Voters {
-		cache[req.Voters[i]] = true
+	return &message.FetchVotesRsp{
+		Type:         voteSet.type_,
+		Height:       voteSet.height,
+		Round:        voteSet.round,
+		MissingVotes: voteSet.MissingVotes(req.Voters),
+		Time:         time.Now(),
 	}
+}
 
-	for _, pd := range voteSet.votesByProposedData {
-		for pk := range pd.votes {
-			if _, exist := cache[pk]; !exist {
-				votes = append(votes, pd.votes[pk])
-			}
+// MissingVotes returns the votes we have from the validators not in voters,
+// which is indexed in the order of the validator set. All the votes are
+// returned if voters is nil.
+func (voteSet *VoteSet) MissingVotes(voters *common.BitArray) []*message.Vote {
+	voteSet.mtx.Lock()
+	defer voteSet.mtx.Unlock()
+	validators := voteSet.valSet.List()
+	votes := make([]*message.Vote, 0, len(validators))
+	for i, pk := range validators {
+		if voters.GetIndex(i) {
+			continue
+		}
+		if vote, ok := voteSet.votes[pk]; ok {
+			votes = append(votes, vote)
 		}
 	}
-
-	return &message.FetchVotesRsp{
-		Type: voteSet.type_,
-		Height: voteSet.height,
-		Round: voteSet.round,
-		MissingVotes: votes,
-		Time: time.Now(),
-	}
+	return votes
 }
 
 type proposedDataVotes struct {
@@ -3,6 +3,7 @@ package gobft
 import (
 	"crypto/sha256"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -66,7 +67,8 @@ func TestValidatorsVotes(t *testing.T) {
 	valSet.EXPECT().GetValidator(pubkey4).Return(val1).AnyTimes()
 	valSet.EXPECT().IsValidator(gomock.Any()).Return(true).AnyTimes()
 	valSet.EXPECT().TotalVotingPower().Return(int64(4)).AnyTimes()
-	valSet.EXPECT().GetValidatorNum().Return(3).AnyTimes() // test minor quorum
+	valSet.EXPECT().GetValidatorNum().Return(3).AnyTimes()
+	valSet.EXPECT().GetValidatorList().Return([]message.PubKey{pubkey1, pubkey2, pubkey3}).AnyTimes() // test minor quorum
 	valSet.EXPECT().GetCurrentProposer(gomock.Any()).DoAndReturn(func(round int) message.PubKey {
 		return curProposers[round%4].GetPubKey()
 	}).AnyTimes()
@@ -79,21 +81,30 @@ func TestValidatorsVotes(t *testing.T) {
 	assert.Equal(proposedData, valSet.DecidesProposal())
 
 	vs := NewValidators(valSet, privVal1)
+	set, _ := vs.updateHeight(1, 2)
 	var prevCommitted message.ProposedData
-	hvSet1 := NewHeightVoteSet(1, vs, &prevCommitted)
+	hvSet1 := NewHeightVoteSet(1, set, &prevCommitted)
 
 	// sign votes
 	prevote1_1 := message.NewVote(message.PrevoteType, 1, 0, &proposedData, &prevCommitted)
+	prevote1_1.ValSet = set.Hash()
 	vs.Sign(prevote1_1)
 	prevote1_2 := message.NewVote(message.PrevoteType, 1, 0, &proposedData, &prevCommitted)
+	prevote1_2.ValSet = set.Hash()
 	prevote1_2.Address = pubkey2
 	prevote1_2.Signature = []byte(pubkey2)
 	prevote1_3 := message.NewVote(message.PrevoteType, 1, 0, &proposedData, &prevCommitted)
+	prevote1_3.ValSet = set.Hash()
 	prevote1_3.Address = pubkey3
 	prevote1_3.Signature = []byte(pubkey3)
-	prevote1_4 := message.NewVote(message.PrevoteType, 1, 0, &proposedData, &prevCommitted)
-	prevote1_4.Address = pubkey4
-	prevote1_4.Signature = []byte(pubkey4)
+
+	// a vote signed under another validator set isn't counted
+	prevote1_1x := message.NewVote(message.PrevoteType, 1, 0, &proposedData, &prevCommitted)
+	prevote1_1x.Address = pubkey1
+	prevote1_1x.Signature = []byte(pubkey1)
+	added, err := hvSet1.AddVote(prevote1_1x)
+	assert.False(added)
+	assert.Equal(ErrVoteWrongValSet, err)
 
 	// test maj23
 	hvSet1.AddVote(prevote1_1)
@@ -112,3 +123,151 @@ func TestValidatorsVotes(t *testing.T) {
 	assert.True(ok)
 	assert.Equal(data, proposedData)
 }
+
+func TestConflictingVotes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	var pubkey1 message.PubKey = "val1_pubkey"
+	val1 := mock.NewMockIPubValidator(ctrl)
+	val1.EXPECT().GetVotingPower().Return(int64(1)).AnyTimes()
+	val1.EXPECT().VerifySig(gomock.Any(), gomock.Any()).Return(true).AnyTimes()
+	privVal1 := mock.NewMockIPrivValidator(ctrl)
+	privVal1.EXPECT().GetPubKey().Return(pubkey1).AnyTimes()
+
+	valSet := mock.NewMockICommittee(ctrl)
+	valSet.EXPECT().GetValidator(gomock.Any()).Return(val1).AnyTimes()
+	valSet.EXPECT().TotalVotingPower().Return(int64(4)).AnyTimes()
+	valSet.EXPECT().GetValidatorList().Return([]message.PubKey{pubkey1, "byzantine", "val3_pubkey", "val4_pubkey"}).AnyTimes()
+
+	set := NewValidatorSet(1, valSet)
+	var prevCommitted message.ProposedData
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	y := message.ProposedData(sha256.Sum256([]byte("y")))
+	hvSet := NewHeightVoteSet(1, set, &prevCommitted)
+
+	voteX := message.NewVote(message.PrevoteType, 1, 0, &x, &prevCommitted)
+	voteX.ValSet = set.Hash()
+	voteX.Address = "byzantine"
+	voteX.Signature = []byte("sigX")
+	voteY := message.NewVote(message.PrevoteType, 1, 0, &y, &prevCommitted)
+	voteY.ValSet = set.Hash()
+	voteY.Address = "byzantine"
+	voteY.Signature = []byte("sigY")
+
+	added, err := hvSet.AddVote(voteY)
+	assert.True(added)
+	assert.Nil(err)
+
+	added, err = hvSet.AddVote(voteX)
+	assert.False(added)
+	conflict, ok := err.(*ErrVoteConflictingVotes)
+	assert.True(ok)
+	assert.Equal(message.PubKey("byzantine"), conflict.PubKey)
+	// votes in evidence are ordered by ProposedData
+	assert.Equal(voteX, conflict.VoteA)
+	assert.Equal(voteY, conflict.VoteB)
+
+	// the conflicting vote is not counted
+	assert.Equal(int64(1), hvSet.Prevotes(0).sum)
+	assert.Equal(1, len(hvSet.Prevotes(0).conflictingVotes))
+
+	conflict.Reporter = pubkey1
+	conflict.Signature = []byte("reporter sig")
+	assert.Nil(conflict.ValidateBasic())
+}
+
+func TestCatchupRounds(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 4, []message.ProposedData{x, x, x, x})
+	net.start()
+	c := net.nodes[0].core
+	offenders := make(chan message.PubKey, 10)
+	c.SetMisbehaviourCallback(func(offender message.PubKey, err error) {
+		assert.Equal(ErrVoteUnwantedRound, err)
+		offenders <- offender
+	})
+
+	var prev message.ProposedData
+	vote := func(round int, from int) *message.Vote {
+		v := message.NewVote(message.PrecommitType, 1, round, &x, &prev)
+		v.ValSet = c.validators.Current().Hash()
+		v.Address = net.pubKeys[from]
+		v.Signature = []byte("sig")
+		return v
+	}
+
+	// a validator makes us track 2 rounds beyond ours at most
+	for r := 10; r < 1000; r++ {
+		c.handleMsg(msgInfo{vote(r, 1), testPeer(1)})
+	}
+	// round 0 is ours
+	assert.Len(c.Votes.roundVoteSets, 1+maxCatchupRounds)
+	assert.NotNil(c.Votes.Precommits(10).GetByAddress(net.pubKeys[1]))
+	assert.NotNil(c.Votes.Precommits(11).GetByAddress(net.pubKeys[1]))
+	assert.Nil(c.Votes.Precommits(12))
+	added, err := c.Votes.AddVote(vote(12, 1))
+	assert.False(added)
+	assert.Equal(ErrVoteUnwantedRound, err)
+
+	// and is reported once
+	select {
+	case offender := <-offenders:
+		assert.Equal(net.pubKeys[1], offender)
+	case <-time.After(time.Second):
+		t.Fatal("offender not reported")
+	}
+	assert.Len(offenders, 0)
+
+	// the rounds tracked for others are still open to anyone
+	added, err = c.Votes.AddVote(vote(11, 2))
+	assert.True(added)
+	assert.Nil(err)
+	added, err = c.Votes.AddVote(vote(20, 2))
+	assert.True(added)
+	assert.Nil(err)
+}
+
+// A validator that got ahead of us can get ahead again once we catch up
+func TestCatchupRoundsAfterCatchingUp(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 4, []message.ProposedData{x, x, x, x})
+	net.start()
+	c := net.nodes[0].core
+
+	var prev message.ProposedData
+	vote := func(round int) *message.Vote {
+		v := message.NewVote(message.PrecommitType, 1, round, &x, &prev)
+		v.ValSet = c.validators.Current().Hash()
+		v.Address = net.pubKeys[1]
+		v.Signature = []byte("sig")
+		return v
+	}
+
+	hvs := c.Votes
+	for r := 1; r <= maxCatchupRounds; r++ {
+		added, err := hvs.AddVote(vote(r))
+		assert.True(added)
+		assert.Nil(err)
+	}
+	_, err := hvs.AddVote(vote(maxCatchupRounds + 1))
+	assert.Equal(ErrVoteUnwantedRound, err)
+
+	hvs.SetRound(maxCatchupRounds)
+	for r := maxCatchupRounds + 1; r <= 2*maxCatchupRounds; r++ {
+		added, err := hvs.AddVote(vote(r))
+		assert.True(added)
+		assert.Nil(err)
+	}
+	_, err = hvs.AddVote(vote(2*maxCatchupRounds + 1))
+	assert.Equal(ErrVoteUnwantedRound, err)
+}
@@ -0,0 +1,331 @@
+package gobft
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/coschain/gobft/message"
+)
+
+const (
+	walFileName = "wal"
+
+	// maxWalRecordSize bounds a single record so that a corrupted length
+	// field can't make us allocate arbitrary memory during replay
+	maxWalRecordSize = 4 * 1024 * 1024
+)
+
+type walMsgType byte
+
+const (
+	walTypeMsgInfo   = walMsgType(0x01)
+	walTypeTimeout   = walMsgType(0x02)
+	walTypeEndHeight = walMsgType(0x03)
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// endHeightMessage marks the end of a height. Everything written after
+// endHeightMessage{h} belongs to height h+1
+type endHeightMessage struct {
+	Height int64
+}
+
+// walMessage is one of msgInfo, timeoutInfo or endHeightMessage
+type walMessage interface{}
+
+/*
+WAL is the write ahead log of the consensus state machine.
+
+Every msgInfo and timeoutInfo processed by receiveRoutine is written to
+the WAL before it's handled, and each vote we sign is synced to disk before
+it's broadcasted. When a height is committed an endHeightMessage is
+written. On restart, everything after the endHeightMessage of the last
+committed height is replayed to rebuild RoundState, HeightVoteSet and
+LockedProposal before we rejoin the network.
+
+On disk each record is laid out as:
+
+	| crc32c(4) | length(4) | type(1) | payload(length-1) |
+
+crc32c is calculated over type and payload.
+*/
+type WAL interface {
+	Write(walMessage) error
+	WriteSync(walMessage) error
+	// Replay calls fn on every message written after endHeightMessage{height}.
+	// found is false if there's no such endHeightMessage in the WAL.
+	Replay(height int64, fn func(walMessage)) (found bool, err error)
+	// Rotate drops everything in the WAL and starts over with
+	// endHeightMessage{height}
+	Rotate(height int64) error
+	Close() error
+}
+
+type baseWAL struct {
+	mtx  sync.Mutex
+	path string
+	file *os.File
+	buf  *bufio.Writer
+}
+
+// OpenWAL opens or creates the WAL in dir
+func OpenWAL(dir string) (WAL, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	w := &baseWAL{
+		path: filepath.Join(dir, walFileName),
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *baseWAL) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w.file = f
+	w.buf = bufio.NewWriter(f)
+	return nil
+}
+
+// Write writes msg to the WAL without fsync. It's used for messages that
+// can be received again from other validators.
+func (w *baseWAL) Write(msg walMessage) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if err := w.write(msg); err != nil {
+		return err
+	}
+	return w.buf.Flush()
+}
+
+// WriteSync writes msg to the WAL and makes sure it hits the disk. It must be
+// used for our own votes and end height marks.
+func (w *baseWAL) WriteSync(msg walMessage) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if err := w.write(msg); err != nil {
+		return err
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+func (w *baseWAL) write(msg walMessage) error {
+	rec, err := encodeWalMessage(msg)
+	if err != nil {
+		return err
+	}
+	_, err = w.buf.Write(rec)
+	return err
+}
+
+func (w *baseWAL) Replay(height int64, fn func(walMessage)) (bool, error) {
+	// fn may write to the WAL, so read everything before replaying
+	found, msgs, err := w.readAfter(height)
+	if err != nil {
+		return false, err
+	}
+	for i := range msgs {
+		fn(msgs[i])
+	}
+	return found, nil
+}
+
+func (w *baseWAL) readAfter(height int64) (bool, []walMessage, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if err := w.buf.Flush(); err != nil {
+		return false, nil, err
+	}
+	f, err := os.Open(w.path)
+	if err != nil {
+		return false, nil, err
+	}
+	defer f.Close()
+
+	var msgs []walMessage
+	found := false
+	dec := newWalDecoder(f)
+	for {
+		msg, err := dec.Decode()
+		if err != nil {
+			// io.EOF, or a corrupted tail if we crashed in the middle of
+			// a write. Everything before it is still valid.
+			break
+		}
+		if eh, ok := msg.(endHeightMessage); ok && eh.Height == height {
+			found = true
+			msgs = msgs[:0]
+			continue
+		}
+		if found {
+			msgs = append(msgs, msg)
+		}
+	}
+	return found, msgs, nil
+}
+
+func (w *baseWAL) Rotate(height int64) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	rec, err := encodeWalMessage(endHeightMessage{height})
+	if err != nil {
+		return err
+	}
+	tmpPath := w.path + ".tmp"
+	if err := writeFileSync(tmpPath, rec); err != nil {
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, w.path); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+func (w *baseWAL) Close() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func encodeWalMessage(msg walMessage) ([]byte, error) {
+	payload := &bytes.Buffer{}
+	switch m := msg.(type) {
+	case msgInfo:
+		payload.WriteByte(byte(walTypeMsgInfo))
+		payload.Write(m.Msg.Bytes())
+	case timeoutInfo:
+		payload.WriteByte(byte(walTypeTimeout))
+		binary.Write(payload, binary.BigEndian, int64(m.Duration))
+		binary.Write(payload, binary.BigEndian, m.Height)
+		binary.Write(payload, binary.BigEndian, int64(m.Round))
+		payload.WriteByte(byte(m.Step))
+	case endHeightMessage:
+		payload.WriteByte(byte(walTypeEndHeight))
+		binary.Write(payload, binary.BigEndian, m.Height)
+	default:
+		return nil, fmt.Errorf("unknown wal message type %T", msg)
+	}
+	if payload.Len() > maxWalRecordSize {
+		return nil, fmt.Errorf("wal record too big: %d", payload.Len())
+	}
+
+	rec := make([]byte, 8, 8+payload.Len())
+	binary.BigEndian.PutUint32(rec[0:4], crc32.Checksum(payload.Bytes(), crc32c))
+	binary.BigEndian.PutUint32(rec[4:8], uint32(payload.Len()))
+	return append(rec, payload.Bytes()...), nil
+}
+
+var errWalCorrupted = errors.New("wal record corrupted")
+
+type walDecoder struct {
+	rd *bufio.Reader
+}
+
+func newWalDecoder(rd io.Reader) *walDecoder {
+	return &walDecoder{rd: bufio.NewReader(rd)}
+}
+
+// Decode reads the next message. It returns io.EOF if there's nothing more
+// to read and errWalCorrupted if the record is truncated or damaged.
+func (dec *walDecoder) Decode() (walMessage, error) {
+	var header [8]byte
+	if n, err := io.ReadFull(dec.rd, header[:]); err != nil {
+		if err == io.EOF && n == 0 {
+			return nil, io.EOF
+		}
+		return nil, errWalCorrupted
+	}
+	crc := binary.BigEndian.Uint32(header[0:4])
+	length := binary.BigEndian.Uint32(header[4:8])
+	if length == 0 || length > maxWalRecordSize {
+		return nil, errWalCorrupted
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(dec.rd, payload); err != nil {
+		return nil, errWalCorrupted
+	}
+	if crc32.Checksum(payload, crc32c) != crc {
+		return nil, errWalCorrupted
+	}
+
+	body := payload[1:]
+	switch walMsgType(payload[0]) {
+	case walTypeMsgInfo:
+		msg, err := message.DecodeConsensusMsg(body)
+		if err != nil {
+			return nil, errWalCorrupted
+		}
+		return msgInfo{msg, nil}, nil
+	case walTypeTimeout:
+		if len(body) != 25 {
+			return nil, errWalCorrupted
+		}
+		return timeoutInfo{
+			Duration: time.Duration(binary.BigEndian.Uint64(body[0:8])),
+			Height:   int64(binary.BigEndian.Uint64(body[8:16])),
+			Round:    int(binary.BigEndian.Uint64(body[16:24])),
+			Step:     RoundStepType(body[24]),
+		}, nil
+	case walTypeEndHeight:
+		if len(body) != 8 {
+			return nil, errWalCorrupted
+		}
+		return endHeightMessage{int64(binary.BigEndian.Uint64(body))}, nil
+	default:
+		return nil, errWalCorrupted
+	}
+}
+
+// nilWAL is used when WAL is disabled
+type nilWAL struct{}
+
+func (nilWAL) Write(walMessage) error     { return nil }
+func (nilWAL) WriteSync(walMessage) error { return nil }
+func (nilWAL) Replay(int64, func(walMessage)) (bool, error) {
+	return false, nil
+}
+func (nilWAL) Rotate(int64) error { return nil }
+func (nilWAL) Close() error       { return nil }
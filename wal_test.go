@@ -0,0 +1,105 @@
+package gobft
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coschain/gobft/message"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWALReplay(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "gobft_wal")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	wal, err := OpenWAL(dir)
+	assert.Nil(err)
+
+	var prev message.ProposedData
+	data := message.ProposedData(sha256.Sum256([]byte("hello")))
+	vote := message.NewVote(message.PrevoteType, 2, 1, &data, &prev)
+	vote.Address = "val_pubkey0"
+	vote.Signature = []byte("sig")
+	ti := timeoutInfo{time.Second, 2, 1, RoundStepPrevoteWait}
+
+	assert.Nil(wal.Write(msgInfo{vote, nil}))
+	assert.Nil(wal.WriteSync(endHeightMessage{1}))
+	assert.Nil(wal.Write(msgInfo{vote, nil}))
+	assert.Nil(wal.WriteSync(ti))
+
+	var replayed []walMessage
+	found, err := wal.Replay(1, func(msg walMessage) {
+		replayed = append(replayed, msg)
+	})
+	assert.Nil(err)
+	assert.True(found)
+	assert.Equal(2, len(replayed))
+	mi, ok := replayed[0].(msgInfo)
+	assert.True(ok)
+	assert.Equal(vote.Digest(), mi.Msg.Digest())
+	assert.Equal(ti, replayed[1])
+
+	found, err = wal.Replay(2, func(walMessage) {})
+	assert.Nil(err)
+	assert.False(found)
+
+	// a torn write at the tail must not hide the valid records before it
+	assert.Nil(wal.Close())
+	f, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_APPEND|os.O_WRONLY, 0600)
+	assert.Nil(err)
+	f.Write([]byte{0x01, 0x02, 0x03})
+	f.Close()
+
+	wal, err = OpenWAL(dir)
+	assert.Nil(err)
+	replayed = replayed[:0]
+	found, err = wal.Replay(1, func(msg walMessage) {
+		replayed = append(replayed, msg)
+	})
+	assert.Nil(err)
+	assert.True(found)
+	assert.Equal(2, len(replayed))
+
+	// only the end height mark survives rotation
+	assert.Nil(wal.Rotate(2))
+	found, err = wal.Replay(1, func(walMessage) {})
+	assert.Nil(err)
+	assert.False(found)
+	replayed = replayed[:0]
+	found, err = wal.Replay(2, func(msg walMessage) {
+		replayed = append(replayed, msg)
+	})
+	assert.Nil(err)
+	assert.True(found)
+	assert.Equal(0, len(replayed))
+	assert.Nil(wal.Close())
+}
+
+// Our own votes are written to WAL by signVote, not again when receiveRoutine
+// handles them
+func TestOwnVote(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	assert := assert.New(t)
+
+	x := message.ProposedData(sha256.Sum256([]byte("x")))
+	net := newTestNetwork(t, ctrl, 2, []message.ProposedData{x, x})
+	c := net.nodes[0].core
+	vote := message.NewVote(message.PrevoteType, 1, 0, &x, &message.NilData)
+	vote.Address = net.pubKeys[0]
+	assert.True(c.isOwnVote(msgInfo{vote, nil}))
+	// echoed back by a peer
+	assert.False(c.isOwnVote(msgInfo{vote, testPeer(1)}))
+
+	vote.Address = net.pubKeys[1]
+	assert.False(c.isOwnVote(msgInfo{vote, nil}))
+	assert.False(c.isOwnVote(msgInfo{&message.VoteBatch{Votes: []*message.Vote{vote}}, nil}))
+}